@@ -0,0 +1,251 @@
+// osm-stream uploads an object to, or downloads it from, the backend of an osm config, streaming it
+// from stdin or to stdout. It lets mysql-tools pipe backups to the backend without writing them to disk.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	otx "github.com/appscode/osm/context"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/stow"
+	_ "gomodules.xyz/stow/azure"
+	_ "gomodules.xyz/stow/google"
+	"gomodules.xyz/stow/local"
+	stows3 "gomodules.xyz/stow/s3"
+	"gomodules.xyz/stow/swift"
+)
+
+// a Swift object that is not segmented is at most 5 GiB
+const maxSwiftObjectSize = 5 * 1024 * 1024 * 1024
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	var (
+		configPath string
+		context    string
+		bucket     string
+	)
+	rootCmd := &cobra.Command{
+		Use:               "osm-stream",
+		Short:             "Stream objects to and from the backend of an osm config",
+		DisableAutoGenTag: true,
+		SilenceUsage:      true,
+	}
+	rootCmd.PersistentFlags().StringVar(&configPath, "osmconfig", "/etc/osm/config", "Path to osm config")
+	rootCmd.PersistentFlags().StringVar(&context, "context", "", "Name of osmconfig context to use")
+	rootCmd.PersistentFlags().StringVarP(&bucket, "container", "c", "", "Name of container")
+
+	loadContext := func() (*otx.Context, error) {
+		config, err := otx.LoadConfig(configPath)
+		if err != nil {
+			return nil, err
+		}
+		return config.Context(context)
+	}
+	dial := func() (stow.Container, string, error) {
+		ctx, err := loadContext()
+		if err != nil {
+			return nil, "", err
+		}
+		loc, err := stow.Dial(ctx.Provider, ctx.Config)
+		if err != nil {
+			return nil, "", err
+		}
+		c, err := loc.Container(bucket)
+		return c, ctx.Provider, err
+	}
+
+	var sizeHint int64
+	putCmd := &cobra.Command{
+		Use:   "put <item>",
+		Short: "Upload stdin as item",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, err := loadContext()
+			if err != nil {
+				return err
+			}
+			r, err := limitStream(ctx.Provider, ctx.Config, os.Stdin, sizeHint)
+			if err != nil {
+				return err
+			}
+			if ctx.Provider == stows3.Kind && !s3V2Signing(ctx.Config) {
+				return putS3(ctx.Config, bucket, args[0], r, sizeHint)
+			}
+			c, provider, err := dial()
+			if err != nil {
+				return err
+			}
+			return put(c, provider, args[0], r)
+		},
+	}
+	putCmd.Flags().Int64Var(&sizeHint, "size-hint", 0, "Estimated size of stdin in bytes, that the upload is sized for, unknown if 0")
+	rootCmd.AddCommand(putCmd)
+	var progressInterval time.Duration
+	getCmd := &cobra.Command{
+		Use:   "get <item>",
+		Short: "Download item to stdout",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, _, err := dial()
+			if err != nil {
+				return err
+			}
+			item, err := c.Item(args[0])
+			if err != nil {
+				return err
+			}
+			r, err := item.Open()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			if progressInterval <= 0 {
+				_, err = io.Copy(os.Stdout, r)
+				return err
+			}
+
+			// the size is unknown to some providers
+			size, err := item.Size()
+			if err != nil {
+				size = -1
+			}
+			pr := &progressReader{r: r, w: os.Stderr, total: size, interval: progressInterval, last: time.Now()}
+			_, err = io.Copy(os.Stdout, pr)
+			pr.report()
+			return err
+		},
+	}
+	getCmd.Flags().DurationVar(&progressInterval, "progress-interval", 0, "How often the downloaded bytes are reported on stderr, never if 0")
+	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "rm <item>",
+		Short: "Remove item",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, _, err := dial()
+			if err != nil {
+				return err
+			}
+			item, err := c.Item(args[0])
+			if err == stow.ErrNotFound {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			return c.RemoveItem(item.ID())
+		},
+	})
+	return rootCmd
+}
+
+// maxStreamSize returns the size of the largest stream that provider can store as one item, or 0 if
+// it is not limited. A Swift object is limited in size, and the S3 uploader of stow, that is used
+// with v2 signing, uploads in parts of s3manager.MinUploadPartSize.
+func maxStreamSize(provider string, config stow.Config) int64 {
+	switch {
+	case provider == swift.Kind:
+		return maxSwiftObjectSize
+	case provider == stows3.Kind && s3V2Signing(config):
+		return s3manager.MinUploadPartSize * s3manager.MaxUploadParts
+	}
+	return 0
+}
+
+func s3V2Signing(config stow.Config) bool {
+	v2, _ := config.Config(stows3.ConfigV2Signing)
+	return v2 == "true"
+}
+
+// limitStream fails if a stream of sizeHint bytes can't be stored by provider, and otherwise returns
+// r, that fails once more is read from it than can be stored, instead of once the upload completes.
+func limitStream(provider string, config stow.Config, r io.Reader, sizeHint int64) (io.Reader, error) {
+	max := maxStreamSize(provider, config)
+	if max <= 0 {
+		return r, nil
+	}
+	if sizeHint > max {
+		return nil, fmt.Errorf("stream of about %d bytes can't be uploaded, %s stores items of at most %d bytes", sizeHint, provider, max)
+	}
+	return &limitedReader{r: r, provider: provider, max: max}, nil
+}
+
+// limitedReader fails once more than max bytes are read from r.
+type limitedReader struct {
+	r        io.Reader
+	provider string
+	read     int64
+	max      int64
+}
+
+func (l *limitedReader) Read(b []byte) (int, error) {
+	n, err := l.r.Read(b)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, fmt.Errorf("stream is larger than %d bytes, which is the largest item that %s stores", l.max, l.provider)
+	}
+	return n, err
+}
+
+// put uploads r as item name. The size of r is not known, which all providers but local support
+// with a size of -1. The local provider fails unless the size matches, so the file is written directly.
+func put(c stow.Container, provider, name string, r io.Reader) error {
+	if provider != local.Kind {
+		_, err := c.Put(name, r, -1, nil)
+		return err
+	}
+
+	path := filepath.Join(c.ID(), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// progressReader reports how much of r has been read on w, at most once every interval. The restore
+// Job is tracked by the operator with these lines on stderr, so their format must not change.
+type progressReader struct {
+	r        io.Reader
+	w        io.Writer
+	read     int64
+	total    int64
+	interval time.Duration
+	last     time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if time.Since(p.last) >= p.interval {
+		p.report()
+	}
+	return n, err
+}
+
+func (p *progressReader) report() {
+	p.last = time.Now()
+	if p.total < 0 {
+		fmt.Fprintf(p.w, "Downloaded %d bytes\n", p.read)
+	} else {
+		fmt.Fprintf(p.w, "Downloaded %d of %d bytes\n", p.read, p.total)
+	}
+}
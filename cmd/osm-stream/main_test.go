@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressReader(t *testing.T) {
+	cases := []struct {
+		name     string
+		total    int64
+		interval time.Duration
+		expected string
+	}{
+		{name: "known size", total: 10, interval: time.Hour, expected: "Downloaded 10 of 10 bytes\n"},
+		{name: "unknown size", total: -1, interval: time.Hour, expected: "Downloaded 10 bytes\n"},
+		{name: "every read", total: 10, interval: 0, expected: "Downloaded 4 of 10 bytes\nDownloaded 8 of 10 bytes\nDownloaded 10 of 10 bytes\nDownloaded 10 of 10 bytes\nDownloaded 10 of 10 bytes\n"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			pr := &progressReader{
+				r:        &chunkReader{data: []byte("0123456789"), chunk: 4},
+				w:        &out,
+				total:    c.total,
+				interval: c.interval,
+				last:     time.Now(),
+			}
+			data, err := ioutil.ReadAll(pr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pr.report()
+			if string(data) != "0123456789" {
+				t.Errorf("expected the data to be passed through, got %q", data)
+			}
+			if out.String() != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	r := &limitedReader{r: strings.NewReader("0123456789"), provider: "swift", max: 5}
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Errorf("expected a stream larger than max to fail")
+	}
+	r = &limitedReader{r: strings.NewReader("01234"), provider: "swift", max: 5}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != "01234" {
+		t.Errorf("expected %q, got %q with error %v", "01234", data, err)
+	}
+}
+
+// chunkReader returns at most chunk bytes of data per read.
+type chunkReader struct {
+	data  []byte
+	chunk int
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	end := r.chunk
+	if end > len(r.data) {
+		end = len(r.data)
+	}
+	n := copy(b, r.data[:end])
+	r.data = r.data[n:]
+	return n, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"gomodules.xyz/stow"
+	stows3 "gomodules.xyz/stow/s3"
+)
+
+const (
+	// part size of an S3 upload without a size hint, that allows streams of up to about 156 GiB
+	defaultS3PartSize = 16 * 1024 * 1024
+	// the largest part that S3 accepts
+	maxS3PartSize = 5 * 1024 * 1024 * 1024
+	// the size hint is doubled, as the size of a stream can only be estimated
+	s3SizeHintMargin = 2
+	// memory that the parts being uploaded are buffered in, at most
+	s3UploadBufferSize = 256 * 1024 * 1024
+)
+
+// s3PartSize returns the part size that a stream of about sizeHint bytes is uploaded to S3 with, so
+// that it fits in s3manager.MaxUploadParts parts. The parts are buffered in memory while they are
+// uploaded, so they are not larger than needed.
+func s3PartSize(sizeHint int64) int64 {
+	partSize := int64(defaultS3PartSize)
+	if sizeHint <= 0 {
+		return partSize
+	}
+	const mib = 1024 * 1024
+	if needed := (sizeHint*s3SizeHintMargin/s3manager.MaxUploadParts + mib - 1) / mib * mib; needed > partSize {
+		partSize = needed
+	}
+	if partSize > maxS3PartSize {
+		partSize = maxS3PartSize
+	}
+	return partSize
+}
+
+// s3UploadConcurrency returns how many parts of partSize are uploaded at once, so that they are
+// buffered in s3UploadBufferSize. One part is always uploaded, however large.
+func s3UploadConcurrency(partSize int64) int {
+	concurrency := int(s3UploadBufferSize / partSize)
+	switch {
+	case concurrency < 1:
+		return 1
+	case concurrency > s3manager.DefaultUploadConcurrency:
+		return s3manager.DefaultUploadConcurrency
+	}
+	return concurrency
+}
+
+// putS3 uploads r as item name of bucket, in parts of s3PartSize, s3UploadConcurrency at a time.
+// stow uploads with parts of s3manager.MinUploadPartSize, so a stream of more than about 48 GiB
+// would fail.
+func putS3(config stow.Config, bucket, name string, r io.Reader, sizeHint int64) error {
+	client, err := newS3Client(config, bucket)
+	if err != nil {
+		return err
+	}
+	partSize := s3PartSize(sizeHint)
+	uploader := s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = s3UploadConcurrency(partSize)
+	})
+	_, err = uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+		Body:   r,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s in parts of %d bytes, the stream may be larger than %d bytes. Reason: %v",
+			name, partSize, partSize*s3manager.MaxUploadParts, err)
+	}
+	return nil
+}
+
+// newS3Client returns a client for bucket, configured like the one of the stow s3 provider.
+func newS3Client(config stow.Config, bucket string) (*s3.S3, error) {
+	awsConfig := aws.NewConfig().
+		WithHTTPClient(&http.Client{}).
+		WithMaxRetries(aws.UseServiceDefaultRetries).
+		WithRegion("us-east-1")
+	if region, _ := config.Config(stows3.ConfigRegion); region != "" {
+		awsConfig.WithRegion(region)
+	}
+	if authType, _ := config.Config(stows3.ConfigAuthType); authType == "" || authType == "accesskey" {
+		accessKeyID, _ := config.Config(stows3.ConfigAccessKeyID)
+		secretKey, _ := config.Config(stows3.ConfigSecretKey)
+		awsConfig.WithCredentials(credentials.NewStaticCredentials(accessKeyID, secretKey, ""))
+	}
+	endpoint, hasEndpoint := config.Config(stows3.ConfigEndpoint)
+	if hasEndpoint {
+		awsConfig.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+	}
+	if disableSSL, _ := config.Config(stows3.ConfigDisableSSL); disableSSL == "true" {
+		awsConfig.WithDisableSSL(true)
+	}
+
+	cacert, ok := config.Config(stows3.ConfigCACertData)
+	if !ok {
+		if file, ok := config.Config(stows3.ConfigCACertFile); ok {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read root certificate: %v", err)
+			}
+			cacert = string(data)
+		}
+	}
+	if cacert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cacert)) {
+			return nil, fmt.Errorf("cannot parse root certificate")
+		}
+		// the settings of http.DefaultTransport, that can't be cloned before go 1.13
+		awsConfig.HTTPClient.Transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			TLSClientConfig:       &tls.Config{RootCAs: pool},
+		}
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 session. Reason: %v", err)
+	}
+	client := s3.New(sess)
+	// s3-compatible stores don't support looking up the region of a bucket
+	if hasEndpoint {
+		return client, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if region, err := s3manager.GetBucketRegionWithClient(ctx, client, bucket); err == nil && region != "" {
+		client = s3.New(sess, aws.NewConfig().WithRegion(region))
+	}
+	return client, nil
+}
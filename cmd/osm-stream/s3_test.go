@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func TestS3PartSize(t *testing.T) {
+	const (
+		mib = 1024 * 1024
+		gib = 1024 * mib
+	)
+	cases := []struct {
+		name     string
+		sizeHint int64
+		expected int64
+	}{
+		{name: "unknown size", sizeHint: 0, expected: defaultS3PartSize},
+		{name: "small stream", sizeHint: 10 * gib, expected: defaultS3PartSize},
+		{name: "default parts fit twice the hint", sizeHint: 78 * gib, expected: defaultS3PartSize},
+		{name: "larger parts", sizeHint: 100 * gib, expected: 21 * mib},
+		{name: "1 TiB", sizeHint: 1024 * gib, expected: 210 * mib},
+		{name: "larger than S3 stores", sizeHint: 100 * 1024 * gib, expected: maxS3PartSize},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			partSize := s3PartSize(c.sizeHint)
+			if partSize != c.expected {
+				t.Errorf("expected %d, got %d", c.expected, partSize)
+			}
+			if partSize%mib != 0 {
+				t.Errorf("part size %d is not a multiple of 1 MiB", partSize)
+			}
+			if partSize < maxS3PartSize && partSize*s3manager.MaxUploadParts < c.sizeHint*s3SizeHintMargin {
+				t.Errorf("parts of %d bytes don't fit %d bytes", partSize, c.sizeHint*s3SizeHintMargin)
+			}
+		})
+	}
+}
+
+func TestS3UploadConcurrency(t *testing.T) {
+	const mib = 1024 * 1024
+	cases := []struct {
+		name     string
+		partSize int64
+		expected int
+	}{
+		{name: "default parts", partSize: defaultS3PartSize, expected: s3manager.DefaultUploadConcurrency},
+		{name: "large parts", partSize: 100 * mib, expected: 2},
+		{name: "parts larger than the buffer", partSize: 1024 * mib, expected: 1},
+		{name: "largest parts", partSize: maxS3PartSize, expected: 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if concurrency := s3UploadConcurrency(c.partSize); concurrency != c.expected {
+				t.Errorf("expected %d, got %d", c.expected, concurrency)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ go 1.12
 
 require (
 	github.com/appscode/go v0.0.0-20191016085057-e186b6c94a3b
+	github.com/appscode/osm v0.12.0
+	github.com/aws/aws-sdk-go v1.20.20
 	github.com/codeskyblue/go-sh v0.0.0-20190412065543-76bd3d59ff27
 	github.com/coreos/go-semver v0.3.0
 	github.com/coreos/prometheus-operator v0.30.1
@@ -27,10 +27,13 @@ build() {
   chmod +x osm-alpine-amd64
   mv osm-alpine-amd64 osm
 
+  # Build osm-stream, that streams backups to and from the backend
+  CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -mod=vendor -o osm-stream "$REPO_ROOT/cmd/osm-stream"
+
   local cmd="docker build --pull -t $DOCKER_REGISTRY/$IMG:$TAG ."
   echo $cmd; $cmd
 
-  rm osm
+  rm osm osm-stream
   popd
 }
 
@@ -18,6 +18,16 @@ show_help() {
   echo "    --bucket=BUCKET                name of bucket"
   echo "    --folder=FOLDER                name of folder in bucket"
   echo "    --snapshot=SNAPSHOT            name of snapshot"
+  echo "    --mysql-data-dir=DIR           path to data directory of mysqld, for physical backups"
+  echo "    --compression=ALGORITHM        compress backups with gzip or zstd"
+  echo "    --encryption-key-file=FILE     encrypt backups with AES-256, using the passphrase in this file"
+  echo "    --binlog-dir=DIR               path to directory holding binary logs"
+  echo "    --binlog-since=SECONDS         skip binary logs that end before this unix time"
+  echo "    --stop-datetime=DATETIME       replay binary logs up to this time (UTC)"
+  echo "    --stop-gtid=GTID               replay binary logs up to and including this transaction"
+  echo "    --flush-interval=SECONDS       how often binary logs are rotated and shipped (default 300)"
+  echo "    --source-host=HOST             host of the database that is cloned"
+  echo "    --clone-method=METHOD          clone with dump or clone-plugin (default dump)"
   echo "    --enable-analytics=ENABLE_ANALYTICS   send analytical events to Google Analytics (default true)"
 }
 
@@ -31,6 +41,18 @@ DB_BUCKET=${DB_BUCKET:-}
 DB_FOLDER=${DB_FOLDER:-}
 DB_SNAPSHOT=${DB_SNAPSHOT:-}
 DB_DATA_DIR=${DB_DATA_DIR:-/var/data}
+DB_MYSQL_DATA_DIR=${DB_MYSQL_DATA_DIR:-/var/lib/mysql}
+DB_COMPRESSION=${DB_COMPRESSION:-}
+DB_ENCRYPTION_KEY_FILE=${DB_ENCRYPTION_KEY_FILE:-}
+DB_BINLOG_DIR=${DB_BINLOG_DIR:-}
+DB_BINLOG_SINCE=${DB_BINLOG_SINCE:-}
+DB_STOP_DATETIME=${DB_STOP_DATETIME:-}
+DB_STOP_GTID=${DB_STOP_GTID:-}
+DB_FLUSH_INTERVAL=${DB_FLUSH_INTERVAL:-300}
+DB_SOURCE_HOST=${DB_SOURCE_HOST:-}
+DB_SOURCE_USER=${DB_SOURCE_USER:-}
+DB_SOURCE_PASSWORD=${DB_SOURCE_PASSWORD:-}
+DB_CLONE_METHOD=${DB_CLONE_METHOD:-dump}
 OSM_CONFIG_FILE=/etc/osm/config
 ENABLE_ANALYTICS=${ENABLE_ANALYTICS:-true}
 
@@ -67,6 +89,46 @@ while test $# -gt 0; do
       export DB_SNAPSHOT=$(echo $1 | sed -e 's/^[^=]*=//g')
       shift
       ;;
+    --mysql-data-dir*)
+      export DB_MYSQL_DATA_DIR=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
+    --compression*)
+      export DB_COMPRESSION=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
+    --encryption-key-file*)
+      export DB_ENCRYPTION_KEY_FILE=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
+    --binlog-dir*)
+      export DB_BINLOG_DIR=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
+    --binlog-since*)
+      export DB_BINLOG_SINCE=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
+    --stop-datetime*)
+      export DB_STOP_DATETIME=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
+    --stop-gtid*)
+      export DB_STOP_GTID=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
+    --flush-interval*)
+      export DB_FLUSH_INTERVAL=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
+    --source-host*)
+      export DB_SOURCE_HOST=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
+    --clone-method*)
+      export DB_CLONE_METHOD=$(echo $1 | sed -e 's/^[^=]*=//g')
+      shift
+      ;;
     --analytics* | --enable-analytics*)
       export ENABLE_ANALYTICS=$(echo $1 | sed -e 's/^[^=]*=//g')
       shift
@@ -87,9 +149,258 @@ if [ -n "$DEBUG" ]; then
   echo ""
 fi
 
-# Wait for mysql to start
+# binary logs are named and parsed in UTC
+export TZ=UTC
+
+# run_sql runs a statement, and prints the result without column names
+run_sql() {
+  mysql -u "$DB_USER" --password="$DB_PASSWORD" -h "$DB_HOST" -N -s -e "$1"
+}
+
+# sql_string quotes $1 as a MySQL string literal
+sql_string() {
+  printf "'%s'" "$(printf '%s' "$1" | sed -e 's/\\/\\\\/g' -e "s/'/\\\\'/g")"
+}
+
+# sql_on runs statement $4 on host $1 as user $2 with password $3, and prints the result without column names
+sql_on() {
+  mysql -u "$2" --password="$3" -h "$1" -N -s -e "$4"
+}
+
+# ensure_clone_plugin installs the clone plugin on host $1, with user $2 and password $3, unless it is installed
+ensure_clone_plugin() {
+  if [ "$(sql_on "$1" "$2" "$3" "SELECT COUNT(*) FROM information_schema.PLUGINS WHERE PLUGIN_NAME = 'clone'")" = "0" ]; then
+    sql_on "$1" "$2" "$3" "INSTALL PLUGIN clone SONAME 'mysql_clone.so'"
+  fi
+}
+
+# clone_dump copies the user databases of DB_SOURCE_HOST to DB_HOST with mysqldump, without writing them to disk
+clone_dump() {
+  local list databases=()
+  list=$(sql_on "$DB_SOURCE_HOST" "$DB_SOURCE_USER" "$DB_SOURCE_PASSWORD" \
+    "SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME NOT IN ('mysql', 'sys', 'information_schema', 'performance_schema')")
+  if [ -z "$list" ]; then
+    echo "No databases to copy"
+    return
+  fi
+  mapfile -t databases <<<"$list"
+
+  echo "Copying ${#databases[@]} databases from $DB_SOURCE_HOST......"
+  mysqldump -u "$DB_SOURCE_USER" --password="$DB_SOURCE_PASSWORD" -h "$DB_SOURCE_HOST" \
+    --single-transaction --no-tablespaces --routines --triggers --events --set-gtid-purged=OFF --databases "${databases[@]}" "$@" |
+    mysql -u "$DB_USER" --password="$DB_PASSWORD" -h "$DB_HOST"
+}
+
+# clone_instance replaces the data directory of DB_HOST with a copy of DB_SOURCE_HOST, with the clone plugin.
+# The plugin is installed on DB_SOURCE_HOST by the operator, and the password of DB_USER restored, as the
+# clone user only has the privileges to copy.
+clone_instance() {
+  local out state
+  ensure_clone_plugin "$DB_HOST" "$DB_USER" "$DB_PASSWORD"
+  run_sql "SET GLOBAL clone_valid_donor_list = $(sql_string "$DB_SOURCE_HOST:$DB_PORT")"
+
+  echo "Cloning data directory of $DB_SOURCE_HOST......"
+  # the server shuts down once the data is copied, as there is no supervisor to restart it.
+  # It is restarted with its container.
+  if ! out=$(run_sql "CLONE INSTANCE FROM $(sql_string "$DB_SOURCE_USER")@$(sql_string "$DB_SOURCE_HOST"):$DB_PORT IDENTIFIED BY $(sql_string "$DB_SOURCE_PASSWORD")" 2>&1); then
+    if ! echo "$out" | grep -qE "ERROR (3707|2013)"; then
+      echo "$out"
+      echo "Clone failed"
+      exit 1
+    fi
+  fi
+
+  # the users are copied along with the data, so the server accepts the clone user
+  until sql_on "$DB_HOST" "$DB_SOURCE_USER" "$DB_SOURCE_PASSWORD" "SELECT 1" >/dev/null 2>&1; do
+    echo "Waiting... database is restarting"
+    sleep 5
+  done
+  state=$(sql_on "$DB_HOST" "$DB_SOURCE_USER" "$DB_SOURCE_PASSWORD" "SELECT STATE FROM performance_schema.clone_status")
+  if [ "$state" != "Completed" ]; then
+    sql_on "$DB_HOST" "$DB_SOURCE_USER" "$DB_SOURCE_PASSWORD" "SELECT ERROR_MESSAGE FROM performance_schema.clone_status"
+    echo "Clone failed"
+    exit 1
+  fi
+}
+
+# event_time prints the time of an event header of mysqlbinlog, eg, "#200102 15:04:05 server id 1 ...", in unix seconds
+event_time() {
+  date -d "$(echo "$1" | sed -E 's/^#([0-9]{2})([0-9]{2})([0-9]{2}) +([0-9:]+) .*/20\1-\2-\3 \4/')" +%s
+}
+
+# archive_binlog uploads binary log $1 of the server with server_uuid $2, named
+# <first event>_<last event>_<server_uuid>_<file> with the times of the events in unix seconds.
+# A binary log that is in the backend already, eg, shipped before the pod was recreated, is skipped.
+archive_binlog() {
+  local events first last name
+  events=$(mysqlbinlog "$DB_BINLOG_DIR/$1" | grep -E '^#[0-9]{6} +[0-9]{1,2}:[0-9]{2}:[0-9]{2} server id' | sed -n '1p;$p')
+  first=$(event_time "$(echo "$events" | head -n 1)")
+  last=$(event_time "$(echo "$events" | tail -n 1)")
+  name="${first}_${last}_$2_$1"
+
+  # if the backend can't be checked, the binary log is uploaded again under the same name
+  if osm stat --osmconfig="$OSM_CONFIG_FILE" -c "$DB_BUCKET" "$DB_FOLDER/$name" >/dev/null 2>&1; then
+    echo "Binary log $1 is archived already"
+    return
+  fi
+
+  rm -rf "$DB_DATA_DIR/upload"
+  mkdir -p "$DB_DATA_DIR/upload"
+  cp "$DB_BINLOG_DIR/$1" "$DB_DATA_DIR/upload/$name"
+  osm push --enable-analytics="$ENABLE_ANALYTICS" --osmconfig="$OSM_CONFIG_FILE" -c "$DB_BUCKET" "$DB_DATA_DIR/upload" "$DB_FOLDER"
+  echo "Archived binary log $1"
+}
+
+# stop_after_gtid passes the output of mysqlbinlog through, up to the end of the transaction with GTID $1
+stop_after_gtid() {
+  awk -v gtid="$(echo "$1" | tr 'A-F' 'a-f')" -v q="'" '
+    /^SET @@SESSION.GTID_NEXT= / {
+      if (found) {
+        done = 1
+      } else if (index(tolower($0), q gtid q)) {
+        found = 1
+      }
+    }
+    !done { print }
+  '
+}
+
+# replay_binlogs replays the binary logs pulled to DB_BINLOG_DIR in the order of their first event.
+# Transactions that are already applied, eg, from the dump, are skipped by their GTIDs.
+replay_binlogs() {
+  local files=() args=() f last
+  for f in $(ls "$DB_BINLOG_DIR" | sort -t_ -k1,1n -k2,2n); do
+    last=$(echo "$f" | cut -d_ -f2)
+    if [ -n "$DB_BINLOG_SINCE" ] && [ "$last" -lt "$DB_BINLOG_SINCE" ]; then
+      continue
+    fi
+    files+=("$DB_BINLOG_DIR/$f")
+  done
+  if [ ${#files[@]} -eq 0 ]; then
+    echo "No binary logs to replay"
+    return
+  fi
+  if [ -n "$DB_STOP_DATETIME" ]; then
+    args+=("--stop-datetime=$DB_STOP_DATETIME")
+  fi
+
+  echo "Replaying ${#files[@]} binary logs......."
+  if [ -n "$DB_STOP_GTID" ]; then
+    mysqlbinlog "${args[@]}" "${files[@]}" | stop_after_gtid "$DB_STOP_GTID" | mysql -u "$DB_USER" --password=${DB_PASSWORD} -h "$DB_HOST"
+    if [ "$(run_sql "SELECT GTID_SUBSET('$DB_STOP_GTID', @@GLOBAL.gtid_executed)")" != "1" ]; then
+      echo "Transaction $DB_STOP_GTID is not in the archived binary logs"
+      exit 1
+    fi
+  else
+    mysqlbinlog "${args[@]}" "${files[@]}" | mysql -u "$DB_USER" --password=${DB_PASSWORD} -h "$DB_HOST"
+  fi
+}
+
+# require_xtrabackup fails if the image has no xtrabackup for the version of mysql
+require_xtrabackup() {
+  if ! command -v xtrabackup >/dev/null; then
+    echo "Physical backups are not supported for this version, xtrabackup is not available"
+    exit 1
+  fi
+}
+
+# reset_password sets the password of DB_USER to DB_PASSWORD in data directory $1, that is restored
+# with the users of the backed up server. A local server is started on it, without networking, and
+# its grant tables are loaded by FLUSH PRIVILEGES, so that the users can be changed.
+reset_password() {
+  local socket=/tmp/restore-mysqld.sock pid
+  mysqld --user=mysql --datadir="$1" --skip-grant-tables --skip-networking \
+    --socket="$socket" --pid-file=/tmp/restore-mysqld.pid --log-error=/tmp/restore-mysqld.err &
+  pid=$!
+  until mysqladmin --socket="$socket" ping >/dev/null 2>&1; do
+    if ! kill -0 "$pid" 2>/dev/null; then
+      cat /tmp/restore-mysqld.err
+      echo "Failed to start the restored server"
+      exit 1
+    fi
+    sleep 1
+  done
+
+  echo "Restoring the password of $DB_USER......"
+  local statements="FLUSH PRIVILEGES;" host
+  for host in $(mysql --socket="$socket" -N -s -e "SELECT Host FROM mysql.user WHERE User = $(sql_string "$DB_USER")"); do
+    statements+="ALTER USER $(sql_string "$DB_USER")@$(sql_string "$host") IDENTIFIED BY $(sql_string "$DB_PASSWORD");"
+  done
+  mysql --socket="$socket" -e "${statements}SHUTDOWN;"
+  wait "$pid"
+}
+
+# backup_object prints the name that a backup with base name $1 is stored as in the snapshot folder,
+# eg, dumpfile.sql.zst.gpg for a compressed and encrypted dump
+backup_object() {
+  local name=$1
+  case "$DB_COMPRESSION" in
+    gzip) name="$name.gz" ;;
+    zstd) name="$name.zst" ;;
+  esac
+  if [ -n "$DB_ENCRYPTION_KEY_FILE" ]; then
+    name="$name.gpg"
+  fi
+  echo "$name"
+}
+
+compress() {
+  case "$DB_COMPRESSION" in
+    gzip) gzip -c ;;
+    zstd) zstd -q -c ;;
+    *) cat ;;
+  esac
+}
+
+decompress() {
+  case "$DB_COMPRESSION" in
+    gzip) gzip -dc ;;
+    zstd) zstd -q -dc ;;
+    *) cat ;;
+  esac
+}
+
+encrypt() {
+  if [ -n "$DB_ENCRYPTION_KEY_FILE" ]; then
+    gpg --batch --quiet --pinentry-mode loopback --passphrase-file "$DB_ENCRYPTION_KEY_FILE" \
+      --symmetric --cipher-algo AES256 --compress-algo none --output -
+  else
+    cat
+  fi
+}
+
+decrypt() {
+  if [ -n "$DB_ENCRYPTION_KEY_FILE" ]; then
+    gpg --batch --quiet --pinentry-mode loopback --passphrase-file "$DB_ENCRYPTION_KEY_FILE" --decrypt
+  else
+    cat
+  fi
+}
+
+# push_object uploads stdin as object $1 of the snapshot, without writing it to disk. $2 is the
+# estimated size of stdin in bytes, that the upload is sized for, as large streams need larger parts.
+push_object() {
+  osm-stream put --osmconfig="$OSM_CONFIG_FILE" -c "$DB_BUCKET" --size-hint="${2:-0}" "$DB_FOLDER/$DB_SNAPSHOT/$1"
+}
+
+# pull_object downloads object $1 of the snapshot to stdout, passing the other args to osm-stream
+pull_object() {
+  osm-stream get --osmconfig="$OSM_CONFIG_FILE" -c "$DB_BUCKET" "${@:2}" "$DB_FOLDER/$DB_SNAPSHOT/$1"
+}
+
+# remove_object removes object $1 of the snapshot, eg, the part of a backup that failed
+remove_object() {
+  osm-stream rm --osmconfig="$OSM_CONFIG_FILE" -c "$DB_BUCKET" "$DB_FOLDER/$DB_SNAPSHOT/$1" || true
+}
+
+# gpg keeps its state in a home directory, which may not be writable in the container
+if [ -n "$DB_ENCRYPTION_KEY_FILE" ]; then
+  export GNUPGHOME=$(mktemp -d)
+fi
+
+# Wait for mysql to start, except for restore-physical, which runs before mysqld is started
 # ref: http://unix.stackexchange.com/a/5279
-while ! nc -q 1 $DB_HOST $DB_PORT </dev/null; do
+while [ "$op" != "restore-physical" ] && ! nc -q 1 $DB_HOST $DB_PORT </dev/null; do
   echo "Waiting... database is not ready yet"
   sleep 5
 done
@@ -101,23 +412,146 @@ rm -rf *
 
 case "$op" in
   backup)
-    echo "Dumping database......"
-    mysqldump -u ${DB_USER} --password=${DB_PASSWORD} -h ${DB_HOST} "$@" >dumpfile.sql
+    object=$(backup_object dumpfile.sql)
+    # the size of the tables, the dump is about as large before it is compressed
+    size=$(run_sql "SELECT COALESCE(SUM(DATA_LENGTH + INDEX_LENGTH), 0) FROM information_schema.TABLES" || echo 0)
+
+    echo "Dumping database to the backend......"
+    if ! mysqldump -u ${DB_USER} --password=${DB_PASSWORD} -h ${DB_HOST} "$@" | compress | encrypt | push_object "$object" "$size"; then
+      remove_object "$object"
+      echo "Backup failed"
+      exit 1
+    fi
 
-    echo "Uploading dump file to the backend......."
-    osm push --enable-analytics="$ENABLE_ANALYTICS" --osmconfig="$OSM_CONFIG_FILE" -c "$DB_BUCKET" "$DB_DATA_DIR" "$DB_FOLDER/$DB_SNAPSHOT"
+    echo "Backup successful"
+    ;;
+  backup-physical)
+    require_xtrabackup
+    mkdir -p tmp
+    object=$(backup_object xtrabackup.xbstream)
+    size=$(du -sb "$DB_MYSQL_DATA_DIR" 2>/dev/null | cut -f1 || true)
+
+    echo "Copying data files of database to the backend......"
+    if ! xtrabackup --backup --stream=xbstream --tmpdir="$DB_DATA_DIR/tmp" --datadir="$DB_MYSQL_DATA_DIR" \
+      --user="$DB_USER" --password="$DB_PASSWORD" --host="$DB_HOST" --port="$DB_PORT" "$@" | compress | encrypt | push_object "$object" "$size"; then
+      remove_object "$object"
+      echo "Backup failed"
+      exit 1
+    fi
 
     echo "Backup successful"
     ;;
   restore)
-    echo "Pulling backup file from the backend"
-    osm pull --enable-analytics="$ENABLE_ANALYTICS" --osmconfig="$OSM_CONFIG_FILE" -c "$DB_BUCKET" "$DB_FOLDER/$DB_SNAPSHOT" "$DB_DATA_DIR"
+    echo "Inserting data from the backend into database........"
+    # the statements that fail are skipped, and counted once the dump is inserted.
+    # The progress and the count are read from the log by the operator.
+    status=0
+    pull_object "$(backup_object dumpfile.sql)" --progress-interval=10s | decrypt | decompress |
+      mysql -u "$DB_USER" --password=${DB_PASSWORD} -h "$DB_HOST" "$@" -f 2>sql-errors.log || status=$?
+    cat sql-errors.log >&2
+    failed=$(grep -c '^ERROR' sql-errors.log || true)
+    if [ "$failed" != "0" ]; then
+      echo "Restore failed with $failed SQL errors"
+      exit 1
+    elif [ "$status" != "0" ]; then
+      echo "Restore failed"
+      exit 1
+    fi
 
-    echo "Inserting data into database........"
-    mysql -u "$DB_USER" --password=${DB_PASSWORD} -h "$DB_HOST" "$@" -f <dumpfile.sql
+    if [ -n "$DB_BINLOG_DIR" ]; then
+      replay_binlogs
+    fi
 
     echo "Recovery successful"
     ;;
+  restore-physical)
+    # only a standalone server is restored. The servers of a cluster can't get the restored data
+    # from each other, as it is not in their binary logs, so they can't be initialized this way.
+    if [ "${HOSTNAME##*-}" != "0" ]; then
+      echo "Skipping restore of server ${HOSTNAME}"
+      exit 0
+    fi
+    if [ -n "$(ls -A "$DB_MYSQL_DATA_DIR" | grep -vxF "$(basename "$DB_DATA_DIR")" || true)" ]; then
+      echo "Data directory is not empty, skipping restore"
+      exit 0
+    fi
+    require_xtrabackup
+
+    echo "Pulling data files from the backend"
+    mkdir -p backup
+    pull_object "$(backup_object xtrabackup.xbstream)" | decrypt | decompress | xbstream -x -C backup
+
+    echo "Preparing data files........"
+    xtrabackup --prepare --target-dir="$DB_DATA_DIR/backup"
+    # before the data is moved, so that the restore starts over if the container is restarted
+    chown -R mysql:mysql "$DB_DATA_DIR/backup"
+    reset_password "$DB_DATA_DIR/backup"
+
+    find "$DB_DATA_DIR/backup" -mindepth 1 -maxdepth 1 -exec mv -t "$DB_MYSQL_DATA_DIR" {} +
+    cd "$DB_MYSQL_DATA_DIR"
+    rm -rf "$DB_DATA_DIR"
+    chown -R mysql:mysql "$DB_MYSQL_DATA_DIR"
+
+    echo "Recovery successful"
+    ;;
+  clone)
+    case "$DB_CLONE_METHOD" in
+      dump) clone_dump "$@" ;;
+      clone-plugin) clone_instance ;;
+      *)
+        echo "Unknown clone method $DB_CLONE_METHOD"
+        exit 1
+        ;;
+    esac
+
+    echo "Clone successful"
+    ;;
+  pull-binlog)
+    echo "Pulling binary logs from the backend"
+    # only the binary logs that end after DB_BINLOG_SINCE are pulled, the others are not replayed.
+    # The items are listed with their path, which may be decorated when printed.
+    listing=$(osm ls --osmconfig="$OSM_CONFIG_FILE" --prefix="$DB_FOLDER/" "$DB_BUCKET")
+    names=$(echo "$listing" | grep -oE '/[0-9]+_[0-9]+_[0-9a-fA-F-]+_[A-Za-z0-9._-]+' | sed -e 's#^/##' || true)
+    pulled=0
+    for name in $names; do
+      last=$(echo "$name" | cut -d_ -f2)
+      if [ -n "$DB_BINLOG_SINCE" ] && [ "$last" -lt "$DB_BINLOG_SINCE" ]; then
+        continue
+      fi
+      osm pull --enable-analytics="$ENABLE_ANALYTICS" --osmconfig="$OSM_CONFIG_FILE" -c "$DB_BUCKET" "$DB_FOLDER/$name" "$DB_DATA_DIR/$name"
+      pulled=$((pulled + 1))
+    done
+    echo "Pulled $pulled binary logs"
+    ;;
+  archive-binlog)
+    # names of the binary logs that are shipped. It is kept by the cleanup above, so that
+    # they are not read again when the container is restarted. It is lost with the pod, then
+    # archive_binlog finds the binary logs in the backend instead.
+    archived="$DB_DATA_DIR/.archived"
+    touch "$archived"
+    flushed=""
+    while true; do
+      # only the writable server ships binary logs, eg, the primary of a replication group
+      if [ "$(run_sql "SELECT @@GLOBAL.read_only" 2>/dev/null || true)" = "0" ]; then
+        # rotate the binary log only if there are new transactions
+        executed=$(run_sql "SELECT @@GLOBAL.gtid_executed")
+        if [ "$executed" != "$flushed" ]; then
+          run_sql "FLUSH BINARY LOGS"
+          flushed=$executed
+        fi
+        uuid=$(run_sql "SELECT @@GLOBAL.server_uuid")
+        current=$(run_sql "SHOW MASTER STATUS" | cut -f1)
+        for f in $(run_sql "SHOW BINARY LOGS" | cut -f1); do
+          if [ "$f" = "$current" ] || grep -qxF "$f" "$archived"; then
+            continue
+          fi
+          archive_binlog "$f" "$uuid"
+          echo "$f" >>"$archived"
+        done
+      fi
+      sleep "$DB_FLUSH_INTERVAL"
+    done
+    ;;
   *)
     (10)
     echo $"Unknown op!"
@@ -7,15 +7,22 @@
 #   GROUP_NAME          = a uuid treated as the name of the replication group
 #   BASE_NAME           = name of the StatefulSet (same as the name of CRD)
 #   BASE_SERVER_ID      = server-id of the primary member
+#   GROUP_MODE          = "Single-Primary" (default) or "Multi-Primary"
 #   GOV_SVC             = the name of the governing service
 #   POD_NAMESPACE       = the Pods' namespace
 #   MYSQL_ROOT_USERNAME = root user name
 #   MYSQL_ROOT_PASSWORD = root password
+#   REPLICATION_USER    = user that members use for distributed recovery
+#   REPLICATION_PASSWORD = password of the replication user
 
 script_name=${0##*/}
 NAMESPACE="$POD_NAMESPACE"
 USER="$MYSQL_ROOT_USERNAME"
 PASSWORD="$MYSQL_ROOT_PASSWORD"
+REPL_USER="${REPLICATION_USER:-repl}"
+# quotes are doubled to be used inside a quoted SQL string
+REPL_USER_SQL="${REPL_USER//\'/\'\'}"
+REPL_PASSWORD_SQL="${REPLICATION_PASSWORD//\'/\'\'}"
 
 function timestamp() {
   date +"%Y/%m/%d %T"
@@ -65,6 +72,16 @@ declare -i srv_id=$(hostname | sed -e "s/${BASE_NAME}-//g")
 
 export cur_addr="${cur_host}:33060"
 
+# In Multi-Primary mode, every member of the group accepts writes
+# https://dev.mysql.com/doc/refman/5.7/en/group-replication-multi-primary-mode.html
+if [[ "$GROUP_MODE" == "Multi-Primary" ]]; then
+  export single_primary_mode="OFF"
+  export enforce_update_everywhere_checks="ON"
+else
+  export single_primary_mode="ON"
+  export enforce_update_everywhere_checks="OFF"
+fi
+
 # Get ip_whitelist
 # https://dev.mysql.com/doc/refman/5.7/en/group-replication-options.html#sysvar_group_replication_ip_whitelist
 # https://dev.mysql.com/doc/refman/5.7/en/group-replication-ip-address-whitelisting.html
@@ -103,10 +120,9 @@ loose-group_replication_group_name = "${GROUP_NAME}"
 loose-group_replication_ip_whitelist = "${whitelist}"
 loose-group_replication_group_seeds = "${seeds}"
 
-# Single or Multi-primary mode? Uncomment these two lines
-# for multi-primary mode, where any host can accept writes
-#loose-group_replication_single_primary_mode = OFF
-#loose-group_replication_enforce_update_everywhere_checks = ON
+# Single or Multi-primary mode
+loose-group_replication_single_primary_mode = ${single_primary_mode}
+loose-group_replication_enforce_update_everywhere_checks = ${enforce_update_everywhere_checks}
 
 # Host specific replication configuration
 server_id = ${srv_id}
@@ -165,7 +181,7 @@ for host in ${member_hosts[*]}; do
 
   mysql="$mysql_header --host=$host"
 
-  out=$(${mysql} -N -e "select count(host) from mysql.user where mysql.user.user='repl';" | awk '{print$1}')
+  out=$(${mysql} -N -e "select count(host) from mysql.user where mysql.user.user='${REPL_USER_SQL}';" | awk '{print$1}')
   if [[ "$out" -eq "0" ]]; then
 
     # is_new is an array,
@@ -177,12 +193,12 @@ for host in ${member_hosts[*]}; do
 
     log "INFO" "Replication user not found and creating one..."
     ${mysql} -N -e "SET SQL_LOG_BIN=0;"
-    ${mysql} -N -e "CREATE USER 'repl'@'%' IDENTIFIED BY 'password' REQUIRE SSL;"
-    ${mysql} -N -e "GRANT REPLICATION SLAVE ON *.* TO 'repl'@'%';"
+    ${mysql} -N -e "CREATE USER '${REPL_USER_SQL}'@'%' IDENTIFIED BY '${REPL_PASSWORD_SQL}' REQUIRE SSL;"
+    ${mysql} -N -e "GRANT REPLICATION SLAVE ON *.* TO '${REPL_USER_SQL}'@'%';"
     ${mysql} -N -e "FLUSH PRIVILEGES;"
     ${mysql} -N -e "SET SQL_LOG_BIN=1;"
 
-    ${mysql} -N -e "CHANGE MASTER TO MASTER_USER='repl', MASTER_PASSWORD='password' FOR CHANNEL 'group_replication_recovery';"
+    ${mysql} -N -e "CHANGE MASTER TO MASTER_USER='${REPL_USER_SQL}', MASTER_PASSWORD='${REPL_PASSWORD_SQL}' FOR CHANNEL 'group_replication_recovery';"
   else
     log "INFO" "Replication user info exists"
     is_new=("${is_new[@]}" "0")
@@ -209,6 +225,10 @@ function find_group() {
     export mysql="$mysql_header --host=${host}"
     # value may be 'UNDEFINED'
     primary_id=$(${mysql} -N -e "SHOW STATUS WHERE Variable_name = 'group_replication_primary_member';" | awk '{print $2}')
+    if [[ "$GROUP_MODE" == "Multi-Primary" ]]; then
+      # there is no single primary in Multi-Primary mode, so any ONLINE member of a group will do
+      primary_id=$(${mysql} -N -e "SELECT MEMBER_ID FROM performance_schema.replication_group_members WHERE MEMBER_ID = @@server_uuid AND MEMBER_STATE = 'ONLINE';" | awk '{print $1}')
+    fi
     if [[ -n "$primary_id" ]]; then
       ids=($(${mysql} -N -e "SELECT MEMBER_ID FROM performance_schema.replication_group_members WHERE MEMBER_STATE = 'ONLINE' OR MEMBER_STATE = 'RECOVERING';"))
 
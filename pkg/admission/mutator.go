@@ -121,6 +121,21 @@ func setDefaultValues(client kubernetes.Interface, extClient cs.Interface, mysql
 		}
 	}
 
+	if mysql.Spec.Topology != nil && mysql.Spec.Topology.Mode != nil &&
+		*mysql.Spec.Topology.Mode == api.MySQLClusterModeReplication {
+		if mysql.Spec.Topology.Replication == nil {
+			mysql.Spec.Topology.Replication = &api.MySQLReplicationSpec{}
+		}
+
+		if mysql.Spec.Topology.Replication.BaseServerID == nil {
+			mysql.Spec.Topology.Replication.BaseServerID = types.UIntP(api.MySQLDefaultBaseServerID)
+		}
+
+		if mysql.Spec.Topology.Replication.FailoverTimeout == nil {
+			mysql.Spec.Topology.Replication.FailoverTimeout = &metav1.Duration{Duration: api.MySQLDefaultFailoverTimeout}
+		}
+	}
+
 	mysql.SetDefaults()
 
 	if err := setDefaultsFromDormantDB(extClient, mysql); err != nil {
@@ -193,7 +208,7 @@ func setDefaultsFromDormantDB(extClient cs.Interface, mysql *api.MySQL) error {
 
 	if _, err := meta_util.GetString(mysql.Annotations, api.AnnotationInitialized); err == kutil.ErrNotFound &&
 		mysql.Spec.Init != nil &&
-		(mysql.Spec.Init.SnapshotSource != nil || mysql.Spec.Init.StashRestoreSession != nil) {
+		(mysql.Spec.Init.SnapshotSource != nil || mysql.Spec.Init.MySQLBinlog != nil || mysql.Spec.Init.MySQLClone != nil || mysql.Spec.Init.StashRestoreSession != nil) {
 		mysql.Annotations = core_util.UpsertMap(mysql.Annotations, map[string]string{
 			api.AnnotationInitialized: "",
 		})
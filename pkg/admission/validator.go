@@ -2,10 +2,13 @@ package admission
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
 	"github.com/coreos/go-semver/semver"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -15,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/mergepatch"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	meta_util "kmodules.xyz/client-go/meta"
@@ -41,6 +45,35 @@ var forbiddenEnvVars = []string{
 	"MYSQL_ONETIME_PASSWORD",
 }
 
+// options that are set by the operator, or by the scripts that start the servers, and can't be set in spec.config
+var forbiddenConfigOptions = []string{
+	"server_id",
+	"report_host",
+	"report_port",
+	"bind_address",
+	"port",
+	"datadir",
+	"socket",
+	"pid_file",
+	"user",
+}
+
+// options that are set by the operator for replication, in addition to every "group_replication_*" option
+var forbiddenReplicationConfigOptions = []string{
+	"gtid_mode",
+	"enforce_gtid_consistency",
+	"log_bin",
+	"binlog_format",
+	"binlog_checksum",
+	"log_slave_updates",
+	"master_info_repository",
+	"relay_log",
+	"relay_log_info_repository",
+	"transaction_write_set_extraction",
+	"read_only",
+	"super_read_only",
+}
+
 func (a *MySQLValidator) Resource() (plural schema.GroupVersionResource, singular string) {
 	return schema.GroupVersionResource{
 			Group:    "validators.kubedb.com",
@@ -113,10 +146,19 @@ func (a *MySQLValidator) Admit(req *admission.AdmissionRequest) *admission.Admis
 			if oldMySQL.Spec.DatabaseSecret == nil {
 				oldMySQL.Spec.DatabaseSecret = mysql.Spec.DatabaseSecret
 			}
+			// Same for the Replication Secret, which is generated by the operator.
+			if oldMySQL.Spec.ReplicationSecret == nil {
+				oldMySQL.Spec.ReplicationSecret = mysql.Spec.ReplicationSecret
+			}
 
 			if err := validateUpdate(mysql, oldMySQL, req.Kind.Kind); err != nil {
 				return hookapi.StatusBadRequest(fmt.Errorf("%v", err))
 			}
+			if mysql.Spec.Version != oldMySQL.Spec.Version {
+				if err := validateVersionChange(a.extClient, mysql, oldMySQL); err != nil {
+					return hookapi.StatusBadRequest(err)
+				}
+			}
 		}
 		// validate database specs
 		if err = ValidateMySQL(a.client, a.extClient, obj.(*api.MySQL), false); err != nil {
@@ -209,6 +251,14 @@ func validateMySQLGroup(replicas int32, group api.MySQLGroupSpec) error {
 		return err
 	}
 
+	// if not set, group mode is defaulted to "Single-Primary" during mutating
+	if group.Mode != nil &&
+		*group.Mode != api.MySQLGroupModeSinglePrimary &&
+		*group.Mode != api.MySQLGroupModeMultiPrimary {
+		return errors.Errorf("invalid group mode %q, spec.topology.group.mode must be either %q or %q",
+			*group.Mode, api.MySQLGroupModeSinglePrimary, api.MySQLGroupModeMultiPrimary)
+	}
+
 	// validate group name whether it is a valid uuid
 	if _, err := uuid.Parse(group.Name); err != nil {
 		return errors.Wrapf(err, "invalid group name is set")
@@ -221,6 +271,281 @@ func validateMySQLGroup(replicas int32, group api.MySQLGroupSpec) error {
 	return nil
 }
 
+// Asynchronous replication relies on GTID auto-positioning and super_read_only,
+// so validateReplicationServerVersion() checks that the given version is at least 5.7.
+func validateReplicationServerVersion(version string) error {
+	oldest, err := semver.NewVersion(api.MySQLReplicationMinVersion)
+	if err != nil {
+		return fmt.Errorf("unable to parse oldest MySQL version %s: %v", api.MySQLReplicationMinVersion, err)
+	}
+
+	given, err := semver.NewVersion(version)
+	if err != nil {
+		return fmt.Errorf("unable to parse given MySQL version %s: %v", version, err)
+	}
+
+	if given.LessThan(*oldest) {
+		return fmt.Errorf("asynchronous replication is supported for MySQL server version %s or later, but used %s",
+			api.MySQLReplicationMinVersion, version)
+	}
+
+	return nil
+}
+
+// validateVersionChange checks that the servers of the MySQL can be upgraded in place from the old
+// to the new spec.version. An upgrade that has not succeeded can always be rolled back to the
+// previous version recorded in status.
+func validateVersionChange(extClient cs.Interface, mysql, oldMySQL *api.MySQL) error {
+	if st := oldMySQL.Status.Upgrade; st != nil &&
+		st.Phase != api.MySQLUpgradePhaseSucceeded &&
+		string(mysql.Spec.Version) == st.PreviousVersion {
+		return nil
+	}
+
+	from, err := extClient.CatalogV1alpha1().MySQLVersions().Get(string(oldMySQL.Spec.Version), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	to, err := extClient.CatalogV1alpha1().MySQLVersions().Get(string(mysql.Spec.Version), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return validateUpgradePath(from, to)
+}
+
+// validateUpgradePath checks that a server can be upgraded in place from one MySQLVersion to
+// another. Downgrades to an older major or minor version are never allowed, as the data
+// dictionary and system tables can't be downgraded. Other upgrades have to be allowed by
+// spec.upgradeFrom of the target version, except for a newer release of the same series.
+func validateUpgradePath(from, to *cat_api.MySQLVersion) error {
+	fromVersion, err := parseServerVersion(from.Spec.Version)
+	if err != nil {
+		return fmt.Errorf("unable to parse MySQL version %s: %v", from.Spec.Version, err)
+	}
+	toVersion, err := parseServerVersion(to.Spec.Version)
+	if err != nil {
+		return fmt.Errorf("unable to parse MySQL version %s: %v", to.Spec.Version, err)
+	}
+
+	sameSeries := fromVersion.Major == toVersion.Major && fromVersion.Minor == toVersion.Minor
+	if !sameSeries && toVersion.LessThan(*fromVersion) {
+		return fmt.Errorf("downgrading MySQL from version %s to %s is not supported", from.Spec.Version, to.Spec.Version)
+	}
+	if sameSeries && !toVersion.LessThan(*fromVersion) {
+		return nil
+	}
+	for _, name := range to.Spec.UpgradeFrom {
+		if name == from.Name {
+			return nil
+		}
+	}
+	return fmt.Errorf("upgrading MySQL from mysqlVersion %q (%s) to %q (%s) is not supported, it is not listed in spec.upgradeFrom of mysqlVersion %q",
+		from.Name, from.Spec.Version, to.Name, to.Spec.Version, to.Name)
+}
+
+// parseServerVersion parses spec.version of a MySQLVersion, which may omit the patch version, eg, "8.0".
+func parseServerVersion(version string) (*semver.Version, error) {
+	if strings.Count(version, ".") == 1 {
+		version += ".0"
+	}
+	return semver.NewVersion(version)
+}
+
+func validateMySQLReplication(replicas int32, replication api.MySQLReplicationSpec) error {
+	if replicas < 2 {
+		return fmt.Errorf("accepted value of 'spec.replicas' for replication is at least 2, default is %d if not specified",
+			api.MySQLDefaultReplicationSize)
+	}
+
+	// server_id of the last server must not overflow
+	if replication.BaseServerID == nil ||
+		*replication.BaseServerID == 0 ||
+		uint64(*replication.BaseServerID)+uint64(replicas)-1 > uint64(4294967295) {
+		return fmt.Errorf("invalid baseServerId specified, should be in range [1, %d]", uint64(4294967295)-uint64(replicas)+1)
+	}
+
+	// the source must be given a chance to respond to a few health checks before it is replaced
+	if replication.FailoverTimeout != nil && replication.FailoverTimeout.Duration < api.MySQLMinFailoverTimeout {
+		return fmt.Errorf("'spec.topology.replication.failoverTimeout' %v is too short, should be at least %v",
+			replication.FailoverTimeout.Duration, api.MySQLMinFailoverTimeout)
+	}
+
+	return nil
+}
+
+// validateConfig checks the options in spec.config. The names must be known to the MySQLVersion,
+// if it lists its variables, and must not be any of the options that the operator sets itself.
+func validateConfig(mysql *api.MySQL, myVer *cat_api.MySQLVersion) error {
+	if len(mysql.Spec.Config) == 0 {
+		return nil
+	}
+	if mysql.Spec.ConfigSource != nil {
+		return errors.New("'spec.config' and 'spec.configSource' can't be used together")
+	}
+
+	known := sets.NewString()
+	for _, name := range myVer.Spec.Variables {
+		known.Insert(normalizeConfigOption(name))
+	}
+	forbidden := sets.NewString(forbiddenConfigOptions...)
+	if mysql.IsReplication() || mysql.IsGroupReplication() {
+		forbidden.Insert(forbiddenReplicationConfigOptions...)
+	}
+
+	for name, value := range mysql.Spec.Config {
+		option := normalizeConfigOption(name)
+		if !configOptionRe.MatchString(option) {
+			return fmt.Errorf("'spec.config' has invalid option name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("'spec.config' has invalid value for option %q, it must not span multiple lines", name)
+		}
+		if forbidden.Has(option) || strings.HasPrefix(option, "group_replication_") {
+			return fmt.Errorf("'spec.config' can't set option %q, it is managed by the operator", name)
+		}
+		if known.Len() > 0 && !known.Has(option) {
+			return fmt.Errorf("'spec.config' has option %q, which is unknown to mysqlVersion %q", name, myVer.Name)
+		}
+	}
+	return nil
+}
+
+var configOptionRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// normalizeConfigOption returns the name of an option as a system variable, as mysqld accepts
+// either dashes or underscores, and the "loose" prefix, in option files.
+func normalizeConfigOption(name string) string {
+	name = strings.Replace(strings.ToLower(strings.TrimSpace(name)), "-", "_", -1)
+	return strings.TrimPrefix(name, "loose_")
+}
+
+// validateTLS checks that a server certificate is renewed well before it expires.
+func validateTLS(tls *api.MySQLTLSConfig) error {
+	if tls == nil {
+		return nil
+	}
+	duration, renewBefore := api.MySQLDefaultCertDuration, api.MySQLDefaultCertRenewBefore
+	if tls.Duration != nil {
+		duration = tls.Duration.Duration
+	}
+	if tls.RenewBefore != nil {
+		renewBefore = tls.RenewBefore.Duration
+	}
+	if duration < time.Hour {
+		return fmt.Errorf("'spec.tls.duration' %v is too short, should be at least %v", duration, time.Hour)
+	}
+	if renewBefore <= 0 || renewBefore >= duration {
+		return fmt.Errorf("'spec.tls.renewBefore' %v should be positive and shorter than 'spec.tls.duration' %v", renewBefore, duration)
+	}
+	return nil
+}
+
+var gtidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}(-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}:[0-9]+$`)
+
+// validateBinlog checks spec.archiver, and the Snapshot and the recovery target of spec.init.mysqlBinlog.
+func validateBinlog(mysql *api.MySQL) error {
+	if archiver := mysql.Spec.Archiver; archiver != nil {
+		if archiver.Storage == nil {
+			return errors.New("'spec.archiver.storage' is missing")
+		}
+		if err := amv.ValidateSnapshotSpec(*archiver.Storage); err != nil {
+			return err
+		}
+		if archiver.FlushInterval != nil && archiver.FlushInterval.Duration < api.MySQLMinBinlogFlushInterval {
+			return fmt.Errorf("'spec.archiver.flushInterval' %v is too short, should be at least %v",
+				archiver.FlushInterval.Duration, api.MySQLMinBinlogFlushInterval)
+		}
+	}
+
+	if mysql.Spec.Init == nil || mysql.Spec.Init.MySQLBinlog == nil {
+		return nil
+	}
+	source := mysql.Spec.Init.MySQLBinlog
+	if mysql.Spec.Init.SnapshotSource != nil {
+		return errors.New("only one of 'spec.init.snapshotSource' and 'spec.init.mysqlBinlog' can be set")
+	}
+	if source.Snapshot.Name == "" {
+		return errors.New("'spec.init.mysqlBinlog.snapshot.name' is missing")
+	}
+	if source.Storage != nil {
+		if err := amv.ValidateSnapshotSpec(*source.Storage); err != nil {
+			return err
+		}
+	}
+	if pitr := source.PITR; pitr != nil {
+		if pitr.TargetTime != nil && pitr.TargetGTID != "" {
+			return errors.New("only one of 'spec.init.mysqlBinlog.pitr.targetTime' and 'spec.init.mysqlBinlog.pitr.targetGTID' can be set")
+		}
+		if pitr.TargetGTID != "" && !gtidRe.MatchString(pitr.TargetGTID) {
+			return fmt.Errorf("'spec.init.mysqlBinlog.pitr.targetGTID' %q is not a GTID, eg, 3e11fa47-71ca-11e1-9e33-c80aa9429562:23", pitr.TargetGTID)
+		}
+	}
+	return nil
+}
+
+// validateClone checks the MySQL that spec.init.mysqlClone copies, and the method it is copied with.
+func validateClone(mysql *api.MySQL) error {
+	if mysql.Spec.Init == nil || mysql.Spec.Init.MySQLClone == nil {
+		return nil
+	}
+	source := mysql.Spec.Init.MySQLClone
+	if mysql.Spec.Init.SnapshotSource != nil || mysql.Spec.Init.MySQLBinlog != nil {
+		return errors.New("'spec.init.mysqlClone' can't be set along with 'spec.init.snapshotSource' or 'spec.init.mysqlBinlog'")
+	}
+	if source.Name == "" {
+		return errors.New("'spec.init.mysqlClone.name' is missing")
+	}
+	if source.Name == mysql.Name && (source.Namespace == "" || source.Namespace == mysql.Namespace) {
+		return errors.New("'spec.init.mysqlClone' can't refer to the MySQL itself")
+	}
+	switch source.Method {
+	case "", api.MySQLCloneMethodDump:
+	case api.MySQLCloneMethodClonePlugin:
+		if mysql.HasMemberRoles() || types.Int32(mysql.Spec.Replicas) != 1 {
+			return fmt.Errorf("'spec.init.mysqlClone.method' %v needs a MySQL with a single server", source.Method)
+		}
+	default:
+		return fmt.Errorf(`'spec.init.mysqlClone.method' %q is invalid, should be "%v" or "%v"`,
+			source.Method, api.MySQLCloneMethodDump, api.MySQLCloneMethodClonePlugin)
+	}
+	return amv.ValidateBackupTarget(source.Target)
+}
+
+// validatePhysicalInit checks that a MySQL initialized from a Physical Snapshot is a standalone
+// server, of a version with xtrabackup. The data files are restored into the first server only, and
+// the servers of a cluster can't get the restored data from it, as it is not in its binary logs.
+func validatePhysicalInit(extClient cs.Interface, mysql *api.MySQL, myVer *cat_api.MySQLVersion) error {
+	if mysql.Spec.Init == nil || mysql.Spec.Init.SnapshotSource == nil {
+		return nil
+	}
+	if _, err := meta_util.GetString(mysql.Annotations, api.AnnotationInitialized); err == nil {
+		return nil
+	}
+	source := mysql.Spec.Init.SnapshotSource
+	namespace := source.Namespace
+	if namespace == "" {
+		namespace = mysql.Namespace
+	}
+	snapshot, err := extClient.KubedbV1alpha1().Snapshots(namespace).Get(source.Name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		// the missing Snapshot is reported by the operator
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if snapshot.Spec.Method != api.BackupMethodPhysical {
+		return nil
+	}
+	if !myVer.Spec.Xtrabackup {
+		return fmt.Errorf("Snapshot %v/%v with method %v can't be restored, xtrabackup is not available for mysqlVersion %q",
+			namespace, source.Name, api.BackupMethodPhysical, myVer.Name)
+	}
+	if mysql.HasMemberRoles() || types.Int32(mysql.Spec.Replicas) != 1 {
+		return fmt.Errorf("Snapshot %v/%v with method %v can only initialize a MySQL with a single server", namespace, source.Name, api.BackupMethodPhysical)
+	}
+	return nil
+}
+
 // ValidateMySQL checks if the object satisfies all the requirements.
 // It is not method of Interface, because it is referenced from controller package too.
 func ValidateMySQL(client kubernetes.Interface, extClient cs.Interface, mysql *api.MySQL, strictValidation bool) error {
@@ -246,11 +571,10 @@ func ValidateMySQL(client kubernetes.Interface, extClient cs.Interface, mysql *a
 			return errors.New("a valid 'spec.topology.mode' must be set for MySQL clustering")
 		}
 
-		// currently supported cluster mode for MySQL is "GroupReplication". So
-		// '.spec.topology.mode' has been validated only for value "GroupReplication"
-		if *mysql.Spec.Topology.Mode != api.MySQLClusterModeGroup {
-			return errors.Errorf("currently supported cluster mode for MySQL is %[1]q, spec.topology.mode must be %[1]q",
-				api.MySQLClusterModeGroup)
+		if *mysql.Spec.Topology.Mode != api.MySQLClusterModeGroup &&
+			*mysql.Spec.Topology.Mode != api.MySQLClusterModeReplication {
+			return errors.Errorf("currently supported cluster modes for MySQL are %q and %q, but spec.topology.mode is %q",
+				api.MySQLClusterModeGroup, api.MySQLClusterModeReplication, *mysql.Spec.Topology.Mode)
 		}
 
 		// validation for group configuration is performed only when
@@ -261,6 +585,36 @@ func ValidateMySQL(client kubernetes.Interface, extClient cs.Interface, mysql *a
 				return err
 			}
 		}
+
+		// 'spec.topology.replication' is set to default during mutating
+		if *mysql.Spec.Topology.Mode == api.MySQLClusterModeReplication {
+			if mysql.Spec.Topology.Replication == nil {
+				return errors.New("'spec.topology.replication' must be set for replication")
+			}
+			if err = validateMySQLReplication(*mysql.Spec.Replicas, *mysql.Spec.Topology.Replication); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := validateConfig(mysql, myVer); err != nil {
+		return err
+	}
+
+	if err := validateTLS(mysql.Spec.TLS); err != nil {
+		return err
+	}
+
+	if err := validateBinlog(mysql); err != nil {
+		return err
+	}
+
+	if err := validateClone(mysql); err != nil {
+		return err
+	}
+
+	if err := validatePhysicalInit(extClient, mysql, myVer); err != nil {
+		return err
 	}
 
 	if err := amv.ValidateEnvVar(mysql.Spec.PodTemplate.Spec.Env, forbiddenEnvVars, api.ResourceKindMySQL); err != nil {
@@ -286,6 +640,12 @@ func ValidateMySQL(client kubernetes.Interface, extClient cs.Interface, mysql *a
 			}
 		}
 
+		if mysql.Spec.TLS != nil && mysql.Spec.TLS.IssuerSecret != nil {
+			if _, err := client.CoreV1().Secrets(mysql.Namespace).Get(mysql.Spec.TLS.IssuerSecret.Name, metav1.GetOptions{}); err != nil {
+				return err
+			}
+		}
+
 		// Check if mysqlVersion is deprecated.
 		// If deprecated, return error
 		mysqlVersion, err := extClient.CatalogV1alpha1().MySQLVersions().Get(string(mysql.Spec.Version), metav1.GetOptions{})
@@ -308,6 +668,12 @@ func ValidateMySQL(client kubernetes.Interface, extClient cs.Interface, mysql *a
 				return err
 			}
 		}
+
+		if mysql.IsReplication() {
+			if err = validateReplicationServerVersion(myVer.Spec.Version); err != nil {
+				return err
+			}
+		}
 	}
 
 	if mysql.Spec.Init != nil &&
@@ -317,11 +683,24 @@ func ValidateMySQL(client kubernetes.Interface, extClient cs.Interface, mysql *a
 			mysql.Namespace, mysql.Name, mysql.Spec.Init.SnapshotSource.Namespace, mysql.Spec.Init.SnapshotSource.Name)
 	}
 
+	if mysql.Spec.Init != nil &&
+		mysql.Spec.Init.MySQLBinlog != nil &&
+		databaseSecret == nil {
+		return fmt.Errorf("for binlog init, 'spec.databaseSecret.secretName' of %v/%v needs to be similar to older database of snapshot %v/%v",
+			mysql.Namespace, mysql.Name, mysql.Spec.Init.MySQLBinlog.Snapshot.Namespace, mysql.Spec.Init.MySQLBinlog.Snapshot.Name)
+	}
+
 	backupScheduleSpec := mysql.Spec.BackupSchedule
 	if backupScheduleSpec != nil {
 		if err := amv.ValidateBackupSchedule(client, backupScheduleSpec, mysql.Namespace); err != nil {
 			return err
 		}
+		if backupScheduleSpec.Method == api.BackupMethodPhysical && mysql.Spec.StorageType == api.StorageTypeEphemeral {
+			return fmt.Errorf(`'spec.backupSchedule.method: %v' can not be used for '%v' storage`, api.BackupMethodPhysical, api.StorageTypeEphemeral)
+		}
+		if backupScheduleSpec.Method == api.BackupMethodPhysical && !myVer.Spec.Xtrabackup {
+			return fmt.Errorf(`'spec.backupSchedule.method: %v' can not be used, xtrabackup is not available for mysqlVersion %q`, api.BackupMethodPhysical, myVer.Name)
+		}
 	}
 
 	if mysql.Spec.UpdateStrategy.Type == "" {
@@ -425,8 +804,11 @@ var preconditionSpecFields = []string{
 	"spec.storageType",
 	"spec.storage",
 	"spec.databaseSecret",
+	"spec.replicationSecret",
 	"spec.init",
 	"spec.podTemplate.spec.nodeSelector",
+	"spec.topology.mode",
+	"spec.topology.group.mode",
 }
 
 func preconditionFailedError(kind string) error {
@@ -3,7 +3,9 @@ package admission
 import (
 	"net/http"
 	"testing"
+	"time"
 
+	jtypes "github.com/appscode/go/encoding/json/types"
 	"github.com/appscode/go/types"
 	admission "k8s.io/api/admission/v1beta1"
 	apps "k8s.io/api/apps/v1"
@@ -46,7 +48,10 @@ func TestMySQLValidator_Admit(t *testing.T) {
 						Name: "8.0",
 					},
 					Spec: catalog.MySQLVersionSpec{
-						Version: "8.0.0",
+						Version:     "8.0.0",
+						UpgradeFrom: []string{"5.7.25"},
+						Variables:   []string{"max_connections", "innodb_buffer_pool_size", "skip_name_resolve"},
+						Xtrabackup:  true,
 					},
 				},
 				&catalog.MySQLVersion{
@@ -65,6 +70,15 @@ func TestMySQLValidator_Admit(t *testing.T) {
 						Version: "5.7.25",
 					},
 				},
+				&api.Snapshot{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "physical-snapshot",
+						Namespace: "default",
+					},
+					Spec: api.SnapshotSpec{
+						Method: api.BackupMethodPhysical,
+					},
+				},
 			)
 			validator.client = fake.NewSimpleClientset(
 				&core.Secret{
@@ -259,6 +273,26 @@ var cases = []struct {
 		false,
 		true,
 	},
+	{"Create valid Multi-Primary group",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		multiPrimaryGroup(),
+		api.MySQL{},
+		false,
+		true,
+	},
+	{"Create group with invalid '.spec.topology.group.mode'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		groupWithInvalidGroupMode(),
+		api.MySQL{},
+		false,
+		false,
+	},
 	{"Create group with '.spec.topology.mode' not set",
 		requestKind,
 		"foo",
@@ -359,6 +393,198 @@ var cases = []struct {
 		false,
 		false,
 	},
+
+	// For MySQL asynchronous replication
+	{"Create valid replication",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		validReplication(sampleMySQL()),
+		api.MySQL{},
+		false,
+		true,
+	},
+	{"Create replication with single replica",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		replicationWithSingleReplica(),
+		api.MySQL{},
+		false,
+		false,
+	},
+	{"Create replication with baseServerID 0",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		replicationWithBaseServerIDZero(),
+		api.MySQL{},
+		false,
+		false,
+	},
+	{"Create replication with too short failoverTimeout",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		replicationWithShortFailoverTimeout(),
+		api.MySQL{},
+		false,
+		false,
+	},
+	{"Edit '.spec.topology.mode'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Update,
+		validReplication(sampleMySQL()),
+		validGroup(sampleMySQL()),
+		false,
+		false,
+	},
+	{"Upgrade '.spec.version' from a listed version",
+		requestKind,
+		"foo",
+		"default",
+		admission.Update,
+		sampleMySQL(),
+		withVersion(sampleMySQL(), "5.7.25"),
+		false,
+		true,
+	},
+	{"Upgrade '.spec.version' from an unlisted version",
+		requestKind,
+		"foo",
+		"default",
+		admission.Update,
+		sampleMySQL(),
+		withVersion(sampleMySQL(), "5.6"),
+		false,
+		false,
+	},
+	{"Downgrade '.spec.version'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Update,
+		withVersion(sampleMySQL(), "5.7.25"),
+		sampleMySQL(),
+		false,
+		false,
+	},
+	{"Roll back a failed upgrade of '.spec.version'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Update,
+		withVersion(sampleMySQL(), "5.7.25"),
+		failedUpgrade(sampleMySQL(), "5.7.25"),
+		false,
+		true,
+	},
+	{"Create MySQL with '.spec.config'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withConfig(sampleMySQL(), map[string]string{"max-connections": "200", "skip_name_resolve": ""}),
+		api.MySQL{},
+		false,
+		true,
+	},
+	{"Create MySQL with unknown option in '.spec.config'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withConfig(sampleMySQL(), map[string]string{"max_connectionz": "200"}),
+		api.MySQL{},
+		false,
+		false,
+	},
+	{"Create MySQL with operator managed option in '.spec.config'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withConfig(sampleMySQL(), map[string]string{"server-id": "7"}),
+		api.MySQL{},
+		false,
+		false,
+	},
+	{"Create group with group replication option in '.spec.config'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withConfig(validGroup(sampleMySQL()), map[string]string{"loose-group_replication_member_weight": "60"}),
+		api.MySQL{},
+		false,
+		false,
+	},
+	{"Create MySQL with both '.spec.config' and '.spec.configSource'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withConfigSource(withConfig(sampleMySQL(), map[string]string{"max_connections": "200"})),
+		api.MySQL{},
+		false,
+		false,
+	},
+	{"Create MySQL with '.spec.tls'",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withTLS(sampleMySQL(), nil),
+		api.MySQL{},
+		false,
+		true,
+	},
+	{"Create MySQL with '.spec.tls.renewBefore' longer than duration",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withTLS(sampleMySQL(), &metaV1.Duration{Duration: 100 * 24 * time.Hour}),
+		api.MySQL{},
+		false,
+		false,
+	},
+	{"Create MySQL initialized from Physical Snapshot",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withPhysicalInit(sampleMySQL()),
+		api.MySQL{},
+		false,
+		true,
+	},
+	{"Create group initialized from Physical Snapshot",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withPhysicalInit(validGroup(sampleMySQL())),
+		api.MySQL{},
+		false,
+		false,
+	},
+	{"Create MySQL initialized from Physical Snapshot without xtrabackup",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		withPhysicalInit(withVersion(sampleMySQL(), "5.7.25")),
+		api.MySQL{},
+		false,
+		false,
+	},
 }
 
 func sampleMySQL() api.MySQL {
@@ -469,6 +695,22 @@ func validGroup(old api.MySQL) api.MySQL {
 	return old
 }
 
+func multiPrimaryGroup() api.MySQL {
+	old := validGroup(sampleMySQL())
+	mode := api.MySQLGroupModeMultiPrimary
+	old.Spec.Topology.Group.Mode = &mode
+
+	return old
+}
+
+func groupWithInvalidGroupMode() api.MySQL {
+	old := validGroup(sampleMySQL())
+	mode := api.MySQLGroupMode("multiPrimary")
+	old.Spec.Topology.Group.Mode = &mode
+
+	return old
+}
+
 func groupWithClusterModeNotSet() api.MySQL {
 	old := validGroup(sampleMySQL())
 	old.Spec.Topology.Mode = nil
@@ -539,3 +781,87 @@ func groupWithBaseServerIDExceededMaxLimit() api.MySQL {
 
 	return old
 }
+
+func validReplication(old api.MySQL) api.MySQL {
+	old.Spec.Replicas = types.Int32P(api.MySQLDefaultReplicationSize)
+	clusterMode := api.MySQLClusterModeReplication
+	old.Spec.Topology = &api.MySQLClusterTopology{
+		Mode: &clusterMode,
+		Replication: &api.MySQLReplicationSpec{
+			BaseServerID: types.UIntP(api.MySQLDefaultBaseServerID),
+		},
+	}
+
+	return old
+}
+
+func replicationWithSingleReplica() api.MySQL {
+	old := validReplication(sampleMySQL())
+	old.Spec.Replicas = types.Int32P(1)
+
+	return old
+}
+
+func replicationWithBaseServerIDZero() api.MySQL {
+	old := validReplication(sampleMySQL())
+	old.Spec.Topology.Replication.BaseServerID = types.UIntP(0)
+
+	return old
+}
+
+func replicationWithShortFailoverTimeout() api.MySQL {
+	old := validReplication(sampleMySQL())
+	old.Spec.Topology.Replication.FailoverTimeout = &metaV1.Duration{Duration: time.Second}
+
+	return old
+}
+
+func withVersion(old api.MySQL, version string) api.MySQL {
+	old.Spec.Version = jtypes.StrYo(version)
+	return old
+}
+
+func failedUpgrade(old api.MySQL, previousVersion string) api.MySQL {
+	old.Status.Upgrade = &api.MySQLUpgradeStatus{
+		Version:         string(old.Spec.Version),
+		PreviousVersion: previousVersion,
+		Phase:           api.MySQLUpgradePhaseFailed,
+	}
+	return old
+}
+
+func withConfig(old api.MySQL, config map[string]string) api.MySQL {
+	old.Spec.Config = config
+	return old
+}
+
+func withConfigSource(old api.MySQL) api.MySQL {
+	old.Spec.ConfigSource = &core.VolumeSource{
+		ConfigMap: &core.ConfigMapVolumeSource{
+			LocalObjectReference: core.LocalObjectReference{
+				Name: "my-config",
+			},
+		},
+	}
+	return old
+}
+
+func withTLS(old api.MySQL, renewBefore *metaV1.Duration) api.MySQL {
+	old.Spec.TLS = &api.MySQLTLSConfig{
+		RequireSecureTransport: true,
+		RenewBefore:            renewBefore,
+	}
+	return old
+}
+
+func withPhysicalInit(old api.MySQL) api.MySQL {
+	old.Spec.DatabaseSecret = &core.SecretVolumeSource{
+		SecretName: "foo-auth",
+	}
+	old.Spec.Init = &api.InitSpec{
+		SnapshotSource: &api.SnapshotSourceSpec{
+			Name: "physical-snapshot",
+		},
+	}
+	return old
+}
@@ -1,11 +1,13 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/appscode/go/types"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/reference"
 	kutil "kmodules.xyz/client-go"
@@ -34,6 +36,18 @@ func (c *Controller) ensureAppBinding(db *api.MySQL) (kutil.VerbType, error) {
 		return kutil.VerbUnchanged, fmt.Errorf("failed to get MySQLVersion %v for %v/%v. Reason: %v", db.Spec.Version, db.Namespace, db.Name, err)
 	}
 
+	params, err := json.Marshal(clusterParameters(db))
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+
+	var caBundle []byte
+	if db.Spec.TLS != nil {
+		if caBundle, err = c.getTLSCACert(db); err != nil {
+			return kutil.VerbUnchanged, fmt.Errorf("failed to get CA certificate for %v/%v. Reason: %v", db.Namespace, db.Name, err)
+		}
+	}
+
 	_, vt, err := appcat_util.CreateOrPatchAppBinding(c.AppCatalogClient.AppcatalogV1alpha1(), meta, func(in *appcat.AppBinding) *appcat.AppBinding {
 		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
 		in.Labels = db.OffshootLabels()
@@ -48,11 +62,17 @@ func (c *Controller) ensureAppBinding(db *api.MySQL) (kutil.VerbType, error) {
 			Path:   "/",
 		}
 		in.Spec.ClientConfig.InsecureSkipTLSVerify = false
+		in.Spec.ClientConfig.CABundle = caBundle
 
 		in.Spec.Secret = &core.LocalObjectReference{
 			Name: db.Spec.DatabaseSecret.SecretName,
 		}
 
+		in.Spec.Parameters = nil
+		if db.HasMemberRoles() {
+			in.Spec.Parameters = &runtime.RawExtension{Raw: params}
+		}
+
 		return in
 	})
 
@@ -69,3 +89,32 @@ func (c *Controller) ensureAppBinding(db *api.MySQL) (kutil.VerbType, error) {
 	}
 	return vt, nil
 }
+
+// mysqlClusterParameters are published in AppBinding.spec.parameters, so that clients
+// of a MySQL cluster can find the read-write and the read-only endpoints.
+type mysqlClusterParameters struct {
+	// Service that selects the writable member(s)
+	PrimaryService *appcat.ServiceReference `json:"primaryService,omitempty"`
+	// Service that selects the read-only members
+	ReplicasService *appcat.ServiceReference `json:"replicasService,omitempty"`
+}
+
+func clusterParameters(db *api.MySQL) mysqlClusterParameters {
+	params := mysqlClusterParameters{
+		PrimaryService: &appcat.ServiceReference{
+			Scheme: "mysql",
+			Name:   db.ServiceName(),
+			Port:   defaultDBPort.Port,
+			Path:   "/",
+		},
+	}
+	if !db.IsMultiPrimary() {
+		params.ReplicasService = &appcat.ServiceReference{
+			Scheme: "mysql",
+			Name:   db.ReplicasServiceName(),
+			Port:   defaultDBPort.Port,
+			Path:   "/",
+		}
+	}
+	return params
+}
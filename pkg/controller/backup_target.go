@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	core "k8s.io/api/core/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+const EventReasonBackupTargetFallback = "BackupTargetFallback"
+
+// backupCandidate is a server of a cluster that a backup may be taken from.
+type backupCandidate struct {
+	ordinal int
+	primary bool
+	// healthy is true if the server is ONLINE in the replication group, or is replicating from the source
+	healthy bool
+	gtids   gtidSet
+}
+
+// backupTarget returns the ordinal of the pod that the backup of snapshot is taken from, by
+// snapshot.spec.target. A standalone server is always backed up.
+func (c *Controller) backupTarget(mysql *api.MySQL, snapshot *api.Snapshot) (int, error) {
+	if !mysql.HasMemberRoles() {
+		return 0, nil
+	}
+	target := snapshot.Spec.Target
+	if target == nil {
+		target = &api.BackupTargetSpec{}
+	}
+
+	candidates, err := c.backupCandidates(mysql)
+	if err != nil {
+		return 0, err
+	}
+	ordinal, fallback, err := selectBackupTarget(target, candidates)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select server of MySQL %v/%v to back up. Reason: %v", mysql.Namespace, mysql.Name, err)
+	}
+	if fallback != "" {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeWarning,
+			EventReasonBackupTargetFallback,
+			`Snapshot "%v" is taken from the primary "%v", as %v`,
+			snapshot.Name,
+			mysql.PeerName(ordinal),
+			fallback,
+		)
+	}
+	return ordinal, nil
+}
+
+// backupCandidates returns the servers of a cluster, with their role, health and executed transactions.
+func (c *Controller) backupCandidates(mysql *api.MySQL) ([]backupCandidate, error) {
+	var members []groupMember
+	if mysql.IsGroupReplication() {
+		var err error
+		if members, err = c.getGroupMembers(mysql); err != nil {
+			return nil, err
+		}
+	}
+	source := replicationSource(mysql)
+
+	var candidates []backupCandidate
+	for i := 0; i < int(types.Int32(mysql.Spec.Replicas)); i++ {
+		name := fmt.Sprintf("%s-%d", mysql.OffshootName(), i)
+		cand := backupCandidate{
+			ordinal: i,
+		}
+		if mysql.IsGroupReplication() {
+			m := findGroupMember(members, name)
+			if m == nil || m.State != memberStateOnline {
+				candidates = append(candidates, cand)
+				continue
+			}
+			cand.primary = m.Primary
+		} else {
+			cand.primary = name == source
+		}
+
+		gtids, err := c.queryBackupCandidate(mysql, i, !cand.primary && mysql.IsReplication())
+		if err != nil {
+			log.Warningf("server %v of MySQL %v/%v can't be backed up. Reason: %v", name, mysql.Namespace, mysql.Name, err)
+		} else {
+			cand.healthy = true
+			cand.gtids = gtids
+		}
+		candidates = append(candidates, cand)
+	}
+	return candidates, nil
+}
+
+// queryBackupCandidate returns the transactions executed by the server with the given ordinal. If
+// replica is true, it fails unless the server is replicating.
+func (c *Controller) queryBackupCandidate(mysql *api.MySQL, ordinal int, replica bool) (gtidSet, error) {
+	en, err := c.newMemberClient(mysql, mysql.PeerName(ordinal))
+	if err != nil {
+		return nil, err
+	}
+	defer en.Close()
+
+	if replica {
+		rows, err := en.QueryString("SHOW SLAVE STATUS")
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 ||
+			rows[0]["Slave_IO_Running"] != replicationThreadRunning ||
+			rows[0]["Slave_SQL_Running"] != replicationThreadRunning {
+			return nil, errors.New("replica is not replicating")
+		}
+	}
+	rows, err := en.QueryString("SELECT @@GLOBAL.gtid_executed AS gtid_executed")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("failed to read gtid_executed")
+	}
+	return parseGTIDSet(rows[0]["gtid_executed"])
+}
+
+// selectBackupTarget returns the ordinal of the candidate selected by target. A secondary is selected
+// only if it is healthy, and is missing at most maxLagTransactions of the transactions of the primary.
+// Of the secondaries, the one with the most transactions is selected. If the selected server can't be
+// used, the primary is returned by the fallback policy, along with the reason.
+func selectBackupTarget(target *api.BackupTargetSpec, candidates []backupCandidate) (int, string, error) {
+	var primary *backupCandidate
+	for i := range candidates {
+		if candidates[i].primary && candidates[i].healthy {
+			primary = &candidates[i]
+			break
+		}
+	}
+	maxLag := int64(api.MySQLDefaultBackupMaxLagTransactions)
+	if target.MaxLagTransactions != nil {
+		maxLag = *target.MaxLagTransactions
+	}
+	// the lag of a secondary can't be known without the primary
+	usable := func(cand backupCandidate) bool {
+		if !cand.healthy || primary == nil {
+			return false
+		}
+		return cand.primary || int64(primary.gtids.count())-int64(cand.gtids.count()) <= maxLag
+	}
+
+	var reason string
+	switch {
+	case target.Ordinal != nil:
+		reason = fmt.Sprintf("there is no server with ordinal %d", *target.Ordinal)
+		for _, cand := range candidates {
+			if cand.ordinal != int(*target.Ordinal) {
+				continue
+			}
+			if usable(cand) {
+				return cand.ordinal, "", nil
+			}
+			reason = fmt.Sprintf("server with ordinal %d is not healthy or is lagging", cand.ordinal)
+		}
+	case target.Role == api.BackupTargetRoleSecondary:
+		var best *backupCandidate
+		for i, cand := range candidates {
+			if cand.primary || !usable(cand) {
+				continue
+			}
+			if best == nil || cand.gtids.count() > best.gtids.count() {
+				best = &candidates[i]
+			}
+		}
+		if best != nil {
+			return best.ordinal, "", nil
+		}
+		reason = "no secondary is healthy and up to date"
+	default:
+		if primary == nil {
+			return 0, "", errors.New("no primary is healthy")
+		}
+		return primary.ordinal, "", nil
+	}
+
+	if target.Fallback == api.BackupTargetFallbackNone {
+		return 0, "", errors.New(reason)
+	}
+	if primary == nil {
+		return 0, "", fmt.Errorf("%v, and no primary is healthy", reason)
+	}
+	return primary.ordinal, reason, nil
+}
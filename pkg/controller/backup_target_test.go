@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/appscode/go/types"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestSelectBackupTarget(t *testing.T) {
+	candidate := func(ordinal int, primary, healthy bool, gtids string) backupCandidate {
+		parsed, err := parseGTIDSet(gtids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return backupCandidate{ordinal: ordinal, primary: primary, healthy: healthy, gtids: parsed}
+	}
+	candidates := []backupCandidate{
+		candidate(0, false, true, uuidA+":1-4000"),
+		candidate(1, true, true, uuidA+":1-5000"),
+		candidate(2, false, true, uuidA+":1-4990"),
+		candidate(3, false, false, ""),
+	}
+
+	cases := []struct {
+		name     string
+		target   api.BackupTargetSpec
+		ordinal  int
+		fallback bool
+		err      bool
+	}{
+		{name: "primary by default", ordinal: 1},
+		{name: "least lagging secondary", target: api.BackupTargetSpec{Role: api.BackupTargetRoleSecondary}, ordinal: 2},
+		{name: "lagging secondary", target: api.BackupTargetSpec{Role: api.BackupTargetRoleSecondary, MaxLagTransactions: types.Int64P(5)}, ordinal: 1, fallback: true},
+		{name: "ordinal", target: api.BackupTargetSpec{Ordinal: types.Int32P(0), MaxLagTransactions: types.Int64P(1000)}, ordinal: 0},
+		{name: "unhealthy ordinal", target: api.BackupTargetSpec{Ordinal: types.Int32P(3)}, ordinal: 1, fallback: true},
+		{name: "missing ordinal", target: api.BackupTargetSpec{Ordinal: types.Int32P(7), Fallback: api.BackupTargetFallbackNone}, err: true},
+		{name: "no fallback", target: api.BackupTargetSpec{Ordinal: types.Int32P(3), Fallback: api.BackupTargetFallbackNone}, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ordinal, fallback, err := selectBackupTarget(&c.target, candidates)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected error, got ordinal %d", ordinal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ordinal != c.ordinal || (fallback != "") != c.fallback {
+				t.Errorf("expected ordinal %d with fallback %v, got %d with fallback %q", c.ordinal, c.fallback, ordinal, fallback)
+			}
+		})
+	}
+
+	// without a healthy primary, the lag of the secondaries is not known
+	candidates[1].healthy = false
+	if _, _, err := selectBackupTarget(&api.BackupTargetSpec{Role: api.BackupTargetRoleSecondary}, candidates); err == nil {
+		t.Error("expected error without a healthy primary")
+	}
+}
@@ -0,0 +1,552 @@
+package controller
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gomodules.xyz/stow"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/reference"
+	core_util "kmodules.xyz/client-go/core/v1"
+	"kmodules.xyz/client-go/tools/analytics"
+	store "kmodules.xyz/objectstore-api/api/v1"
+	storage "kmodules.xyz/objectstore-api/osm"
+	catalog "kubedb.dev/apimachinery/apis/catalog/v1alpha1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+)
+
+const (
+	// folder of the archived binary logs, next to the Snapshots of a MySQL
+	binlogFolder = "binlog"
+
+	binlogArchiverContainerName = "binlog-archiver"
+	binlogPullerContainerName   = "pull-binlog"
+
+	// where the archiver container stages the binary logs for upload
+	binlogStagingDir = "/var/data"
+	// where the restore Job pulls the archived binary logs to
+	binlogRestoreDir = "/var/binlog"
+
+	// volume with the osm config for the binary logs, in the StatefulSet and in the restore Job
+	binlogOSMVolumeName = "binlog-osmconfig"
+
+	// layout of --stop-datetime of mysqlbinlog, in UTC
+	binlogDatetimeLayout = "2006-01-02 15:04:05"
+)
+
+func binlogFlushInterval(mysql *api.MySQL) time.Duration {
+	if mysql.Spec.Archiver.FlushInterval != nil {
+		return mysql.Spec.Archiver.FlushInterval.Duration
+	}
+	return api.MySQLDefaultBinlogFlushInterval
+}
+
+// binlogServerArgs returns the options that a standalone server is started with, so that it writes
+// binary logs with GTIDs, for spec.archiver, or to replay the archived binary logs of
+// spec.init.mysqlBinlog. The servers of a cluster always write them.
+func binlogServerArgs(mysql *api.MySQL) []string {
+	if mysql.IsGroupReplication() || mysql.IsReplication() {
+		return nil
+	}
+	if mysql.Spec.Archiver == nil && (mysql.Spec.Init == nil || mysql.Spec.Init.MySQLBinlog == nil) {
+		return nil
+	}
+	return []string{
+		"--server-id=1",
+		"--log-bin=binlog",
+		"--binlog-format=ROW",
+		"--gtid-mode=ON",
+		"--enforce-gtid-consistency=ON",
+	}
+}
+
+// binlogLocation returns the folder in backend that the binary logs of MySQL namespace/name are
+// archived in. It is next to the folders of the Snapshots of the MySQL, see Snapshot.Location().
+func binlogLocation(backend store.Backend, namespace, name string) (string, error) {
+	prefix, err := backend.Prefix()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(prefix, api.DatabaseNamePrefix, namespace, name, binlogFolder), nil
+}
+
+// ensureBinlogArchiver writes the osm config of spec.archiver.storage into the Secret that the
+// archiver container ships the binary logs with. If spec.archiver is unset, the Secret is deleted
+// and the status of the archive is cleared.
+func (c *Controller) ensureBinlogArchiver(mysql *api.MySQL) error {
+	if mysql.Spec.Archiver == nil {
+		if mysql.Status.BinlogArchive == nil {
+			return nil
+		}
+		err := c.Client.CoreV1().Secrets(mysql.Namespace).Delete(mysql.BinlogArchiverSecretName(), nil)
+		if err != nil && !kerr.IsNotFound(err) {
+			return err
+		}
+		return c.updateBinlogArchiveStatus(mysql, nil)
+	}
+	if mysql.Spec.Archiver.Storage == nil {
+		return fmt.Errorf("spec.archiver.storage of MySQL %v/%v is not set", mysql.Namespace, mysql.Name)
+	}
+
+	ref, err := reference.GetReference(clientsetscheme.Scheme, mysql)
+	if err != nil {
+		return err
+	}
+	secret, err := storage.NewOSMSecret(c.Client, mysql.BinlogArchiverSecretName(), mysql.Namespace, *mysql.Spec.Archiver.Storage)
+	if err != nil {
+		return err
+	}
+	_, _, err = core_util.CreateOrPatchSecret(c.Client, secret.ObjectMeta, func(in *core.Secret) *core.Secret {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
+		in.Labels = mysql.OffshootLabels()
+		in.Data = secret.Data
+		return in
+	})
+	return err
+}
+
+// binlogArchiverContainer returns the container that ships the binary logs of the server in its pod
+// to spec.archiver.storage, or nil if spec.archiver is not set. The container ships them only while
+// the server is writable, eg, from the primary of a replication group. Every flush interval, it
+// rotates the binary log if there are new transactions, and uploads the closed binary logs.
+func (c *Controller) binlogArchiverContainer(mysql *api.MySQL, mysqlVersion *catalog.MySQLVersion) (*core.Container, error) {
+	if mysql.Spec.Archiver == nil || mysql.Spec.Archiver.Storage == nil {
+		return nil, nil
+	}
+	backend := *mysql.Spec.Archiver.Storage
+	bucket, err := backend.Container()
+	if err != nil {
+		return nil, err
+	}
+	folder, err := binlogLocation(backend, mysql.Namespace, mysql.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	container := &core.Container{
+		Name:  binlogArchiverContainerName,
+		Image: mysqlVersion.Spec.Tools.Image,
+		Args: []string{
+			"archive-binlog",
+			"--host=127.0.0.1",
+			fmt.Sprintf(`--data-dir=%s`, binlogStagingDir),
+			fmt.Sprintf(`--binlog-dir=%s`, "/var/lib/mysql"),
+			fmt.Sprintf(`--bucket=%s`, bucket),
+			fmt.Sprintf(`--folder=%s`, folder),
+			fmt.Sprintf(`--flush-interval=%d`, int64(binlogFlushInterval(mysql).Seconds())),
+			fmt.Sprintf(`--enable-analytics=%v`, c.EnableAnalytics),
+		},
+		Env: append(databaseCredentialEnvs(mysql), core.EnvVar{
+			Name:  analytics.Key,
+			Value: c.AnalyticsClientID,
+		}),
+		VolumeMounts: []core.VolumeMount{
+			{
+				Name:      "data",
+				MountPath: "/var/lib/mysql",
+				ReadOnly:  true,
+			},
+			{
+				Name:      "binlog-staging",
+				MountPath: binlogStagingDir,
+			},
+			{
+				Name:      binlogOSMVolumeName,
+				MountPath: storage.SecretMountPath,
+				ReadOnly:  true,
+			},
+		},
+	}
+	if backend.Local != nil {
+		container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
+			Name:      "binlog-local",
+			MountPath: backend.Local.MountPath,
+			SubPath:   backend.Local.SubPath,
+		})
+	}
+	return container, nil
+}
+
+// upsertBinlogArchiver adds the archiver container to the pod template, or removes it if archiver is nil.
+func upsertBinlogArchiver(statefulSet *apps.StatefulSet, mysql *api.MySQL, archiver *core.Container) *apps.StatefulSet {
+	spec := &statefulSet.Spec.Template.Spec
+	if archiver == nil {
+		spec.Containers = core_util.EnsureContainerDeleted(spec.Containers, binlogArchiverContainerName)
+		spec.Volumes = core_util.EnsureVolumeDeleted(spec.Volumes, "binlog-staging")
+		spec.Volumes = core_util.EnsureVolumeDeleted(spec.Volumes, binlogOSMVolumeName)
+		spec.Volumes = core_util.EnsureVolumeDeleted(spec.Volumes, "binlog-local")
+		return statefulSet
+	}
+
+	spec.Containers = core_util.UpsertContainer(spec.Containers, *archiver)
+	spec.Volumes = core_util.UpsertVolume(
+		spec.Volumes,
+		core.Volume{
+			Name: "binlog-staging",
+			VolumeSource: core.VolumeSource{
+				EmptyDir: &core.EmptyDirVolumeSource{},
+			},
+		},
+		core.Volume{
+			Name: binlogOSMVolumeName,
+			VolumeSource: core.VolumeSource{
+				Secret: &core.SecretVolumeSource{
+					SecretName: mysql.BinlogArchiverSecretName(),
+				},
+			},
+		},
+	)
+	if local := mysql.Spec.Archiver.Storage.Local; local != nil {
+		spec.Volumes = core_util.UpsertVolume(spec.Volumes, core.Volume{
+			Name:         "binlog-local",
+			VolumeSource: local.VolumeSource,
+		})
+	} else {
+		spec.Volumes = core_util.EnsureVolumeDeleted(spec.Volumes, "binlog-local")
+	}
+	return statefulSet
+}
+
+// databaseCredentialEnvs returns the environment variables with the credentials in the database
+// secret, that mysql-tools connects to the servers with.
+func databaseCredentialEnvs(mysql *api.MySQL) []core.EnvVar {
+	return []core.EnvVar{
+		{
+			Name: "DB_USER",
+			ValueFrom: &core.EnvVarSource{
+				SecretKeyRef: &core.SecretKeySelector{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: mysql.Spec.DatabaseSecret.SecretName,
+					},
+					Key: KeyMySQLUser,
+				},
+			},
+		},
+		{
+			Name: "DB_PASSWORD",
+			ValueFrom: &core.EnvVarSource{
+				SecretKeyRef: &core.SecretKeySelector{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: mysql.Spec.DatabaseSecret.SecretName,
+					},
+					Key: KeyMySQLPassword,
+				},
+			},
+		},
+	}
+}
+
+// archivedBinlog is a binary log in the object store. mysql-tools names it
+// <first event>_<last event>_<server_uuid>_<file>, with the times of the events in unix seconds.
+type archivedBinlog struct {
+	name       string
+	first      time.Time
+	last       time.Time
+	serverUUID string
+	file       string
+}
+
+func parseArchivedBinlog(name string) (*archivedBinlog, error) {
+	parts := strings.SplitN(name, "_", 4)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid name of archived binary log %q", name)
+	}
+	first, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name of archived binary log %q. Reason: %v", name, err)
+	}
+	last, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name of archived binary log %q. Reason: %v", name, err)
+	}
+	return &archivedBinlog{
+		name:       name,
+		first:      time.Unix(first, 0).UTC(),
+		last:       time.Unix(last, 0).UTC(),
+		serverUUID: parts[2],
+		file:       parts[3],
+	}, nil
+}
+
+// listArchivedBinlogs returns the binary logs of mysql in spec.archiver.storage. Objects that are
+// not named by mysql-tools are ignored.
+func (c *Controller) listArchivedBinlogs(mysql *api.MySQL) ([]archivedBinlog, error) {
+	backend := *mysql.Spec.Archiver.Storage
+	cfg, err := storage.NewOSMContext(c.Client, backend, mysql.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := stow.Dial(cfg.Provider, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := backend.Container()
+	if err != nil {
+		return nil, err
+	}
+	container, err := loc.Container(bucket)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := binlogLocation(backend, mysql.Namespace, mysql.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var binlogs []archivedBinlog
+	cursor := stow.CursorStart
+	for {
+		items, next, err := container.Items(folder+"/", cursor, 50)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if b, err := parseArchivedBinlog(path.Base(item.ID())); err == nil {
+				binlogs = append(binlogs, *b)
+			}
+		}
+		cursor = next
+		if stow.IsCursorEnd(cursor) {
+			break
+		}
+	}
+	return binlogs, nil
+}
+
+// binlogArchiveStatus returns the time window that a MySQL can be restored to, from its archived
+// binary logs and its Snapshots. A Snapshot can be restored to any time after it completed, if it
+// was started after the first archived transaction, as the later transactions are replayed from
+// the binary logs.
+func binlogArchiveStatus(binlogs []archivedBinlog, snapshots []api.Snapshot) *api.MySQLBinlogArchiveStatus {
+	st := &api.MySQLBinlogArchiveStatus{}
+	if len(binlogs) == 0 {
+		return st
+	}
+	sort.Slice(binlogs, func(i, j int) bool {
+		if !binlogs[i].last.Equal(binlogs[j].last) {
+			return binlogs[i].last.Before(binlogs[j].last)
+		}
+		return binlogs[i].name < binlogs[j].name
+	})
+	latest := binlogs[len(binlogs)-1]
+	first := latest.first
+	for _, b := range binlogs {
+		if b.first.Before(first) {
+			first = b.first
+		}
+	}
+	st.LastArchivedFile = latest.name
+	until := metav1.NewTime(latest.last)
+	st.RecoverableUntil = &until
+
+	for _, s := range snapshots {
+		if s.Status.Phase != api.SnapshotPhaseSucceeded || s.Status.StartTime == nil || s.Status.CompletionTime == nil {
+			continue
+		}
+		if s.Status.StartTime.Time.Before(first) || s.Status.CompletionTime.Time.After(latest.last) {
+			continue
+		}
+		if st.RecoverableFrom == nil || s.Status.CompletionTime.Before(st.RecoverableFrom) {
+			from := *s.Status.CompletionTime
+			st.RecoverableFrom = &from
+		}
+	}
+	return st
+}
+
+// syncBinlogArchiveStatus reports the binary logs in spec.archiver.storage and the time window that
+// the MySQL can be restored to. It is refreshed every flush interval. If the binary logs can't be
+// listed, the last window is kept with the reason.
+func (c *Controller) syncBinlogArchiveStatus(mysql *api.MySQL) error {
+	if mysql.Spec.Archiver == nil || mysql.Spec.Archiver.Storage == nil {
+		return nil
+	}
+	defer c.requeueAfter(mysql, binlogFlushInterval(mysql))
+
+	var st *api.MySQLBinlogArchiveStatus
+	binlogs, err := c.listArchivedBinlogs(mysql)
+	if err == nil {
+		var snapshots *api.SnapshotList
+		snapshots, err = c.ExtClient.KubedbV1alpha1().Snapshots(mysql.Namespace).List(metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(mysql.OffshootSelectors()).String(),
+		})
+		if err == nil {
+			st = binlogArchiveStatus(binlogs, snapshots.Items)
+		}
+	}
+	if err != nil {
+		st = mysql.Status.BinlogArchive.DeepCopy()
+		if st == nil {
+			st = &api.MySQLBinlogArchiveStatus{}
+		}
+		st.Reason = fmt.Sprintf("failed to list archived binary logs. Reason: %v", err)
+	}
+	if reflect.DeepEqual(st, mysql.Status.BinlogArchive) {
+		return err
+	}
+	if uerr := c.updateBinlogArchiveStatus(mysql, st); uerr != nil {
+		return uerr
+	}
+	return err
+}
+
+func (c *Controller) updateBinlogArchiveStatus(mysql *api.MySQL, st *api.MySQLBinlogArchiveStatus) error {
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		in.BinlogArchive = st
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+	return nil
+}
+
+// restoreSnapshotSource returns the Snapshot that the MySQL is initialized from, by spec.init.snapshotSource
+// or by spec.init.mysqlBinlog.
+func restoreSnapshotSource(mysql *api.MySQL) *api.SnapshotSourceSpec {
+	if mysql.Spec.Init.MySQLBinlog != nil {
+		return &mysql.Spec.Init.MySQLBinlog.Snapshot
+	}
+	return mysql.Spec.Init.SnapshotSource
+}
+
+// binlogReplayArgs returns the options of the restore Job that replay the binary logs pulled to
+// binlogRestoreDir, after the Snapshot is restored. The binary logs that end before the Snapshot
+// was started are skipped, as their transactions are in the Snapshot.
+func binlogReplayArgs(mysql *api.MySQL, snapshot *api.Snapshot) []string {
+	args := []string{fmt.Sprintf(`--binlog-dir=%s`, binlogRestoreDir)}
+	if snapshot.Status.StartTime != nil {
+		args = append(args, fmt.Sprintf(`--binlog-since=%d`, snapshot.Status.StartTime.Unix()))
+	}
+	if pitr := mysql.Spec.Init.MySQLBinlog.PITR; pitr != nil {
+		if pitr.TargetTime != nil {
+			args = append(args, fmt.Sprintf(`--stop-datetime=%s`, pitr.TargetTime.UTC().Format(binlogDatetimeLayout)))
+		}
+		if pitr.TargetGTID != "" {
+			args = append(args, fmt.Sprintf(`--stop-gtid=%s`, strings.ToLower(pitr.TargetGTID)))
+		}
+	}
+	return args
+}
+
+// upsertBinlogPuller adds an init container to the restore Job, that pulls the archived binary logs
+// of the MySQL of the Snapshot to binlogRestoreDir, skipping those that end before the Snapshot was
+// started. They are pulled from spec.init.mysqlBinlog.storage, or from the backend of the Snapshot.
+func (c *Controller) upsertBinlogPuller(job *batch.Job, mysql *api.MySQL, snapshot *api.Snapshot, image string) error {
+	backend := snapshot.Spec.Backend
+	secretName := snapshot.OSMSecretName()
+	if s := mysql.Spec.Init.MySQLBinlog.Storage; s != nil {
+		backend = *s
+		secretName = fmt.Sprintf("osm-%v-binlog-restore", mysql.OffshootName())
+
+		ref, err := reference.GetReference(clientsetscheme.Scheme, mysql)
+		if err != nil {
+			return err
+		}
+		secret, err := storage.NewOSMSecret(c.Client, secretName, mysql.Namespace, backend)
+		if err != nil {
+			return err
+		}
+		if _, _, err = core_util.CreateOrPatchSecret(c.Client, secret.ObjectMeta, func(in *core.Secret) *core.Secret {
+			core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
+			in.Labels = mysql.OffshootLabels()
+			in.Data = secret.Data
+			return in
+		}); err != nil {
+			return err
+		}
+	}
+	bucket, err := backend.Container()
+	if err != nil {
+		return err
+	}
+	folder, err := binlogLocation(backend, snapshot.Namespace, snapshot.Spec.DatabaseName)
+	if err != nil {
+		return err
+	}
+
+	puller := core.Container{
+		Name:  binlogPullerContainerName,
+		Image: image,
+		Args: []string{
+			"pull-binlog",
+			fmt.Sprintf(`--host=%s`, mysql.ServiceName()),
+			fmt.Sprintf(`--data-dir=%s`, binlogRestoreDir),
+			fmt.Sprintf(`--bucket=%s`, bucket),
+			fmt.Sprintf(`--folder=%s`, folder),
+			fmt.Sprintf(`--enable-analytics=%v`, c.EnableAnalytics),
+		},
+		Env: []core.EnvVar{
+			{
+				Name:  analytics.Key,
+				Value: c.AnalyticsClientID,
+			},
+		},
+		Resources: snapshot.Spec.PodTemplate.Spec.Resources,
+		VolumeMounts: []core.VolumeMount{
+			{
+				Name:      "binlog",
+				MountPath: binlogRestoreDir,
+			},
+			{
+				Name:      binlogOSMVolumeName,
+				MountPath: storage.SecretMountPath,
+				ReadOnly:  true,
+			},
+		},
+	}
+	// the binary logs that are not replayed are not pulled
+	if snapshot.Status.StartTime != nil {
+		puller.Args = append(puller.Args, fmt.Sprintf(`--binlog-since=%d`, snapshot.Status.StartTime.Unix()))
+	}
+	spec := &job.Spec.Template.Spec
+	spec.Volumes = core_util.UpsertVolume(
+		spec.Volumes,
+		core.Volume{
+			Name: "binlog",
+			VolumeSource: core.VolumeSource{
+				EmptyDir: &core.EmptyDirVolumeSource{},
+			},
+		},
+		core.Volume{
+			Name: binlogOSMVolumeName,
+			VolumeSource: core.VolumeSource{
+				Secret: &core.SecretVolumeSource{
+					SecretName: secretName,
+				},
+			},
+		},
+	)
+	if backend.Local != nil {
+		puller.VolumeMounts = append(puller.VolumeMounts, core.VolumeMount{
+			Name:      "binlog-local",
+			MountPath: backend.Local.MountPath,
+			SubPath:   backend.Local.SubPath,
+		})
+		spec.Volumes = core_util.UpsertVolume(spec.Volumes, core.Volume{
+			Name:         "binlog-local",
+			VolumeSource: backend.Local.VolumeSource,
+		})
+	}
+	spec.InitContainers = core_util.UpsertContainer(spec.InitContainers, puller)
+	spec.Containers[0].VolumeMounts = core_util.UpsertVolumeMount(spec.Containers[0].VolumeMounts, core.VolumeMount{
+		Name:      "binlog",
+		MountPath: binlogRestoreDir,
+		ReadOnly:  true,
+	})
+	return nil
+}
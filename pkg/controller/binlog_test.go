@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestParseArchivedBinlog(t *testing.T) {
+	b, err := parseArchivedBinlog("1577941445_1577941745_3e11fa47-71ca-11e1-9e33-c80aa9429562_binlog.000042")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.first.Unix() != 1577941445 || b.last.Unix() != 1577941745 {
+		t.Errorf("unexpected times %v, %v", b.first, b.last)
+	}
+	if b.serverUUID != "3e11fa47-71ca-11e1-9e33-c80aa9429562" || b.file != "binlog.000042" {
+		t.Errorf("unexpected server %q or file %q", b.serverUUID, b.file)
+	}
+
+	for _, name := range []string{"binlog.000042", "x_1577941745_uuid_binlog.000042", "dumpfile.sql"} {
+		if _, err := parseArchivedBinlog(name); err == nil {
+			t.Errorf("expected error for %q", name)
+		}
+	}
+}
+
+func TestBinlogArchiveStatus(t *testing.T) {
+	at := func(sec int64) *metav1.Time {
+		t := metav1.NewTime(time.Unix(sec, 0).UTC())
+		return &t
+	}
+	binlog := func(name string) archivedBinlog {
+		b, err := parseArchivedBinlog(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *b
+	}
+	snapshot := func(phase api.SnapshotPhase, start, completion int64) api.Snapshot {
+		return api.Snapshot{
+			Status: api.SnapshotStatus{
+				Phase:          phase,
+				StartTime:      at(start),
+				CompletionTime: at(completion),
+			},
+		}
+	}
+
+	binlogs := []archivedBinlog{
+		binlog("1300_1600_uuid-b_binlog.000003"),
+		binlog("1000_1300_uuid-a_binlog.000001"),
+		binlog("1300_1500_uuid-a_binlog.000002"),
+	}
+	snapshots := []api.Snapshot{
+		// started before the first archived transaction
+		snapshot(api.SnapshotPhaseSucceeded, 900, 950),
+		snapshot(api.SnapshotPhaseFailed, 1100, 1150),
+		snapshot(api.SnapshotPhaseSucceeded, 1200, 1250),
+		snapshot(api.SnapshotPhaseSucceeded, 1400, 1420),
+		// completed after the last archived transaction
+		snapshot(api.SnapshotPhaseSucceeded, 1700, 1750),
+	}
+
+	st := binlogArchiveStatus(binlogs, snapshots)
+	if st.LastArchivedFile != "1300_1600_uuid-b_binlog.000003" {
+		t.Errorf("unexpected last archived file %q", st.LastArchivedFile)
+	}
+	if st.RecoverableUntil == nil || st.RecoverableUntil.Unix() != 1600 {
+		t.Errorf("expected recoverable until 1600, got %v", st.RecoverableUntil)
+	}
+	if st.RecoverableFrom == nil || st.RecoverableFrom.Unix() != 1250 {
+		t.Errorf("expected recoverable from 1250, got %v", st.RecoverableFrom)
+	}
+
+	st = binlogArchiveStatus(binlogs, snapshots[:2])
+	if st.RecoverableFrom != nil {
+		t.Errorf("expected no recoverable window without a Snapshot, got %v", st.RecoverableFrom)
+	}
+	if st := binlogArchiveStatus(nil, snapshots); st.RecoverableUntil != nil || st.LastArchivedFile != "" {
+		t.Errorf("expected empty status without binary logs, got %+v", st)
+	}
+}
@@ -0,0 +1,672 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	"github.com/go-xorm/xorm"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/reference"
+	core_util "kmodules.xyz/client-go/core/v1"
+	"kmodules.xyz/client-go/tools/analytics"
+	catalog "kubedb.dev/apimachinery/apis/catalog/v1alpha1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+	"kubedb.dev/apimachinery/pkg/eventer"
+)
+
+const (
+	// cloneNamespacesAnnotation on a MySQL lists the namespaces, separated by commas, whose MySQLs may
+	// copy its data with spec.init.mysqlClone, or "*" for any namespace
+	cloneNamespacesAnnotation = api.MySQLKey + "/clone-namespaces"
+
+	// op of mysql-tools that copies the data of a MySQL, and its methods
+	opClone                = "clone"
+	cloneMethodDump        = "dump"
+	cloneMethodClonePlugin = "clone-plugin"
+
+	// how often the progress of a copy is checked
+	clonePollInterval = 15 * time.Second
+)
+
+// initMySQLCloneWatcher reports the progress of the copies of spec.init.mysqlClone.
+func (c *Controller) initMySQLCloneWatcher() {
+	c.cloneQueue = c.newInitJobQueue("MySQLClone", cloneJob{c}, clonePollInterval)
+}
+
+func cloneJobName(mysql *api.MySQL) string {
+	return fmt.Sprintf("%s-%s-clone", api.DatabaseNamePrefix, mysql.OffshootName())
+}
+
+// cloneSourceSecretName is the Secret with the credentials of the clone user of the MySQL that is
+// copied, in the namespace of the new MySQL, for the clone Job.
+func cloneSourceSecretName(mysql *api.MySQL) string {
+	return fmt.Sprintf("%s-clone-source-auth", mysql.OffshootName())
+}
+
+// cloneSourceMeta returns the namespace and name of the MySQL that mysql is copied from.
+func cloneSourceMeta(mysql *api.MySQL) (string, string) {
+	source := mysql.Spec.Init.MySQLClone
+	if source.Namespace == "" {
+		return mysql.Namespace, source.Name
+	}
+	return source.Namespace, source.Name
+}
+
+// cloneAllowed reports whether source may be copied to a MySQL in namespace.
+func cloneAllowed(source *api.MySQL, namespace string) bool {
+	if source.Namespace == namespace {
+		return true
+	}
+	for _, ns := range strings.Split(source.Annotations[cloneNamespacesAnnotation], ",") {
+		if ns = strings.TrimSpace(ns); ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneMethod returns the method that mysql is copied from source with. The clone plugin copies the
+// whole data directory, so both need to run the same version, and mysql needs to be a single server.
+func cloneMethod(mysql *api.MySQL, myVersion, sourceVersion *catalog.MySQLVersion) (api.MySQLCloneMethod, error) {
+	var reason string
+	switch {
+	case !myVersion.Spec.ClonePlugin || !sourceVersion.Spec.ClonePlugin:
+		reason = "the clone plugin is not supported by the version of both MySQLs"
+	case myVersion.Spec.Version != sourceVersion.Spec.Version:
+		reason = fmt.Sprintf("version %v of the MySQL differs from version %v of the source", myVersion.Spec.Version, sourceVersion.Spec.Version)
+	case mysql.HasMemberRoles() || types.Int32(mysql.Spec.Replicas) != 1:
+		reason = "the MySQL is not a single server"
+	}
+
+	switch mysql.Spec.Init.MySQLClone.Method {
+	case api.MySQLCloneMethodDump:
+		return api.MySQLCloneMethodDump, nil
+	case api.MySQLCloneMethodClonePlugin:
+		if reason != "" {
+			return "", fmt.Errorf("method %v can't be used, as %v", api.MySQLCloneMethodClonePlugin, reason)
+		}
+		return api.MySQLCloneMethodClonePlugin, nil
+	default:
+		if reason != "" {
+			return api.MySQLCloneMethodDump, nil
+		}
+		return api.MySQLCloneMethodClonePlugin, nil
+	}
+}
+
+// initializeFromClone starts copying the data of the MySQL in spec.init.mysqlClone to mysql, with a
+// Job that streams it from a server of the source. The Job is tracked as a cloneJob. Until the Job
+// is created, nothing is written to mysql, so errors are returned for the copy to be retried.
+func (c *Controller) initializeFromClone(mysql *api.MySQL) error {
+	if st := mysql.Status.Clone; st != nil && st.Phase == api.MySQLClonePhaseRunning {
+		return nil
+	}
+
+	namespace, name := cloneSourceMeta(mysql)
+	source, err := c.ExtClient.KubedbV1alpha1().MySQLs(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !cloneAllowed(source, mysql.Namespace) {
+		return fmt.Errorf("MySQL %v/%v does not allow namespace %v in annotation %q", source.Namespace, source.Name, mysql.Namespace, cloneNamespacesAnnotation)
+	}
+	if source.Status.Phase != api.DatabasePhaseRunning {
+		return fmt.Errorf("MySQL %v/%v is not running", source.Namespace, source.Name)
+	}
+
+	myVersion, err := c.ExtClient.CatalogV1alpha1().MySQLVersions().Get(string(mysql.Spec.Version), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	sourceVersion, err := c.ExtClient.CatalogV1alpha1().MySQLVersions().Get(string(source.Spec.Version), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	method, err := cloneMethod(mysql, myVersion, sourceVersion)
+	if err != nil {
+		return err
+	}
+	ordinal, err := c.cloneTarget(mysql, source)
+	if err != nil {
+		return err
+	}
+	if err := c.ensureCloneUser(mysql, source, ordinal, method); err != nil {
+		return fmt.Errorf("failed to create clone user on MySQL %v/%v. Reason: %v", source.Namespace, source.Name, err)
+	}
+
+	// the Job is left by an earlier attempt whose status update failed
+	if _, err := c.createCloneJob(mysql, source, ordinal, method, myVersion); err != nil && !kerr.IsAlreadyExists(err) {
+		return err
+	} else if err == nil {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			eventer.EventReasonInitializing,
+			`Initializing by copying MySQL "%v/%v" with method %v`,
+			source.Namespace,
+			source.Name,
+			method,
+		)
+	}
+
+	now := metav1.Now()
+	if err := c.updateCloneStatus(mysql, &api.MySQLCloneStatus{
+		Source:    fmt.Sprintf("%s/%s-%d", source.Namespace, source.OffshootName(), ordinal),
+		Method:    method,
+		Phase:     api.MySQLClonePhaseRunning,
+		StartTime: &now,
+	}); err != nil {
+		return err
+	}
+	return c.startInitJob(mysql, c.cloneQueue, clonePollInterval)
+}
+
+// cloneTarget returns the ordinal of the server of source that the data is copied from, by
+// spec.init.mysqlClone.target. A standalone server is always copied from.
+func (c *Controller) cloneTarget(mysql, source *api.MySQL) (int, error) {
+	if !source.HasMemberRoles() {
+		return 0, nil
+	}
+	target := mysql.Spec.Init.MySQLClone.Target
+	if target == nil {
+		target = &api.BackupTargetSpec{}
+	}
+	candidates, err := c.backupCandidates(source)
+	if err != nil {
+		return 0, err
+	}
+	ordinal, fallback, err := selectBackupTarget(target, candidates)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select server of MySQL %v/%v to copy. Reason: %v", source.Namespace, source.Name, err)
+	}
+	if fallback != "" {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeWarning,
+			EventReasonBackupTargetFallback,
+			`MySQL "%v/%v" is copied from the primary "%v", as %v`,
+			source.Namespace,
+			source.Name,
+			source.PeerName(ordinal),
+			fallback,
+		)
+	}
+	return ordinal, nil
+}
+
+// cloneUserName is the user that the clone Job reads the source with. It is unique to mysql, so that
+// MySQLs copying the same source don't share it.
+func cloneUserName(mysql *api.MySQL) string {
+	return fmt.Sprintf("kubedb_clone_%.8s", strings.Replace(string(mysql.UID), "-", "", -1))
+}
+
+// clonePrivileges returns the privileges that the clone user needs with method: mysqldump reads the
+// tables, views, triggers and events, the clone plugin copies the data directory, and the clone Job
+// reads the outcome of the copy from the new MySQL, which the user is copied to with the data.
+func clonePrivileges(method api.MySQLCloneMethod) []string {
+	if method == api.MySQLCloneMethodClonePlugin {
+		return []string{
+			"BACKUP_ADMIN ON *.*",
+			"SELECT ON performance_schema.clone_status",
+		}
+	}
+	return []string{"SELECT, SHOW VIEW, TRIGGER, EVENT ON *.*"}
+}
+
+// ensureCloneUser creates the clone user on the writable servers of source, with the password in the
+// clone source Secret. For the clone plugin, the plugin is installed there, as its status table is
+// granted on, and on the server that is copied, which needs privileges that the clone user doesn't
+// have. It fails until the user is replicated to the server that is copied.
+func (c *Controller) ensureCloneUser(mysql, source *api.MySQL, ordinal int, method api.MySQLCloneMethod) error {
+	password, err := c.ensureCloneSourceSecret(mysql)
+	if err != nil {
+		return err
+	}
+	hosts, err := c.writableHosts(source)
+	if err != nil {
+		return err
+	}
+	account := quoteString(cloneUserName(mysql)) + "@'%'"
+	for _, host := range hosts {
+		stmts := []string{
+			fmt.Sprintf("CREATE USER IF NOT EXISTS %s IDENTIFIED BY %s", account, quoteString(password)),
+			fmt.Sprintf("ALTER USER %s IDENTIFIED BY %s", account, quoteString(password)),
+		}
+		if method == api.MySQLCloneMethodClonePlugin {
+			if err := c.ensureClonePlugin(source, host); err != nil {
+				return err
+			}
+		}
+		for _, privileges := range clonePrivileges(method) {
+			stmts = append(stmts, fmt.Sprintf("GRANT %s TO %s", privileges, account))
+		}
+		if err := c.execOnHost(source, host, stmts...); err != nil {
+			return err
+		}
+	}
+
+	host := source.PeerName(ordinal)
+	if method == api.MySQLCloneMethodClonePlugin {
+		if err := c.ensureClonePlugin(source, host); err != nil {
+			return err
+		}
+	}
+	en, err := c.newMemberClient(source, host)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+	rows, err := en.QueryString("SELECT COUNT(*) AS count FROM mysql.user WHERE user = ?", cloneUserName(mysql))
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 || rows[0]["count"] == "0" {
+		return fmt.Errorf("clone user is not yet replicated to %v", host)
+	}
+	return nil
+}
+
+// ensureClonePlugin installs the clone plugin on the server of mysql at host, unless it is installed.
+func (c *Controller) ensureClonePlugin(mysql *api.MySQL, host string) error {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+	rows, err := en.QueryString("SELECT COUNT(*) AS count FROM information_schema.PLUGINS WHERE PLUGIN_NAME = 'clone'")
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 && rows[0]["count"] != "0" {
+		return nil
+	}
+	_, err = en.Exec("INSTALL PLUGIN clone SONAME 'mysql_clone.so'")
+	return err
+}
+
+// dropCloneUser drops the clone user from the writable servers of the source. Nothing is done if the
+// source is gone.
+func (c *Controller) dropCloneUser(mysql *api.MySQL) error {
+	namespace, name := cloneSourceMeta(mysql)
+	source, err := c.ExtClient.KubedbV1alpha1().MySQLs(namespace).Get(name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	hosts, err := c.writableHosts(source)
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		if err := c.execOnHost(source, host, "DROP USER IF EXISTS "+quoteString(cloneUserName(mysql))+"@'%'"); err != nil {
+			return fmt.Errorf("failed to drop clone user on %v. Reason: %v", host, err)
+		}
+	}
+	return nil
+}
+
+// ensureCloneSourceSecret returns the password of the clone user, from a Secret in the namespace of
+// mysql that the clone Job reads. The password is generated once, so that retries keep it. The Secret
+// is deleted once the copy completes.
+func (c *Controller) ensureCloneSourceSecret(mysql *api.MySQL) (string, error) {
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(cloneSourceSecretName(mysql), metav1.GetOptions{})
+	if err == nil {
+		if password, ok := secret.Data[KeyMySQLPassword]; ok {
+			return string(password), nil
+		}
+	} else if !kerr.IsNotFound(err) {
+		return "", err
+	}
+
+	password := generatePassword()
+	ref, err := reference.GetReference(clientsetscheme.Scheme, mysql)
+	if err != nil {
+		return "", err
+	}
+	_, _, err = core_util.CreateOrPatchSecret(c.Client, metav1.ObjectMeta{Name: cloneSourceSecretName(mysql), Namespace: mysql.Namespace}, func(in *core.Secret) *core.Secret {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
+		in.Labels = mysql.OffshootLabels()
+		in.Data = map[string][]byte{
+			KeyMySQLUser:     []byte(cloneUserName(mysql)),
+			KeyMySQLPassword: []byte(password),
+		}
+		return in
+	})
+	return password, err
+}
+
+// restoreClonedCredentials resets the password of the user of mysql, after the clone plugin replaced
+// the users of mysql with those of the source. The root credentials of the source are used, as the
+// clone user has no privileges to alter users. The copy of the clone user is dropped.
+func (c *Controller) restoreClonedCredentials(mysql *api.MySQL) error {
+	host := mysql.PeerName(0)
+	user, password, err := c.getRootCredentials(mysql)
+	if err != nil {
+		return err
+	}
+	if c.checkCredentials(mysql, host, user, password) != nil {
+		namespace, name := cloneSourceMeta(mysql)
+		source, err := c.ExtClient.KubedbV1alpha1().MySQLs(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		sourceUser, sourcePassword, err := c.getRootCredentials(source)
+		if err != nil {
+			return err
+		}
+		en, err := c.newMemberClientWithCredentials(mysql, host, sourceUser, sourcePassword)
+		if err != nil {
+			return err
+		}
+		defer en.Close()
+		rows, err := en.QueryString("SELECT host FROM mysql.user WHERE user = ?", user)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if _, err := en.Exec(fmt.Sprintf("ALTER USER %s@%s IDENTIFIED BY %s", quoteString(user), quoteString(row["host"]), quoteString(password))); err != nil {
+				return err
+			}
+		}
+	}
+	return c.execOnHost(mysql, host, "DROP USER IF EXISTS "+quoteString(cloneUserName(mysql))+"@'%'")
+}
+
+func (c *Controller) createCloneJob(mysql, source *api.MySQL, ordinal int, method api.MySQLCloneMethod, mysqlVersion *catalog.MySQLVersion) (*batch.Job, error) {
+	// The Job is not labelled with the kind of the database, so that it is completed as an initJob
+	// rather than by the job controller of the Snapshots, which deletes it as soon as it is done.
+	jobLabel := map[string]string{
+		api.LabelDatabaseName: mysql.Name,
+		api.AnnotationJobType: opClone,
+	}
+
+	// the Dump method inserts into the primary, the clone plugin replaces the data directory of the only server
+	host := mysql.ServiceName()
+	toolsMethod := cloneMethodDump
+	if method == api.MySQLCloneMethodClonePlugin {
+		host = mysql.PeerName(0)
+		toolsMethod = cloneMethodClonePlugin
+	}
+	scratchVolume := snapshotScratchVolume()
+	secretEnv := func(name, secretName, key string) core.EnvVar {
+		return core.EnvVar{
+			Name: name,
+			ValueFrom: &core.EnvVarSource{
+				SecretKeyRef: &core.SecretKeySelector{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: secretName,
+					},
+					Key: key,
+				},
+			},
+		}
+	}
+
+	job := &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   cloneJobName(mysql),
+			Labels: jobLabel,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: api.SchemeGroupVersion.String(),
+					Kind:       api.ResourceKindMySQL,
+					Name:       mysql.Name,
+					UID:        mysql.UID,
+				},
+			},
+		},
+		Spec: batch.JobSpec{
+			// not retried, see initJob
+			BackoffLimit: types.Int32P(0),
+			Template: core.PodTemplateSpec{
+				Spec: core.PodSpec{
+					Containers: []core.Container{
+						{
+							Name:  opClone,
+							Image: mysqlVersion.Spec.Tools.Image,
+							Args: []string{
+								opClone,
+								fmt.Sprintf(`--host=%s`, host),
+								fmt.Sprintf(`--source-host=%s`, source.PeerName(ordinal)),
+								fmt.Sprintf(`--clone-method=%s`, toolsMethod),
+								fmt.Sprintf(`--data-dir=%s`, snapshotDumpDir),
+								fmt.Sprintf(`--enable-analytics=%v`, c.EnableAnalytics),
+							},
+							Env: []core.EnvVar{
+								{
+									Name:  analytics.Key,
+									Value: c.AnalyticsClientID,
+								},
+								secretEnv("DB_USER", mysql.Spec.DatabaseSecret.SecretName, KeyMySQLUser),
+								secretEnv("DB_PASSWORD", mysql.Spec.DatabaseSecret.SecretName, KeyMySQLPassword),
+								secretEnv("DB_SOURCE_USER", cloneSourceSecretName(mysql), KeyMySQLUser),
+								secretEnv("DB_SOURCE_PASSWORD", cloneSourceSecretName(mysql), KeyMySQLPassword),
+							},
+							VolumeMounts: []core.VolumeMount{
+								{
+									Name:      scratchVolume.Name,
+									MountPath: snapshotDumpDir,
+								},
+							},
+						},
+					},
+					Volumes:          []core.Volume{scratchVolume},
+					RestartPolicy:    core.RestartPolicyNever,
+					ImagePullSecrets: mysql.Spec.PodTemplate.Spec.ImagePullSecrets,
+				},
+			},
+		},
+	}
+
+	if c.EnableRBAC {
+		job.Spec.Template.Spec.ServiceAccountName = mysql.SnapshotSAName()
+		if err := c.ensureSnapshotRBAC(mysql); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.Client.BatchV1().Jobs(mysql.Namespace).Create(job)
+}
+
+// cloneJob is the initJob that copies spec.init.mysqlClone.
+type cloneJob struct {
+	c *Controller
+}
+
+func (j cloneJob) running(mysql *api.MySQL) (string, bool) {
+	st := mysql.Status.Clone
+	return cloneJobName(mysql), st != nil && st.Phase == api.MySQLClonePhaseRunning
+}
+
+// poll updates the progress of the copy. It is best effort, eg, the new MySQL is unreachable while
+// it restarts after a clone.
+func (j cloneJob) poll(mysql *api.MySQL, job *batch.Job) (string, error) {
+	st := mysql.Status.Clone.DeepCopy()
+	if err := j.c.cloneProgress(mysql, st); err != nil {
+		log.Debugf("failed to read progress of copying to MySQL %s/%s. Reason: %v", mysql.Namespace, mysql.Name, err)
+		return "", nil
+	}
+	if !reflect.DeepEqual(st, mysql.Status.Clone) {
+		return "", j.c.updateCloneStatus(mysql, st)
+	}
+	return "", nil
+}
+
+// finish drops the clone user from the source, after restoring the credentials that the clone plugin
+// replaced. The clone user is left on the source if a failed copy can't drop it, as the MySQL is
+// failed regardless.
+func (j cloneJob) finish(mysql *api.MySQL, succeeded bool) error {
+	if !succeeded {
+		if err := j.c.dropCloneUser(mysql); err != nil {
+			j.c.recorder.Eventf(
+				mysql,
+				core.EventTypeWarning,
+				eventer.EventReasonFailedToInitialize,
+				"Failed to drop user %q from the source. Reason: %v",
+				cloneUserName(mysql),
+				err,
+			)
+		}
+		return nil
+	}
+	if mysql.Status.Clone.Method == api.MySQLCloneMethodClonePlugin {
+		if err := j.c.restoreClonedCredentials(mysql); err != nil {
+			return fmt.Errorf("failed to restore credentials of MySQL %v/%v after clone. Reason: %v", mysql.Namespace, mysql.Name, err)
+		}
+	}
+	return j.c.dropCloneUser(mysql)
+}
+
+func (j cloneJob) succeeded(mysql *api.MySQL, now metav1.Time) error {
+	st := mysql.Status.Clone.DeepCopy()
+	st.Phase = api.MySQLClonePhaseSucceeded
+	st.Stage = ""
+	st.CompletionTime = &now
+	if st.EstimatedBytes != nil {
+		st.CopiedBytes = types.Int64P(*st.EstimatedBytes)
+	}
+	return j.c.updateCloneStatus(mysql, st)
+}
+
+func (j cloneJob) failed(mysql *api.MySQL, cause error, now metav1.Time) error {
+	st := mysql.Status.Clone.DeepCopy()
+	if st == nil {
+		st = &api.MySQLCloneStatus{}
+	}
+	st.Phase = api.MySQLClonePhaseFailed
+	st.CompletionTime = &now
+	st.Reason = cause.Error()
+	return j.c.updateCloneStatus(mysql, st)
+}
+
+// cleanup deletes the clone Job, and the Secret with the credentials of the clone user.
+func (j cloneJob) cleanup(mysql *api.MySQL) error {
+	deletePolicy := metav1.DeletePropagationBackground
+	err := j.c.Client.BatchV1().Jobs(mysql.Namespace).Delete(cloneJobName(mysql), &metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	})
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	err = j.c.Client.CoreV1().Secrets(mysql.Namespace).Delete(cloneSourceSecretName(mysql), &metav1.DeleteOptions{})
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// cloneProgress sets the stage and the copied bytes of the copy in st. The clone plugin reports them in
+// performance_schema.clone_progress of the new MySQL. With Dump, they are estimated from the size of
+// the tables of both MySQLs.
+func (c *Controller) cloneProgress(mysql *api.MySQL, st *api.MySQLCloneStatus) error {
+	if st.Method == api.MySQLCloneMethodClonePlugin {
+		en, err := c.newMemberClient(mysql, mysql.PeerName(0))
+		if err != nil {
+			return err
+		}
+		defer en.Close()
+		rows, err := en.QueryString("SELECT STAGE AS stage, STATE AS state, ESTIMATE AS estimate, DATA AS data FROM performance_schema.clone_progress")
+		if err != nil {
+			return err
+		}
+		var copied, estimated int64
+		for _, row := range rows {
+			if row["state"] == "In Progress" {
+				st.Stage = row["stage"]
+			}
+			data, _ := strconv.ParseInt(row["data"], 10, 64)
+			estimate, _ := strconv.ParseInt(row["estimate"], 10, 64)
+			copied += data
+			estimated += estimate
+		}
+		st.CopiedBytes = types.Int64P(copied)
+		st.EstimatedBytes = types.Int64P(estimated)
+		return nil
+	}
+
+	namespace, name := cloneSourceMeta(mysql)
+	source, err := c.ExtClient.KubedbV1alpha1().MySQLs(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	// the server is recorded as "<namespace>/<pod>"
+	estimated, err := c.userDataSize(source, memberHost(source, st.Source[strings.Index(st.Source, "/")+1:]))
+	if err != nil {
+		return err
+	}
+	copied, err := c.userDataSize(mysql, mysql.PeerName(0))
+	if err != nil {
+		return err
+	}
+	// the sizes are estimated by the storage engine
+	if copied > estimated {
+		copied = estimated
+	}
+	st.CopiedBytes = types.Int64P(copied)
+	st.EstimatedBytes = types.Int64P(estimated)
+	return nil
+}
+
+// userDataSize returns the size of the tables of the user databases of the server at host, as estimated
+// by the storage engine.
+func (c *Controller) userDataSize(mysql *api.MySQL, host string) (int64, error) {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return 0, err
+	}
+	defer en.Close()
+
+	// the statistics in information_schema are cached by MySQL 8.0, unless the expiry is disabled.
+	// The session variable is unknown to 5.7, which does not cache them.
+	session := en.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+	defer session.Rollback()
+	if _, err := session.Exec("SET SESSION information_schema_stats_expiry = 0"); err != nil {
+		log.Debugf("failed to disable statistics cache of %v. Reason: %v", host, err)
+	}
+	return queryUserDataSize(session)
+}
+
+func queryUserDataSize(session *xorm.Session) (int64, error) {
+	excluded := make([]string, 0, len(systemDatabases))
+	for _, db := range systemDatabases {
+		excluded = append(excluded, quoteString(db))
+	}
+	rows, err := session.QueryString(fmt.Sprintf(
+		"SELECT COALESCE(SUM(DATA_LENGTH + INDEX_LENGTH), 0) AS size FROM information_schema.TABLES WHERE TABLE_SCHEMA NOT IN (%s)",
+		strings.Join(excluded, ", "),
+	))
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(rows[0]["size"], 10, 64)
+}
+
+func (c *Controller) updateCloneStatus(mysql *api.MySQL, st *api.MySQLCloneStatus) error {
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		in.Clone = st
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+	return nil
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/appscode/go/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	catalog "kubedb.dev/apimachinery/apis/catalog/v1alpha1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestCloneAllowed(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		namespace   string
+		allowed     bool
+	}{
+		{name: "same namespace", namespace: "demo", allowed: true},
+		{name: "other namespace", namespace: "staging"},
+		{name: "listed namespace", annotations: map[string]string{cloneNamespacesAnnotation: "dev, staging"}, namespace: "staging", allowed: true},
+		{name: "unlisted namespace", annotations: map[string]string{cloneNamespacesAnnotation: "dev"}, namespace: "staging"},
+		{name: "any namespace", annotations: map[string]string{cloneNamespacesAnnotation: "*"}, namespace: "staging", allowed: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			source := &api.MySQL{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Annotations: c.annotations}}
+			if allowed := cloneAllowed(source, c.namespace); allowed != c.allowed {
+				t.Errorf("expected %v, got %v", c.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestCloneMethod(t *testing.T) {
+	version := func(v string, plugin bool) *catalog.MySQLVersion {
+		return &catalog.MySQLVersion{Spec: catalog.MySQLVersionSpec{Version: v, ClonePlugin: plugin}}
+	}
+	cases := []struct {
+		name          string
+		method        api.MySQLCloneMethod
+		replicas      int32
+		myVersion     *catalog.MySQLVersion
+		sourceVersion *catalog.MySQLVersion
+		expected      api.MySQLCloneMethod
+		err           bool
+	}{
+		{name: "plugin by default", replicas: 1, myVersion: version("8.0.17", true), sourceVersion: version("8.0.17", true), expected: api.MySQLCloneMethodClonePlugin},
+		{name: "dump without plugin", replicas: 1, myVersion: version("8.0.14", false), sourceVersion: version("8.0.14", false), expected: api.MySQLCloneMethodDump},
+		{name: "dump across versions", replicas: 1, myVersion: version("8.0.18", true), sourceVersion: version("8.0.17", true), expected: api.MySQLCloneMethodDump},
+		{name: "dump into group", replicas: 3, myVersion: version("8.0.17", true), sourceVersion: version("8.0.17", true), expected: api.MySQLCloneMethodDump},
+		{name: "explicit dump", method: api.MySQLCloneMethodDump, replicas: 1, myVersion: version("8.0.17", true), sourceVersion: version("8.0.17", true), expected: api.MySQLCloneMethodDump},
+		{name: "explicit plugin", method: api.MySQLCloneMethodClonePlugin, replicas: 1, myVersion: version("8.0.17", true), sourceVersion: version("8.0.17", true), expected: api.MySQLCloneMethodClonePlugin},
+		{name: "unsupported plugin", method: api.MySQLCloneMethodClonePlugin, replicas: 1, myVersion: version("5.7.25", false), sourceVersion: version("8.0.17", true), err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mysql := &api.MySQL{Spec: api.MySQLSpec{
+				Replicas: types.Int32P(c.replicas),
+				Init: &api.InitSpec{
+					MySQLClone: &api.MySQLCloneSourceSpec{Name: "source", Method: c.method},
+				},
+			}}
+			method, err := cloneMethod(mysql, c.myVersion, c.sourceVersion)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected error, got method %v", method)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if method != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, method)
+			}
+		})
+	}
+}
+
+func TestCloneUserName(t *testing.T) {
+	mysql := &api.MySQL{ObjectMeta: metav1.ObjectMeta{UID: "5f9a1c2e-0b1d-4c3a-9e8f-7a6b5c4d3e2f"}}
+	if name := cloneUserName(mysql); name != "kubedb_clone_5f9a1c2e" {
+		t.Errorf("expected kubedb_clone_5f9a1c2e, got %v", name)
+	}
+	// MySQL limits user names to 32 characters
+	if name := cloneUserName(mysql); len(name) > 32 {
+		t.Errorf("user name %v is longer than 32 characters", name)
+	}
+}
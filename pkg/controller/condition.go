@@ -0,0 +1,103 @@
+package controller
+
+import (
+	core "k8s.io/api/core/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+)
+
+const (
+	ConditionReasonPending         = "Pending"
+	ConditionReasonReady           = "Ready"
+	ConditionReasonFailed          = "Failed"
+	ConditionReasonNotConfigured   = "NotConfigured"
+	ConditionReasonInitializing    = "Initializing"
+	ConditionReasonProvisioning    = "Provisioning"
+	ConditionReasonSourceUnhealthy = "SourceUnhealthy"
+	ConditionReasonHalted          = "Halted"
+)
+
+// conditionTypes lists every condition reported in MySQL status, in the order the
+// operator works through them during a reconcile.
+var conditionTypes = []api.MySQLConditionType{
+	api.MySQLConditionServiceReady,
+	api.MySQLConditionDatabaseSecretReady,
+	api.MySQLConditionStatefulSetReady,
+	api.MySQLConditionAllReplicasReady,
+	api.MySQLConditionReplicationHealthy,
+	api.MySQLConditionGroupMembersOnline,
+	api.MySQLConditionPodsUpdated,
+	api.MySQLConditionAppBindingReady,
+	api.MySQLConditionInitialized,
+	api.MySQLConditionBackupScheduled,
+	api.MySQLConditionMonitoringReady,
+}
+
+// conditionSet collects the conditions observed during a single reconcile.
+// Every condition starts as Unknown, so a step that is never reached in this
+// pass does not keep reporting the result of an older pass.
+type conditionSet struct {
+	conditions []api.MySQLCondition
+	removed    map[api.MySQLConditionType]bool
+}
+
+func newConditionSet() *conditionSet {
+	cs := &conditionSet{
+		removed: map[api.MySQLConditionType]bool{},
+	}
+	for _, t := range conditionTypes {
+		cs.set(t, core.ConditionUnknown, ConditionReasonPending, "waiting for the previous steps to complete")
+	}
+	return cs
+}
+
+func (cs *conditionSet) set(t api.MySQLConditionType, status core.ConditionStatus, reason, message string) {
+	delete(cs.removed, t)
+	for i := range cs.conditions {
+		if cs.conditions[i].Type == t {
+			cs.conditions[i].Status = status
+			cs.conditions[i].Reason = reason
+			cs.conditions[i].Message = message
+			return
+		}
+	}
+	cs.conditions = append(cs.conditions, api.MySQLCondition{
+		Type:    t,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+func (cs *conditionSet) ready(t api.MySQLConditionType, message string) {
+	cs.set(t, core.ConditionTrue, ConditionReasonReady, message)
+}
+
+func (cs *conditionSet) failed(t api.MySQLConditionType, err error) {
+	cs.set(t, core.ConditionFalse, ConditionReasonFailed, err.Error())
+}
+
+// remove drops a condition that does not apply to the current spec (ie, monitoring is not configured).
+func (cs *conditionSet) remove(t api.MySQLConditionType) {
+	cs.removed[t] = true
+}
+
+// updateConditions merges the observed conditions into MySQL status. LastTransitionTime
+// is preserved for conditions whose status did not change.
+func (c *Controller) updateConditions(mysql *api.MySQL, cs *conditionSet) error {
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		for _, cond := range cs.conditions {
+			if cs.removed[cond.Type] {
+				in.RemoveCondition(cond.Type)
+			} else {
+				in.SetCondition(cond)
+			}
+		}
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+	return nil
+}
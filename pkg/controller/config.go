@@ -3,7 +3,6 @@ package controller
 import (
 	pcm "github.com/coreos/prometheus-operator/pkg/client/versioned/typed/monitoring/v1"
 	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -65,9 +64,7 @@ func (c *OperatorConfig) New() (*Controller, error) {
 		recorder,
 	)
 
-	tweakListOptions := func(options *metav1.ListOptions) {
-		options.LabelSelector = ctrl.selector.String()
-	}
+	tweakListOptions := ctrl.tweakListOptions
 
 	// Initialize Job and Snapshot Informer. Later EventHandler will be added to these informers.
 	ctrl.DrmnInformer = dormantdatabase.NewController(ctrl.Controller, ctrl, ctrl.Config, tweakListOptions, recorder).InitInformer()
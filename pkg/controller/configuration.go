@@ -0,0 +1,502 @@
+package controller
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/reference"
+	core_util "kmodules.xyz/client-go/core/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+)
+
+const (
+	EventReasonConfigurationApplied = "ConfigurationApplied"
+	EventReasonRestartRequired      = "RestartRequired"
+
+	// annotation on the pod template with the hash of the configuration that the servers were last restarted for
+	configHashAnnotation = api.MySQLKey + "/config-hash"
+	// file in the ConfigMap that spec.config is rendered into
+	configFileName = "mysqld.cnf"
+
+	// ref: https://dev.mysql.com/doc/refman/5.7/en/server-error-reference.html#error_er_unknown_system_variable
+	errUnknownSystemVariable = 1193
+)
+
+var (
+	// system variables are set by name in SET GLOBAL, so the name must not contain anything else
+	variableNameRe = regexp.MustCompile(`^[a-z0-9_]+(\.[a-z0-9_]+)?$`)
+	// option values with a size suffix, that is only understood in option files
+	// ref: https://dev.mysql.com/doc/refman/5.7/en/program-variables.html
+	sizeValueRe = regexp.MustCompile(`^([0-9]+)([kmgKMG])$`)
+)
+
+// configVolumeSource returns the source of the configuration files that are mounted at /etc/mysql/conf.d,
+// ie, spec.configSource, or the ConfigMap that spec.config is rendered into.
+func configVolumeSource(mysql *api.MySQL) *core.VolumeSource {
+	if len(mysql.Spec.Config) == 0 {
+		return mysql.Spec.ConfigSource
+	}
+	return &core.VolumeSource{
+		ConfigMap: &core.ConfigMapVolumeSource{
+			LocalObjectReference: core.LocalObjectReference{
+				Name: mysql.ConfigMapName(),
+			},
+		},
+	}
+}
+
+// ensureConfigMap renders spec.config into a ConfigMap, or deletes the ConfigMap once spec.config is
+// removed. A ConfigMap with the same name that the operator didn't render, eg, one of the user in
+// spec.configSource, is never deleted.
+func (c *Controller) ensureConfigMap(mysql *api.MySQL) error {
+	if len(mysql.Spec.Config) == 0 {
+		if source := mysql.Spec.ConfigSource; source != nil && source.ConfigMap != nil && source.ConfigMap.Name == mysql.ConfigMapName() {
+			return nil
+		}
+		cm, err := c.Client.CoreV1().ConfigMaps(mysql.Namespace).Get(mysql.ConfigMapName(), metav1.GetOptions{})
+		if kerr.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !isRenderedConfigMap(cm, mysql) {
+			return nil
+		}
+		err = c.Client.CoreV1().ConfigMaps(mysql.Namespace).Delete(cm.Name, &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &cm.UID},
+		})
+		if kerr.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	ref, rerr := reference.GetReference(clientsetscheme.Scheme, mysql)
+	if rerr != nil {
+		return rerr
+	}
+	meta := metav1.ObjectMeta{
+		Name:      mysql.ConfigMapName(),
+		Namespace: mysql.Namespace,
+	}
+	_, _, err := core_util.CreateOrPatchConfigMap(c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
+		in.Labels = mysql.OffshootLabels()
+		in.Data = map[string]string{
+			configFileName: renderConfig(mysql.Spec.Config),
+		}
+		return in
+	})
+	return err
+}
+
+// isRenderedConfigMap reports whether cm is the ConfigMap that spec.config of mysql is rendered into,
+// ie, it is owned by mysql and has its offshoot labels.
+func isRenderedConfigMap(cm *core.ConfigMap, mysql *api.MySQL) bool {
+	owned := false
+	for _, ref := range cm.OwnerReferences {
+		if ref.Kind == api.ResourceKindMySQL && ref.UID == mysql.UID {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		return false
+	}
+	for k, v := range mysql.OffshootLabels() {
+		if cm.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// renderConfig renders the options into the [mysqld] group of an option file, sorted by name.
+// ref: https://dev.mysql.com/doc/refman/5.7/en/option-files.html
+func renderConfig(config map[string]string) string {
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf strings.Builder
+	buf.WriteString("# Rendered from spec.config by the operator, do not edit.\n[mysqld]\n")
+	for _, name := range names {
+		value := config[name]
+		switch {
+		case value == "":
+			fmt.Fprintf(&buf, "%s\n", name)
+		case strings.ContainsAny(value, " \t#;'\"\\"):
+			fmt.Fprintf(&buf, "%s = \"%s\"\n", name, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value))
+		default:
+			fmt.Fprintf(&buf, "%s = %s\n", name, value)
+		}
+	}
+	return buf.String()
+}
+
+// getConfigFiles returns the contents of the configuration files mounted at /etc/mysql/conf.d by file name.
+// Only ConfigMap and Secret sources can be read, it returns nil for any other source.
+func (c *Controller) getConfigFiles(mysql *api.MySQL) (map[string]string, error) {
+	source := configVolumeSource(mysql)
+	if source == nil {
+		return nil, nil
+	}
+
+	data := map[string]string{}
+	var items []core.KeyToPath
+	switch {
+	case source.ConfigMap != nil:
+		cm, err := c.Client.CoreV1().ConfigMaps(mysql.Namespace).Get(source.ConfigMap.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range cm.Data {
+			data[k] = v
+		}
+		items = source.ConfigMap.Items
+	case source.Secret != nil:
+		secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(source.Secret.SecretName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range secret.Data {
+			data[k] = string(v)
+		}
+		items = source.Secret.Items
+	default:
+		return nil, nil
+	}
+
+	// only the listed keys are projected into the volume
+	if len(items) == 0 {
+		return data, nil
+	}
+	files := map[string]string{}
+	for _, item := range items {
+		if v, ok := data[item.Key]; ok {
+			files[item.Path] = v
+		}
+	}
+	return files, nil
+}
+
+// configHash returns a hash of the configuration files, that changes whenever any of them changes.
+func configHash(files map[string]string) string {
+	if files == nil {
+		return ""
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\x00", name, files[name])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+// parseServerOptions returns the options that the configuration files set for the server, ie, in the
+// [mysqld] and [server] groups, by system variable name. The files are read in the order of their names,
+// as mysqld reads the files of an included directory, so that a later file overrides an earlier one.
+// ref: https://dev.mysql.com/doc/refman/5.7/en/option-files.html
+func parseServerOptions(files map[string]string) map[string]string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if strings.HasSuffix(name, ".cnf") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	options := map[string]string{}
+	for _, name := range names {
+		server := false
+		scanner := bufio.NewScanner(strings.NewReader(files[name]))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"), strings.HasPrefix(line, "!"):
+				continue
+			case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+				group := strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+				server = group == "mysqld" || group == "server"
+				continue
+			case !server:
+				continue
+			}
+
+			key, value := line, "ON"
+			if i := strings.Index(line, "="); i >= 0 {
+				key = strings.TrimSpace(line[:i])
+				value = strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
+			}
+			key = strings.Replace(strings.ToLower(key), "-", "_", -1)
+			key = strings.TrimPrefix(key, "loose_")
+			options[key] = value
+		}
+	}
+	return options
+}
+
+// changedServerOptions returns the options that are added or changed in options since applied, the
+// options of the configuration that was last applied, and the names of the options that are removed.
+func changedServerOptions(applied, options map[string]string) (changed map[string]string, removed []string) {
+	changed = map[string]string{}
+	for name, value := range options {
+		if prev, ok := applied[name]; !ok || prev != value {
+			changed[name] = value
+		}
+	}
+	for name := range applied {
+		if _, ok := options[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// variableValue returns the value of an option as an expression for SET GLOBAL.
+func variableValue(value string) string {
+	if m := sizeValueRe.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.ParseUint(m[1], 10, 64)
+		switch strings.ToLower(m[2]) {
+		case "k":
+			n <<= 10
+		case "m":
+			n <<= 20
+		case "g":
+			n <<= 30
+		}
+		return strconv.FormatUint(n, 10)
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	switch strings.ToUpper(value) {
+	case "ON", "OFF", "TRUE", "FALSE":
+		return strings.ToUpper(value)
+	}
+	return quoteString(value)
+}
+
+// sameVariableValue reports whether the running value of a system variable, as returned by
+// SELECT @@GLOBAL.<name>, is equal to the value of an option.
+func sameVariableValue(current, value string) bool {
+	if strings.EqualFold(current, value) {
+		return true
+	}
+	expr := variableValue(value)
+	if strings.EqualFold(current, strings.Trim(expr, "'")) {
+		return true
+	}
+	switch strings.ToUpper(expr) {
+	case "ON", "TRUE":
+		return current == "1"
+	case "OFF", "FALSE":
+		return current == "0"
+	}
+	return false
+}
+
+// applyServerOptions sets the options that differ from the running value on the server at host
+// with SET GLOBAL. The options are not persisted with SET PERSIST, as the server reads them from
+// the configuration files when it is restarted. It returns the options that could not be changed
+// at runtime, ie, options that are read-only variables or not system variables at all.
+func (c *Controller) applyServerOptions(mysql *api.MySQL, host string, options map[string]string) (applied, pending []string, err error) {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer en.Close()
+
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := options[name]
+		if !variableNameRe.MatchString(name) {
+			pending = append(pending, name)
+			continue
+		}
+		rows, err := en.QueryString(fmt.Sprintf("SELECT @@GLOBAL.%s AS value", name))
+		if me, ok := err.(*mysqldriver.MySQLError); ok && me.Number == errUnknownSystemVariable {
+			// a startup option, its effect can't be checked
+			pending = append(pending, name)
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if len(rows) > 0 && sameVariableValue(rows[0]["value"], value) {
+			continue
+		}
+		if _, err := en.Exec(fmt.Sprintf("SET GLOBAL %s = %s", name, variableValue(value))); err != nil {
+			log.Infof("option %v of MySQL %v/%v can't be changed on %v at runtime. Reason: %v", name, mysql.Namespace, mysql.Name, host, err)
+			pending = append(pending, name)
+			continue
+		}
+		applied = append(applied, name)
+	}
+	return applied, pending, nil
+}
+
+// initConfiguration records the hash of the configuration that the servers are created with,
+// before the StatefulSet is created.
+func (c *Controller) initConfiguration(mysql *api.MySQL) error {
+	if mysql.Status.Configuration != nil {
+		return nil
+	}
+	files, err := c.getConfigFiles(mysql)
+	if err != nil {
+		return err
+	}
+	hash := configHash(files)
+	options := parseServerOptions(files)
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		in.Configuration = &api.MySQLConfigurationStatus{
+			Hash:        hash,
+			RestartHash: hash,
+			Options:     options,
+		}
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+	return nil
+}
+
+// ensureConfiguration applies changes of the configuration files in spec.configSource to the running
+// servers. Only the options that changed since the configuration was last applied are considered, so
+// that unchanged startup options don't restart the servers. Options that are dynamic are changed with
+// SET GLOBAL. If any option can't be changed at runtime, or is removed, the hash of the configuration
+// is stamped on the pod template, so that the servers are restarted one at a time, and the option is
+// reported in status as pending a restart until then.
+func (c *Controller) ensureConfiguration(mysql *api.MySQL) error {
+	st := mysql.Status.Configuration
+	if st == nil {
+		return nil
+	}
+	files, err := c.getConfigFiles(mysql)
+	if err != nil {
+		return err
+	}
+	hash := configHash(files)
+	if st.Hash == hash {
+		if len(st.PendingRestart) > 0 && c.isRolledOut(mysql, configHashAnnotation, st.RestartHash) {
+			my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+				if in.Configuration != nil && in.Configuration.RestartHash == st.RestartHash {
+					in.Configuration.PendingRestart = nil
+				}
+				return in
+			})
+			if err != nil {
+				return err
+			}
+			mysql.Status = my.Status
+		}
+		return nil
+	}
+
+	options := parseServerOptions(files)
+	changed, removed := changedServerOptions(st.Options, options)
+	// a removed option keeps its running value until the servers are restarted
+	applied, restart := sets.NewString(), sets.NewString(removed...)
+	for i := 0; i < int(types.Int32(mysql.Spec.Replicas)); i++ {
+		a, p, err := c.applyServerOptions(mysql, mysql.PeerName(i), changed)
+		if err != nil {
+			return fmt.Errorf("failed to apply configuration to server %v. Reason: %v", mysql.PeerName(i), err)
+		}
+		applied.Insert(a...)
+		restart.Insert(p...)
+	}
+
+	// the options that are pending a restart that has not happened yet stay pending
+	pending := restart.Union(sets.NewString(st.PendingRestart...))
+	restartHash := st.RestartHash
+	if restart.Len() > 0 {
+		restartHash = hash
+	}
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		in.Configuration = &api.MySQLConfigurationStatus{
+			Hash:           hash,
+			RestartHash:    restartHash,
+			PendingRestart: pending.List(),
+			Options:        options,
+		}
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+
+	if applied.Len() > 0 {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			EventReasonConfigurationApplied,
+			"Applied %s without restart",
+			strings.Join(applied.List(), ", "),
+		)
+	}
+	if restartHash != st.RestartHash {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			EventReasonRestartRequired,
+			"Restarting the servers one at a time to apply %s",
+			strings.Join(restart.List(), ", "),
+		)
+		// the pod template is updated in the next pass
+		c.requeueAfter(mysql, 0)
+	}
+	return nil
+}
+
+// podTemplateAnnotations returns the annotations of the pod template. The configuration hash, the
+// serial number of the server certificate and the time of the latest password rotation are added, so
+// that the pods are restarted when the configuration needs a restart to take effect, when the certificate
+// is renewed, or when the root password is rotated.
+func podTemplateAnnotations(mysql *api.MySQL) map[string]string {
+	annotations := map[string]string{}
+	for k, v := range mysql.Spec.PodTemplate.Annotations {
+		annotations[k] = v
+	}
+	if st := mysql.Status.Configuration; st != nil && st.RestartHash != "" {
+		annotations[configHashAnnotation] = st.RestartHash
+	}
+	if st := mysql.Status.TLS; st != nil && mysql.Spec.TLS != nil {
+		annotations[tlsSerialAnnotation] = st.SerialNumber
+	}
+	if st := mysql.Status.PasswordRotation; st != nil && st.LastRotationTime != nil && passwordReadFromEnv(mysql) {
+		annotations[passwordRotatedAnnotation] = passwordRotatedValue(st)
+	}
+	if len(annotations) == 0 {
+		return mysql.Spec.PodTemplate.Annotations
+	}
+	return annotations
+}
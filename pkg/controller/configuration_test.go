@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	amc "kubedb.dev/apimachinery/pkg/controller"
+)
+
+func TestParseServerOptions(t *testing.T) {
+	files := map[string]string{
+		"my-config.cnf": `
+# comment
+[client]
+port = 3307
+
+[mysqld]
+max_connections = 200
+innodb-buffer-pool-size=1G
+skip-name-resolve
+loose_group_replication_member_weight = 60
+sql_mode = "STRICT_TRANS_TABLES,NO_ZERO_DATE"
+; comment
+!includedir /etc/mysql/extra.d
+`,
+		"other.cnf": `
+[server]
+max_connections = 300
+`,
+		"README": `
+[mysqld]
+ignored = 1
+`,
+	}
+	expected := map[string]string{
+		"max_connections":                 "300",
+		"innodb_buffer_pool_size":         "1G",
+		"skip_name_resolve":               "ON",
+		"group_replication_member_weight": "60",
+		"sql_mode":                        "STRICT_TRANS_TABLES,NO_ZERO_DATE",
+	}
+	if got := parseServerOptions(files); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected options %v, got %v", expected, got)
+	}
+}
+
+func TestChangedServerOptions(t *testing.T) {
+	applied := map[string]string{
+		"max_connections":   "200",
+		"skip_name_resolve": "ON",
+		"sql_mode":          "STRICT_TRANS_TABLES",
+	}
+	options := map[string]string{
+		"max_connections":   "300",
+		"skip_name_resolve": "ON",
+		"wait_timeout":      "600",
+	}
+	changed, removed := changedServerOptions(applied, options)
+	if expected := map[string]string{"max_connections": "300", "wait_timeout": "600"}; !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected changed options %v, got %v", expected, changed)
+	}
+	if expected := []string{"sql_mode"}; !reflect.DeepEqual(removed, expected) {
+		t.Errorf("expected removed options %v, got %v", expected, removed)
+	}
+
+	// all options are changed if none were applied
+	if changed, removed := changedServerOptions(nil, options); !reflect.DeepEqual(changed, options) || len(removed) > 0 {
+		t.Errorf("expected changed options %v, got %v and removed %v", options, changed, removed)
+	}
+}
+
+func TestVariableValue(t *testing.T) {
+	cases := []struct {
+		value string
+		expr  string
+	}{
+		{"200", "200"},
+		{"0.5", "0.5"},
+		{"1G", "1073741824"},
+		{"64M", "67108864"},
+		{"16k", "16384"},
+		{"on", "ON"},
+		{"STRICT_TRANS_TABLES", "'STRICT_TRANS_TABLES'"},
+		{"it's", `'it\'s'`},
+	}
+	for _, c := range cases {
+		if got := variableValue(c.value); got != c.expr {
+			t.Errorf("expected %q for %q, got %q", c.expr, c.value, got)
+		}
+	}
+}
+
+func TestSameVariableValue(t *testing.T) {
+	cases := []struct {
+		current string
+		value   string
+		same    bool
+	}{
+		{"200", "200", true},
+		{"200", "300", false},
+		{"1073741824", "1G", true},
+		{"1", "ON", true},
+		{"0", "ON", false},
+		{"0", "off", true},
+		{"ON", "on", true},
+		{"STRICT_TRANS_TABLES", "strict_trans_tables", true},
+	}
+	for _, c := range cases {
+		if got := sameVariableValue(c.current, c.value); got != c.same {
+			t.Errorf("expected %v for current value %q and option %q, got %v", c.same, c.current, c.value, got)
+		}
+	}
+}
+
+func TestRenderConfig(t *testing.T) {
+	config := map[string]string{
+		"max_connections":   "200",
+		"skip_name_resolve": "",
+		"sql_mode":          "STRICT_TRANS_TABLES, NO_ZERO_DATE",
+	}
+	expected := `# Rendered from spec.config by the operator, do not edit.
+[mysqld]
+max_connections = 200
+skip_name_resolve
+sql_mode = "STRICT_TRANS_TABLES, NO_ZERO_DATE"
+`
+	rendered := renderConfig(config)
+	if rendered != expected {
+		t.Errorf("expected config\n%s\ngot\n%s", expected, rendered)
+	}
+	options := parseServerOptions(map[string]string{configFileName: rendered})
+	if options["sql_mode"] != config["sql_mode"] || options["skip_name_resolve"] != "ON" {
+		t.Errorf("rendered config is parsed as %v", options)
+	}
+}
+
+func TestEnsureConfigMapDeletesRenderedOnly(t *testing.T) {
+	mysql := &api.MySQL{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "ns", UID: "uid"}}
+	rendered := &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:            mysql.ConfigMapName(),
+		Namespace:       "ns",
+		Labels:          mysql.OffshootLabels(),
+		OwnerReferences: []metav1.OwnerReference{{Kind: api.ResourceKindMySQL, Name: "demo", UID: "uid"}},
+	}}
+	users := rendered.DeepCopy()
+	users.OwnerReferences = nil
+
+	cases := []struct {
+		name    string
+		cm      *core.ConfigMap
+		source  *core.VolumeSource
+		deleted bool
+	}{
+		{name: "rendered", cm: rendered, deleted: true},
+		{name: "of the user", cm: users},
+		{
+			name: "in spec.configSource",
+			cm:   rendered,
+			source: &core.VolumeSource{ConfigMap: &core.ConfigMapVolumeSource{
+				LocalObjectReference: core.LocalObjectReference{Name: mysql.ConfigMapName()},
+			}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Controller{Controller: &amc.Controller{Client: fake.NewSimpleClientset(tc.cm)}}
+			my := mysql.DeepCopy()
+			my.Spec.ConfigSource = tc.source
+			if err := c.ensureConfigMap(my); err != nil {
+				t.Fatal(err)
+			}
+			_, err := c.Client.CoreV1().ConfigMaps("ns").Get(mysql.ConfigMapName(), metav1.GetOptions{})
+			if deleted := kerr.IsNotFound(err); deleted != tc.deleted {
+				t.Errorf("expected deleted %v, got %v (%v)", tc.deleted, deleted, err)
+			}
+		})
+	}
+}
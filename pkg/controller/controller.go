@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"sync"
+
 	"github.com/appscode/go/encoding/json/types"
 	"github.com/appscode/go/log"
 	pcm "github.com/coreos/prometheus-operator/pkg/client/versioned/typed/monitoring/v1"
@@ -11,6 +13,8 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	apps_listers "k8s.io/client-go/listers/apps/v1"
+	core_listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
@@ -50,6 +54,42 @@ type Controller struct {
 	myQueue    *queue.Worker
 	myInformer cache.SharedIndexInformer
 	myLister   api_listers.MySQLLister
+
+	// StatefulSet and Pod watchers to observe readiness of database replicas
+	stsInformer cache.SharedIndexInformer
+	stsLister   apps_listers.StatefulSetLister
+	podInformer cache.SharedIndexInformer
+	podLister   core_listers.PodLister
+
+	// ConfigMap watcher to apply changes of spec.configSource
+	cmInformer cache.SharedIndexInformer
+
+	// MySQLDatabase
+	mydbQueue    *queue.Worker
+	mydbInformer cache.SharedIndexInformer
+	mydbLister   api_listers.MySQLDatabaseLister
+
+	// MySQLUser
+	myuserQueue    *queue.Worker
+	myuserInformer cache.SharedIndexInformer
+	myuserLister   api_listers.MySQLUserLister
+
+	// Snapshot verification
+	verifyQueue *queue.Worker
+
+	// Backup retention
+	retentionQueue *queue.Worker
+
+	// Progress of spec.init.mysqlClone
+	cloneQueue *queue.Worker
+
+	// Progress of the Jobs that restore spec.init.snapshotSource
+	restoreQueue *queue.Worker
+
+	// Offshoots that were deleted out of band, by the key of their MySQL. They are reported
+	// once the MySQL is reconciled.
+	deletedOffshoots   map[string][]offshootRef
+	deletedOffshootsMu sync.Mutex
 }
 
 var _ amc.Snapshotter = &Controller{}
@@ -96,6 +136,8 @@ func (c *Controller) EnsureCustomResourceDefinitions() error {
 		catalog.MySQLVersion{}.CustomResourceDefinition(),
 		api.DormantDatabase{}.CustomResourceDefinition(),
 		api.Snapshot{}.CustomResourceDefinition(),
+		api.MySQLDatabase{}.CustomResourceDefinition(),
+		api.MySQLUser{}.CustomResourceDefinition(),
 		appcat.AppBinding{}.CustomResourceDefinition(),
 	}
 	return apiext_util.RegisterCRDs(c.ApiExtKubeClient, crds)
@@ -103,10 +145,16 @@ func (c *Controller) EnsureCustomResourceDefinitions() error {
 
 // Init initializes mysql, DormantDB amd Snapshot watcher
 func (c *Controller) Init() error {
-	c.initWatcher()
+	if err := c.initWatcher(); err != nil {
+		return err
+	}
 	c.DrmnQueue = drmnc.NewController(c.Controller, c, c.Config, nil, c.recorder).AddEventHandlerFunc(c.selector)
 	c.SnapQueue, c.JobQueue = snapc.NewController(c.Controller, c, c.Config, nil, c.recorder).AddEventHandlerFunc(c.selector)
 	c.RSQueue = restoresession.NewController(c.Controller, c, c.Config, nil, c.recorder).AddEventHandlerFunc(c.selector)
+	c.initSnapshotVerificationWatcher()
+	c.initBackupRetentionWatcher()
+	c.initMySQLCloneWatcher()
+	c.initMySQLRestoreWatcher()
 
 	return nil
 }
@@ -118,9 +166,15 @@ func (c *Controller) RunControllers(stopCh <-chan struct{}) {
 
 	// Watch x  TPR objects
 	c.myQueue.Run(stopCh)
+	c.mydbQueue.Run(stopCh)
+	c.myuserQueue.Run(stopCh)
 	c.DrmnQueue.Run(stopCh)
 	c.SnapQueue.Run(stopCh)
 	c.JobQueue.Run(stopCh)
+	c.verifyQueue.Run(stopCh)
+	c.retentionQueue.Run(stopCh)
+	c.cloneQueue.Run(stopCh)
+	c.restoreQueue.Run(stopCh)
 }
 
 // Blocks caller. Intended to be called as a Go routine.
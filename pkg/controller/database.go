@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	core_util "kmodules.xyz/client-go/core/v1"
+	"kmodules.xyz/client-go/tools/queue"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+	"kubedb.dev/apimachinery/pkg/eventer"
+)
+
+const (
+	// maximum length of database names in MySQL
+	maxDatabaseNameLength = 64
+)
+
+var (
+	// databases of the server itself, which can't be managed by a MySQLDatabase
+	systemDatabases = []string{"mysql", "sys", "information_schema", "performance_schema"}
+
+	charsetNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+func (c *Controller) initMySQLDatabaseWatcher() {
+	c.mydbInformer = c.KubedbInformerFactory.Kubedb().V1alpha1().MySQLDatabases().Informer()
+	c.mydbQueue = queue.New(api.ResourceKindMySQLDatabase, c.MaxNumRequeues, c.NumThreads, c.runMySQLDatabase)
+	c.mydbLister = c.KubedbInformerFactory.Kubedb().V1alpha1().MySQLDatabases().Lister()
+	c.mydbInformer.AddEventHandler(queue.NewObservableUpdateHandler(c.mydbQueue.GetQueue(), true))
+}
+
+func (c *Controller) runMySQLDatabase(key string) error {
+	log.Debugln("started processing, key:", key)
+	obj, exists, err := c.mydbInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		log.Errorf("Fetching object with key %s from store failed with %v", key, err)
+		return err
+	}
+
+	if !exists {
+		log.Debugf("MySQLDatabase %s does not exist anymore", key)
+		return nil
+	}
+
+	db := obj.(*api.MySQLDatabase).DeepCopy()
+	if db.DeletionTimestamp != nil {
+		if core_util.HasFinalizer(db.ObjectMeta, api.GenericKey) {
+			if err := c.dropDatabase(db); err != nil {
+				log.Errorln(err)
+				return err
+			}
+			_, _, err = util.PatchMySQLDatabase(c.ExtClient.KubedbV1alpha1(), db, func(in *api.MySQLDatabase) *api.MySQLDatabase {
+				in.ObjectMeta = core_util.RemoveFinalizer(in.ObjectMeta, api.GenericKey)
+				return in
+			})
+			return err
+		}
+		return nil
+	}
+
+	db, _, err = util.PatchMySQLDatabase(c.ExtClient.KubedbV1alpha1(), db, func(in *api.MySQLDatabase) *api.MySQLDatabase {
+		in.ObjectMeta = core_util.AddFinalizer(in.ObjectMeta, api.GenericKey)
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	return c.syncMySQLDatabase(db)
+}
+
+// syncMySQLDatabase creates the database of a MySQLDatabase on the referenced MySQL, and corrects its
+// character set and collation if they were changed on the server. It is repeated every schemaSyncInterval.
+func (c *Controller) syncMySQLDatabase(db *api.MySQLDatabase) error {
+	db.SetDefaults()
+	if err := validateMySQLDatabase(db); err != nil {
+		c.recorder.Event(db, core.EventTypeWarning, eventer.EventReasonInvalid, err.Error())
+		return c.updateMySQLDatabaseStatus(db, newObjectStatus(db, api.MySQLObjectPhaseFailed, err.Error()))
+	}
+	defer resync(c.mydbQueue, db)
+
+	others, err := c.otherMySQLDatabases(db)
+	if err != nil {
+		return err
+	}
+	if owner, ok := isManagedBy(db, others); ok {
+		err := fmt.Errorf("database %q is managed by MySQLDatabase %v", db.DatabaseName(), owner.GetName())
+		c.recorder.Event(db, core.EventTypeWarning, eventer.EventReasonInvalid, err.Error())
+		return c.updateMySQLDatabaseStatus(db, newObjectStatus(db, api.MySQLObjectPhaseFailed, err.Error()))
+	}
+
+	mysql, err := c.getRunningMySQL(db.Namespace, db.Spec.DatabaseRef.Name)
+	if err != nil {
+		return c.updateMySQLDatabaseStatus(db, newObjectStatus(db, api.MySQLObjectPhasePending, err.Error()))
+	}
+
+	hosts, err := c.writableHosts(mysql)
+	if err == nil {
+		for _, host := range hosts {
+			if err = c.ensureDatabase(mysql, host, db); err != nil {
+				err = fmt.Errorf("failed to create database %q on %v. Reason: %v", db.DatabaseName(), host, err)
+				break
+			}
+		}
+	}
+	if err != nil {
+		c.recorder.Event(db, core.EventTypeWarning, eventer.EventReasonFailedToCreate, err.Error())
+		return c.updateMySQLDatabaseStatus(db, newObjectStatus(db, api.MySQLObjectPhaseFailed, err.Error()))
+	}
+	return c.updateMySQLDatabaseStatus(db, newObjectStatus(db, api.MySQLObjectPhaseReady, ""))
+}
+
+// otherMySQLDatabases returns the MySQLDatabases, other than db and not being deleted, that claim the
+// same database on the same MySQL.
+func (c *Controller) otherMySQLDatabases(db *api.MySQLDatabase) ([]metav1.Object, error) {
+	dbs, err := c.mydbLister.MySQLDatabases(db.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var others []metav1.Object
+	for _, o := range dbs {
+		if o.Name != db.Name && o.DeletionTimestamp == nil &&
+			o.Spec.DatabaseRef.Name == db.Spec.DatabaseRef.Name && o.DatabaseName() == db.DatabaseName() {
+			others = append(others, o)
+		}
+	}
+	return others, nil
+}
+
+func validateMySQLDatabase(db *api.MySQLDatabase) error {
+	if db.Spec.DatabaseRef.Name == "" {
+		return fmt.Errorf(`spec.databaseRef.name of MySQLDatabase %v/%v is not set`, db.Namespace, db.Name)
+	}
+	name := db.DatabaseName()
+	if len(name) > maxDatabaseNameLength {
+		return fmt.Errorf("database name %q is longer than %d characters", name, maxDatabaseNameLength)
+	}
+	for _, sys := range systemDatabases {
+		if strings.EqualFold(name, sys) {
+			return fmt.Errorf("database %q is a system database", name)
+		}
+	}
+	if db.Spec.CharacterSet != "" && !charsetNameRegexp.MatchString(db.Spec.CharacterSet) {
+		return fmt.Errorf("invalid character set %q", db.Spec.CharacterSet)
+	}
+	if db.Spec.Collation != "" && !charsetNameRegexp.MatchString(db.Spec.Collation) {
+		return fmt.Errorf("invalid collation %q", db.Spec.Collation)
+	}
+	return nil
+}
+
+// ensureDatabase creates the database of db on the server at host, unless it exists. If the
+// character set or the collation of an existing database differ from the spec, they are altered.
+func (c *Controller) ensureDatabase(mysql *api.MySQL, host string, db *api.MySQLDatabase) error {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	name := db.DatabaseName()
+	rows, err := en.QueryString(
+		"SELECT DEFAULT_CHARACTER_SET_NAME AS charset, DEFAULT_COLLATION_NAME AS collation FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?",
+		name,
+	)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		if _, err := en.Exec("CREATE DATABASE IF NOT EXISTS " + quoteIdentifier(name) + databaseOptions(db)); err != nil {
+			return err
+		}
+		c.recorder.Eventf(db, core.EventTypeNormal, eventer.EventReasonSuccessful, "Successfully created database %q on %v", name, host)
+		return nil
+	}
+
+	charset, collation := db.Spec.CharacterSet, db.Spec.Collation
+	if (charset == "" || strings.EqualFold(rows[0]["charset"], charset)) && (collation == "" || strings.EqualFold(rows[0]["collation"], collation)) {
+		return nil
+	}
+	c.recorder.Eventf(
+		db,
+		core.EventTypeWarning,
+		EventReasonDriftDetected,
+		"Database %q on %v has character set %v and collation %v",
+		name, host, rows[0]["charset"], rows[0]["collation"],
+	)
+	if _, err := en.Exec("ALTER DATABASE " + quoteIdentifier(name) + databaseOptions(db)); err != nil {
+		return err
+	}
+	c.recorder.Eventf(db, core.EventTypeNormal, EventReasonRepaired, "Altered database %q on %v", name, host)
+	return nil
+}
+
+// databaseOptions returns the CHARACTER SET and COLLATE clauses of CREATE and ALTER DATABASE for db.
+func databaseOptions(db *api.MySQLDatabase) string {
+	var opts string
+	if db.Spec.CharacterSet != "" {
+		opts += " CHARACTER SET " + db.Spec.CharacterSet
+	}
+	if db.Spec.Collation != "" {
+		opts += " COLLATE " + db.Spec.Collation
+	}
+	return opts
+}
+
+// dropDatabase drops the database of a deleted MySQLDatabase, if its deletionPolicy is Delete. It
+// fails while the MySQL is not running, so that the MySQLDatabase is not removed before the
+// database is dropped. Setting the deletionPolicy to Retain unblocks the deletion. A database that
+// another MySQLDatabase claims is kept, and managed by that one.
+func (c *Controller) dropDatabase(db *api.MySQLDatabase) error {
+	db.SetDefaults()
+	if db.Spec.DeletionPolicy != api.MySQLDeletionPolicyDelete || validateMySQLDatabase(db) != nil {
+		return nil
+	}
+	if others, err := c.otherMySQLDatabases(db); err != nil || len(others) > 0 {
+		return err
+	}
+	mysql, err := c.getMySQLForCleanup(db.Namespace, db.Spec.DatabaseRef.Name)
+	if err != nil || mysql == nil {
+		return err
+	}
+	hosts, err := c.writableHosts(mysql)
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		if err := c.execOnHost(mysql, host, "DROP DATABASE IF EXISTS "+quoteIdentifier(db.DatabaseName())); err != nil {
+			return fmt.Errorf("failed to drop database %q on %v. Reason: %v", db.DatabaseName(), host, err)
+		}
+	}
+	log.Infof("database %q of MySQLDatabase %v/%v is dropped", db.DatabaseName(), db.Namespace, db.Name)
+	return nil
+}
+
+// execOnHost runs stmts on the server at host.
+func (c *Controller) execOnHost(mysql *api.MySQL, host string, stmts ...string) error {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+	for _, stmt := range stmts {
+		if _, err := en.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Controller) updateMySQLDatabaseStatus(db *api.MySQLDatabase, st *api.MySQLObjectStatus) error {
+	if !isObjectStatusChanged(db.Status, st) {
+		return nil
+	}
+	_, err := util.UpdateMySQLDatabaseStatus(c.ExtClient.KubedbV1alpha1(), db, func(in *api.MySQLObjectStatus) *api.MySQLObjectStatus {
+		return st
+	})
+	return err
+}
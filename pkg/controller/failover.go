@@ -0,0 +1,336 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+)
+
+const (
+	EventReasonSourceUnhealthy  = "SourceUnhealthy"
+	EventReasonFailoverSkipped  = "FailoverSkipped"
+	EventReasonFailoverSelected = "FailoverCandidateSelected"
+	EventReasonFailoverFailed   = "FailoverFailed"
+	EventReasonFailover         = "Failover"
+
+	// how long a promoted replica may take to apply the transactions it received from the failed source
+	failoverApplyTimeout = time.Minute
+)
+
+func failoverTimeout(mysql *api.MySQL) time.Duration {
+	if r := mysql.Spec.Topology.Replication; r != nil && r.FailoverTimeout != nil {
+		return r.FailoverTimeout.Duration
+	}
+	return api.MySQLDefaultFailoverTimeout
+}
+
+// handleSourceFailure is called when the source could not be reached or did not respond. The source is
+// replaced only once it has been unhealthy for the failover timeout, as it may only be restarting.
+// It returns true if a replica was promoted in place of the source.
+func (c *Controller) handleSourceFailure(mysql *api.MySQL, source string, cause error, conditions *conditionSet) (bool, error) {
+	now := metav1.Now()
+	since := now
+	detected := false
+	if st := mysql.Status.Replication; st != nil && st.Source == source && st.SourceUnhealthySince != nil {
+		since = *st.SourceUnhealthySince
+	} else {
+		detected = true
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeWarning,
+			EventReasonSourceUnhealthy,
+			`Source "%v" is unhealthy. Reason: %v`,
+			source,
+			cause,
+		)
+		my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+			if in.Replication == nil {
+				in.Replication = &api.MySQLReplicationStatus{}
+			}
+			in.Replication.Source = source
+			in.Replication.SourceUnhealthySince = &now
+			return in
+		})
+		if err != nil {
+			return false, err
+		}
+		mysql.Status = my.Status
+	}
+
+	conditions.set(api.MySQLConditionReplicationHealthy, core.ConditionFalse, ConditionReasonSourceUnhealthy,
+		fmt.Sprintf("source %s is unhealthy since %s. Reason: %v", source, since.UTC().Format(time.RFC3339), cause))
+
+	if mysql.Spec.Topology.Replication != nil && mysql.Spec.Topology.Replication.DisableFailover {
+		if detected {
+			c.recorder.Eventf(
+				mysql,
+				core.EventTypeWarning,
+				EventReasonFailoverSkipped,
+				`Automatic failover is disabled, source "%v" has to be recovered manually`,
+				source,
+			)
+		}
+		return false, nil
+	}
+
+	timeout := failoverTimeout(mysql)
+	if elapsed := now.Sub(since.Time); elapsed < timeout {
+		// check again as soon as the failover timeout is over
+		c.requeueAfter(mysql, timeout-elapsed)
+		return false, nil
+	}
+
+	failover, err := c.failover(mysql, source, cause)
+	if err != nil {
+		err = fmt.Errorf(`failed to replace source "%v" of MySQL %v/%v. Reason: %v`, source, mysql.Namespace, mysql.Name, err)
+		c.recorder.Event(
+			mysql,
+			core.EventTypeWarning,
+			EventReasonFailoverFailed,
+			err.Error(),
+		)
+		conditions.failed(api.MySQLConditionReplicationHealthy, err)
+		return false, err
+	}
+
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		if in.Replication == nil {
+			in.Replication = &api.MySQLReplicationStatus{}
+		}
+		in.Replication.Source = failover.NewSource
+		in.Replication.SourceUnhealthySince = nil
+		in.Replication.Failovers = append(in.Replication.Failovers, *failover)
+		if n := len(in.Replication.Failovers); n > api.MySQLMaxFailoverHistory {
+			in.Replication.Failovers = in.Replication.Failovers[n-api.MySQLMaxFailoverHistory:]
+		}
+		return in
+	})
+	if err != nil {
+		// The new source has already been promoted, so it must be recorded before anything else happens.
+		return false, err
+	}
+	mysql.Status = my.Status
+
+	c.recorder.Eventf(
+		mysql,
+		core.EventTypeNormal,
+		EventReasonFailover,
+		`Promoted "%v" as the source in place of "%v"`,
+		failover.NewSource,
+		failover.OldSource,
+	)
+	return true, nil
+}
+
+type failoverCandidate struct {
+	name   string
+	gtids  string
+	parsed gtidSet
+}
+
+// failover promotes the replica with the most advanced GTID set in place of the failed source. The
+// transactions that a replica received into its relay log count as well, as they are applied before it
+// is promoted. The other replicas are repointed to the new source by ensureReplication afterwards.
+func (c *Controller) failover(mysql *api.MySQL, oldSource string, cause error) (*api.MySQLFailover, error) {
+	var candidates []failoverCandidate
+	for i := 0; i < int(types.Int32(mysql.Spec.Replicas)); i++ {
+		name := fmt.Sprintf("%s-%d", mysql.OffshootName(), i)
+		if name == oldSource {
+			continue
+		}
+		parsed, err := c.getReceivedGTIDs(mysql, name)
+		if err != nil {
+			log.Warningf("replica %v of MySQL %v/%v can't be promoted. Reason: %v", name, mysql.Namespace, mysql.Name, err)
+			continue
+		}
+		candidates = append(candidates, failoverCandidate{name: name, gtids: parsed.String(), parsed: parsed})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no replica is reachable")
+	}
+
+	best, diverged := selectFailoverCandidate(candidates)
+	if diverged {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeWarning,
+			EventReasonFailoverSelected,
+			`Replicas have diverged, selected "%v" with the most transactions (%v). Transactions missing from it are lost on the other replicas`,
+			best.name,
+			best.gtids,
+		)
+	} else {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			EventReasonFailoverSelected,
+			`Selected "%v" with the most advanced received GTID set (%v) out of %d reachable replica(s)`,
+			best.name,
+			best.gtids,
+			len(candidates),
+		)
+	}
+
+	// Stop routing clients to the old source, and make it read-only in case it is only stuck.
+	if err := c.removeMemberRole(mysql, oldSource); err != nil {
+		return nil, err
+	}
+	c.fenceSource(mysql, oldSource)
+
+	if err := c.promoteReplica(mysql, best.name); err != nil {
+		return nil, err
+	}
+	log.Infof("replica %v of MySQL %v/%v is promoted in place of source %v", best.name, mysql.Namespace, mysql.Name, oldSource)
+
+	return &api.MySQLFailover{
+		Time:         metav1.Now(),
+		OldSource:    oldSource,
+		NewSource:    best.name,
+		Reason:       cause.Error(),
+		GTIDExecuted: best.gtids,
+	}, nil
+}
+
+// selectFailoverCandidate returns the first candidate whose executed GTID set contains the sets
+// of all the others. If there is none, the replicas have diverged, and the candidate with the most
+// transactions is returned.
+func selectFailoverCandidate(candidates []failoverCandidate) (failoverCandidate, bool) {
+	for _, cand := range candidates {
+		advanced := true
+		for _, other := range candidates {
+			if !cand.parsed.contains(other.parsed) {
+				advanced = false
+				break
+			}
+		}
+		if advanced {
+			return cand, false
+		}
+	}
+
+	best := candidates[0]
+	for _, cand := range candidates[1:] {
+		if cand.parsed.count() > best.parsed.count() {
+			best = cand
+		}
+	}
+	return best, true
+}
+
+// getReceivedGTIDs returns the transactions that the replica has executed, or received into its relay
+// log, ie, the union of gtid_executed and Retrieved_Gtid_Set.
+func (c *Controller) getReceivedGTIDs(mysql *api.MySQL, name string) (gtidSet, error) {
+	en, err := c.newMemberClient(mysql, memberHost(mysql, name))
+	if err != nil {
+		return nil, err
+	}
+	defer en.Close()
+
+	rows, err := en.QueryString("SELECT @@GLOBAL.gtid_executed AS gtid_executed")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("failed to read gtid_executed")
+	}
+	status, err := en.QueryString("SHOW SLAVE STATUS")
+	if err != nil {
+		return nil, err
+	}
+	retrieved := ""
+	if len(status) > 0 {
+		retrieved = status[0]["Retrieved_Gtid_Set"]
+	}
+	return receivedGTIDSet(rows[0]["gtid_executed"], retrieved)
+}
+
+func receivedGTIDSet(executed, retrieved string) (gtidSet, error) {
+	// overlapping intervals are merged by parseGTIDSet
+	return parseGTIDSet(executed + "," + retrieved)
+}
+
+// promoteReplica applies the transactions that the replica received from the failed source, then stops
+// replication and forgets its source. It is made writable by ensureReplicationSource. A replica that
+// can't apply them is not promoted, as the transactions would be lost.
+func (c *Controller) promoteReplica(mysql *api.MySQL, name string) error {
+	user, password, err := c.getRootCredentials(mysql)
+	if err != nil {
+		return err
+	}
+	// the statement that waits for the transactions to be applied returns after failoverApplyTimeout
+	en, err := c.newMemberClientWithTimeout(mysql, memberHost(mysql, name), user, password, (failoverApplyTimeout + 30*time.Second).String())
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	if _, err := en.Exec("STOP SLAVE IO_THREAD"); err != nil {
+		return err
+	}
+	rows, err := en.QueryString("SHOW SLAVE STATUS")
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 && rows[0]["Retrieved_Gtid_Set"] != "" {
+		// the applier may have been stopped, eg, by an error
+		if _, err := en.Exec("START SLAVE SQL_THREAD"); err != nil {
+			return err
+		}
+		result, err := en.QueryString("SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?) AS result", rows[0]["Retrieved_Gtid_Set"], int(failoverApplyTimeout.Seconds()))
+		if err != nil {
+			return err
+		}
+		if len(result) == 0 || result[0]["result"] != "0" {
+			reason := "timed out"
+			if status, err := en.QueryString("SHOW SLAVE STATUS"); err == nil && len(status) > 0 && status[0]["Last_SQL_Error"] != "" {
+				reason = status[0]["Last_SQL_Error"]
+			}
+			return fmt.Errorf("replica %v did not apply the transactions it received (%v) within %v. Reason: %v", name, rows[0]["Retrieved_Gtid_Set"], failoverApplyTimeout, reason)
+		}
+	}
+
+	if _, err := en.Exec("STOP SLAVE"); err != nil {
+		return err
+	}
+	_, err = en.Exec("RESET SLAVE ALL")
+	return err
+}
+
+// fenceSource makes a failed source read-only, if it still responds at all.
+func (c *Controller) fenceSource(mysql *api.MySQL, name string) {
+	en, err := c.newMemberClient(mysql, memberHost(mysql, name))
+	if err != nil {
+		return
+	}
+	defer en.Close()
+
+	if _, err := en.Exec("SET GLOBAL super_read_only = ON"); err != nil {
+		log.Warningf("failed to make source %v of MySQL %v/%v read-only. Reason: %v", name, mysql.Namespace, mysql.Name, err)
+	}
+}
+
+// removeMemberRole removes the role label from a pod, so that it is selected by neither the primary nor the replicas Service.
+func (c *Controller) removeMemberRole(mysql *api.MySQL, name string) error {
+	pod, err := c.podLister.Pods(mysql.Namespace).Get(name)
+	if kerr.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, ok := pod.Labels[api.LabelRole]; !ok {
+		return nil
+	}
+	_, _, err = core_util.PatchPod(c.Client, pod, func(in *core.Pod) *core.Pod {
+		delete(in.Labels, api.LabelRole)
+		return in
+	})
+	return err
+}
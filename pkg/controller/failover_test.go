@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSelectFailoverCandidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		gtids    []string
+		best     string
+		diverged bool
+	}{
+		{"single replica", []string{uuidA + ":1-10"}, "my-1", false},
+		{"most advanced", []string{uuidA + ":1-7", uuidA + ":1-10", uuidA + ":1-9"}, "my-2", false},
+		{"first of equals", []string{uuidA + ":1-10", uuidA + ":1-10"}, "my-1", false},
+		{"diverged", []string{uuidA + ":1-10," + uuidB + ":1", uuidA + ":1-12"}, "my-2", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var candidates []failoverCandidate
+			for i, gtids := range c.gtids {
+				parsed, err := parseGTIDSet(gtids)
+				if err != nil {
+					t.Fatal(err)
+				}
+				candidates = append(candidates, failoverCandidate{
+					name:   fmt.Sprintf("my-%d", i+1),
+					gtids:  gtids,
+					parsed: parsed,
+				})
+			}
+			best, diverged := selectFailoverCandidate(candidates)
+			if best.name != c.best || diverged != c.diverged {
+				t.Errorf("expected %s (diverged: %v), got %s (diverged: %v)", c.best, c.diverged, best.name, diverged)
+			}
+		})
+	}
+}
+
+func TestReceivedGTIDSet(t *testing.T) {
+	// my-2 has applied fewer transactions, but received more into its relay log
+	executed := map[string][2]string{
+		"my-1": {uuidA + ":1-10", ""},
+		"my-2": {uuidA + ":1-8", uuidA + ":5-12"},
+	}
+	var candidates []failoverCandidate
+	for _, name := range []string{"my-1", "my-2"} {
+		parsed, err := receivedGTIDSet(executed[name][0], executed[name][1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidates = append(candidates, failoverCandidate{name: name, gtids: parsed.String(), parsed: parsed})
+	}
+	best, diverged := selectFailoverCandidate(candidates)
+	if best.name != "my-2" || diverged {
+		t.Errorf("expected my-2 (diverged: false), got %s (diverged: %v)", best.name, diverged)
+	}
+	if expected := uuidA + ":1-12"; best.gtids != expected {
+		t.Errorf("expected %s, got %s", expected, best.gtids)
+	}
+}
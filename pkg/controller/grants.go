@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+const (
+	privilegeAll         = "ALL PRIVILEGES"
+	privilegeGrantOption = "GRANT OPTION"
+	privilegeUsage       = "USAGE"
+)
+
+var (
+	// a line of SHOW GRANTS for privileges on a database or a table. Grants of roles and of
+	// routines are not matched.
+	grantRegexp = regexp.MustCompile("^GRANT (.+?) ON ((?:\\*|`(?:[^`]|``)*`)\\.(?:\\*|`(?:[^`]|``)*`)) TO ")
+
+	privilegeRegexp = regexp.MustCompile(`^[A-Z_]+( [A-Z_]+)*$`)
+)
+
+// grantSet is the set of privileges of a user, by the target that they are granted on,
+// eg, "*.*" or "`db`.*".
+type grantSet map[string]map[string]bool
+
+func (s grantSet) add(target, privilege string) {
+	if s[target] == nil {
+		s[target] = map[string]bool{}
+	}
+	s[target][privilege] = true
+}
+
+// targets returns the targets of s in order, so that statements are generated in the same order.
+func (s grantSet) targets() []string {
+	targets := make([]string, 0, len(s))
+	for target := range s {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// missing returns the privileges on target that are in s, but not in o.
+func (s grantSet) missing(o grantSet, target string) []string {
+	var privileges []string
+	for p := range s[target] {
+		if !o[target][p] {
+			privileges = append(privileges, p)
+		}
+	}
+	sort.Strings(privileges)
+	return privileges
+}
+
+// normalizePrivilege returns a privilege the way SHOW GRANTS prints it.
+func normalizePrivilege(p string) string {
+	p = strings.ToUpper(strings.Join(strings.Fields(p), " "))
+	if p == "ALL" {
+		return privilegeAll
+	}
+	return p
+}
+
+// grantTarget returns the target of a grant the way SHOW GRANTS prints it.
+func grantTarget(g api.MySQLGrant) string {
+	if g.Database == "*" {
+		return "*.*"
+	}
+	if g.Table == "*" || g.Table == "" {
+		return quoteIdentifier(g.Database) + ".*"
+	}
+	return quoteIdentifier(g.Database) + "." + quoteIdentifier(g.Table)
+}
+
+func validateGrant(g api.MySQLGrant) error {
+	if g.Database == "" {
+		return fmt.Errorf("database of grant is not set")
+	}
+	if g.Database == "*" && g.Table != "*" && g.Table != "" {
+		return fmt.Errorf("table %q of grant on all databases must be *", g.Table)
+	}
+	if len(g.Privileges) == 0 {
+		return fmt.Errorf("grant on %v has no privileges", grantTarget(g))
+	}
+	for _, p := range g.Privileges {
+		if !privilegeRegexp.MatchString(normalizePrivilege(p)) {
+			return fmt.Errorf("invalid privilege %q", p)
+		}
+	}
+	return nil
+}
+
+// desiredGrants returns the privileges of the user in spec.grants.
+func desiredGrants(grants []api.MySQLGrant) grantSet {
+	out := grantSet{}
+	for _, g := range grants {
+		for _, p := range g.Privileges {
+			if p := normalizePrivilege(p); p != privilegeUsage {
+				out.add(grantTarget(g), p)
+			}
+		}
+	}
+	return out
+}
+
+// parseGrants returns the privileges of a user from the output of SHOW GRANTS. WITH GRANT OPTION
+// is returned as privilege GRANT OPTION. USAGE, ie, no privileges, is ignored.
+func parseGrants(lines []string) grantSet {
+	out := grantSet{}
+	for _, line := range lines {
+		m := grantRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		// privileges are printed the way normalizePrivilege returns them, but column lists are kept as is
+		for _, p := range splitPrivileges(m[1]) {
+			if p != privilegeUsage {
+				out.add(m[2], p)
+			}
+		}
+		if strings.HasSuffix(line, " WITH GRANT OPTION") {
+			out.add(m[2], privilegeGrantOption)
+		}
+	}
+	return out
+}
+
+// splitPrivileges splits a list of privileges, eg, "SELECT, INSERT (a, b)", at the commas that
+// are not within the column list of a privilege.
+func splitPrivileges(s string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				out = append(out, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(out, strings.TrimSpace(s[start:]))
+}
+
+// grantStatements returns the REVOKE and GRANT statements that change the privileges of account
+// from cur to desired. Privileges are revoked first, as revoking ALL PRIVILEGES also revokes the
+// privileges that are granted in its place. Privileges are not revoked from a target that ALL
+// PRIVILEGES is desired on, as they are included in it.
+func grantStatements(account string, cur, desired grantSet) []string {
+	var stmts []string
+	for _, target := range cur.targets() {
+		extra := cur.missing(desired, target)
+		if desired[target][privilegeAll] {
+			extra = filterPrivileges(extra, privilegeGrantOption)
+		}
+		if len(extra) > 0 {
+			stmts = append(stmts, fmt.Sprintf("REVOKE %s ON %s FROM %s", strings.Join(extra, ", "), target, account))
+		}
+	}
+	for _, target := range desired.targets() {
+		missing := desired.missing(cur, target)
+		if len(missing) == 0 {
+			continue
+		}
+		var privileges []string
+		var grantOption string
+		for _, p := range missing {
+			if p == privilegeGrantOption {
+				grantOption = " WITH GRANT OPTION"
+			} else {
+				privileges = append(privileges, p)
+			}
+		}
+		if len(privileges) == 0 {
+			privileges = []string{privilegeUsage}
+		}
+		stmts = append(stmts, fmt.Sprintf("GRANT %s ON %s TO %s%s", strings.Join(privileges, ", "), target, account, grantOption))
+	}
+	return stmts
+}
+
+// filterPrivileges returns the privileges in keep only.
+func filterPrivileges(privileges []string, keep ...string) []string {
+	var out []string
+	for _, p := range privileges {
+		for _, k := range keep {
+			if p == k {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
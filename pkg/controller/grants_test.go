@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestParseGrants(t *testing.T) {
+	lines := []string{
+		"GRANT USAGE ON *.* TO `app`@`%`",
+		"GRANT BACKUP_ADMIN,XA_RECOVER_ADMIN ON *.* TO `app`@`%`",
+		"GRANT SELECT, INSERT, UPDATE (`a`, `b`) ON `shop`.* TO `app`@`%` WITH GRANT OPTION",
+		"GRANT ALL PRIVILEGES ON `my db`.`my``table` TO 'app'@'%'",
+		"GRANT `reader`@`%` TO `app`@`%`",
+	}
+	expected := grantSet{
+		"*.*":                 {"BACKUP_ADMIN": true, "XA_RECOVER_ADMIN": true},
+		"`shop`.*":            {"SELECT": true, "INSERT": true, "UPDATE (`a`, `b`)": true, "GRANT OPTION": true},
+		"`my db`.`my``table`": {"ALL PRIVILEGES": true},
+	}
+	if got := parseGrants(lines); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestGrantStatements(t *testing.T) {
+	const account = "'app'@'%'"
+	cases := []struct {
+		name     string
+		cur      []string
+		grants   []api.MySQLGrant
+		expected []string
+	}{
+		{
+			name: "new user",
+			cur:  []string{"GRANT USAGE ON *.* TO `app`@`%`"},
+			grants: []api.MySQLGrant{
+				{Privileges: []string{"select", "Insert"}, Database: "shop", Table: "*"},
+				{Privileges: []string{"PROCESS"}, Database: "*"},
+			},
+			expected: []string{
+				"GRANT PROCESS ON *.* TO 'app'@'%'",
+				"GRANT INSERT, SELECT ON `shop`.* TO 'app'@'%'",
+			},
+		},
+		{
+			name: "unchanged",
+			cur:  []string{"GRANT SELECT, INSERT ON `shop`.* TO `app`@`%` WITH GRANT OPTION"},
+			grants: []api.MySQLGrant{
+				{Privileges: []string{"SELECT", "INSERT", "GRANT OPTION"}, Database: "shop", Table: "*"},
+			},
+		},
+		{
+			name: "privileges changed",
+			cur: []string{
+				"GRANT SELECT, DELETE ON `shop`.* TO `app`@`%` WITH GRANT OPTION",
+				"GRANT SELECT ON `other`.`orders` TO `app`@`%`",
+			},
+			grants: []api.MySQLGrant{
+				{Privileges: []string{"SELECT", "UPDATE"}, Database: "shop", Table: "*"},
+			},
+			expected: []string{
+				"REVOKE SELECT ON `other`.`orders` FROM 'app'@'%'",
+				"REVOKE DELETE, GRANT OPTION ON `shop`.* FROM 'app'@'%'",
+				"GRANT UPDATE ON `shop`.* TO 'app'@'%'",
+			},
+		},
+		{
+			name: "all privileges replaced",
+			cur:  []string{"GRANT ALL PRIVILEGES ON `shop`.* TO `app`@`%`"},
+			grants: []api.MySQLGrant{
+				{Privileges: []string{"SELECT"}, Database: "shop", Table: "*"},
+			},
+			expected: []string{
+				"REVOKE ALL PRIVILEGES ON `shop`.* FROM 'app'@'%'",
+				"GRANT SELECT ON `shop`.* TO 'app'@'%'",
+			},
+		},
+		{
+			name: "all privileges kept",
+			cur:  []string{"GRANT SELECT, INSERT ON *.* TO `app`@`%`"},
+			grants: []api.MySQLGrant{
+				{Privileges: []string{"all"}, Database: "*"},
+			},
+			expected: []string{
+				"GRANT ALL PRIVILEGES ON *.* TO 'app'@'%'",
+			},
+		},
+		{
+			name: "grant option only",
+			cur:  []string{"GRANT SELECT ON `shop`.* TO `app`@`%`"},
+			grants: []api.MySQLGrant{
+				{Privileges: []string{"SELECT", "GRANT OPTION"}, Database: "shop", Table: "*"},
+			},
+			expected: []string{
+				"GRANT USAGE ON `shop`.* TO 'app'@'%' WITH GRANT OPTION",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := grantStatements(account, parseGrants(c.cur), desiredGrants(c.grants))
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expected %q, got %q", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestNativePasswordHash(t *testing.T) {
+	// SELECT PASSWORD('secret') on MySQL 5.7
+	if got := nativePasswordHash("secret"); got != "*14E65567ABDB5135D0CFD9A70B3032C179A49EE7" {
+		t.Errorf("unexpected hash %v", got)
+	}
+}
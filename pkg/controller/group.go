@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+// ref: https://dev.mysql.com/doc/refman/5.7/en/group-replication-server-states.html
+const (
+	memberStateOnline      = "ONLINE"
+	memberStateOffline     = "OFFLINE"
+	memberStateUnreachable = "UNREACHABLE"
+)
+
+// groupMember is a row of performance_schema.replication_group_members
+type groupMember struct {
+	ID      string
+	Host    string
+	State   string
+	Primary bool
+}
+
+// getGroupMembers returns the members of the replication group as seen by the
+// first member that is itself ONLINE in the group.
+func (c *Controller) getGroupMembers(mysql *api.MySQL) ([]groupMember, error) {
+	var lastErr error
+	for i := 0; i < int(types.Int32(mysql.Spec.Replicas)); i++ {
+		members, err := c.queryGroupMembers(mysql, mysql.PeerName(i))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if members != nil {
+			return members, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to get members of replication group for MySQL %v/%v. Reason: %v", mysql.Namespace, mysql.Name, lastErr)
+	}
+	return nil, fmt.Errorf("no ONLINE member found in replication group for MySQL %v/%v", mysql.Namespace, mysql.Name)
+}
+
+// queryGroupMembers returns the group members seen by the member at host. It returns nil
+// if the member at host is not ONLINE, as its view of the group can't be trusted.
+func (c *Controller) queryGroupMembers(mysql *api.MySQL, host string) ([]groupMember, error) {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return nil, err
+	}
+	defer en.Close()
+
+	self, err := en.QueryString("SELECT @@server_uuid AS id")
+	if err != nil {
+		return nil, err
+	}
+	primary, err := en.QueryString("SHOW STATUS WHERE Variable_name = 'group_replication_primary_member'")
+	if err != nil {
+		return nil, err
+	}
+	primaryID := ""
+	if len(primary) > 0 {
+		primaryID = primary[0]["Value"]
+	}
+	rows, err := en.QueryString("SELECT MEMBER_ID, MEMBER_HOST, MEMBER_STATE FROM performance_schema.replication_group_members")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		members []groupMember
+		online  bool
+	)
+	for _, row := range rows {
+		m := groupMember{
+			ID:    row["MEMBER_ID"],
+			Host:  row["MEMBER_HOST"],
+			State: row["MEMBER_STATE"],
+		}
+		// In Multi-Primary mode, every ONLINE member accepts writes.
+		m.Primary = m.State == memberStateOnline && (mysql.IsMultiPrimary() || m.ID == primaryID)
+		if len(self) > 0 && m.ID == self[0]["id"] && m.State == memberStateOnline {
+			online = true
+		}
+		members = append(members, m)
+	}
+	if !online {
+		return nil, nil
+	}
+	return members, nil
+}
+
+// ensureGroupMemberRoles labels each pod of a replication group with its current role,
+// so that the primary Service selects the writable member(s) only and the replicas Service
+// selects the secondaries. Members that are not ONLINE get no role and are selected by neither.
+func (c *Controller) ensureGroupMemberRoles(mysql *api.MySQL) error {
+	members, err := c.getGroupMembers(mysql)
+	if err != nil {
+		return err
+	}
+
+	roles := map[string]string{}
+	for _, m := range members {
+		if m.State != memberStateOnline {
+			continue
+		}
+		if m.Primary {
+			roles[podNameFromHost(m.Host)] = api.MySQLPodPrimary
+		} else {
+			roles[podNameFromHost(m.Host)] = api.MySQLPodSecondary
+		}
+	}
+
+	// In Multi-Primary mode, every ONLINE member is a primary, so there is no change of primary to announce.
+	return c.ensureMemberRoles(mysql, roles, !mysql.IsMultiPrimary())
+}
+
+// groupRecoveryChannel is the replication channel that a joining member uses to fetch the
+// transactions it is missing from a donor.
+const groupRecoveryChannel = "group_replication_recovery"
+
+// ensureGroupRecoveryCredentials makes the replication group use the credentials of the replication
+// secret for distributed recovery. Members bootstrapped by on-start.sh already use them, but groups
+// created by older versions of the operator use a well-known password. The replication user is
+// altered on a primary, from where it is replicated to every member, and the recovery channel is
+// updated on every ONLINE member. The channel is only used when a member joins the group.
+func (c *Controller) ensureGroupRecoveryCredentials(mysql *api.MySQL) error {
+	user, password, err := c.getReplicationCredentials(mysql)
+	if err != nil {
+		return err
+	}
+	members, err := c.getGroupMembers(mysql)
+	if err != nil {
+		return err
+	}
+
+	var outdated []string
+	for _, m := range members {
+		if m.State != memberStateOnline {
+			continue
+		}
+		host := memberHost(mysql, podNameFromHost(m.Host))
+		ok, err := c.hasRecoveryCredentials(mysql, host, user, password)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			outdated = append(outdated, host)
+		}
+	}
+	if len(outdated) == 0 {
+		return nil
+	}
+
+	var primary string
+	for _, m := range members {
+		if m.Primary {
+			primary = memberHost(mysql, podNameFromHost(m.Host))
+			break
+		}
+	}
+	if primary == "" {
+		return fmt.Errorf("no primary found in replication group for MySQL %v/%v", mysql.Namespace, mysql.Name)
+	}
+	if err := c.ensureGroupReplicationUser(mysql, primary, user, password); err != nil {
+		return err
+	}
+	for _, host := range outdated {
+		if err := c.setRecoveryCredentials(mysql, host, user, password); err != nil {
+			return fmt.Errorf("failed to set credentials of recovery channel on %v. Reason: %v", host, err)
+		}
+		log.Infof("recovery channel of %v in MySQL %v/%v uses the credentials of the replication secret", host, mysql.Namespace, mysql.Name)
+	}
+	return nil
+}
+
+// hasRecoveryCredentials reports whether the recovery channel of the member at host uses the given credentials.
+// They are stored in mysql.slave_master_info, as master_info_repository is TABLE in group mode.
+func (c *Controller) hasRecoveryCredentials(mysql *api.MySQL, host, user, password string) (bool, error) {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return false, err
+	}
+	defer en.Close()
+
+	rows, err := en.QueryString("SELECT User_name, User_password FROM mysql.slave_master_info WHERE Channel_name = ?", groupRecoveryChannel)
+	if err != nil {
+		return false, err
+	}
+	return len(rows) > 0 && rows[0]["User_name"] == user && rows[0]["User_password"] == password, nil
+}
+
+// ensureGroupReplicationUser creates or alters the replication user on a primary of the group.
+// The statements are written to the binary log, so that they are applied on every member.
+func (c *Controller) ensureGroupReplicationUser(mysql *api.MySQL, primary, user, password string) error {
+	en, err := c.newMemberClient(mysql, primary)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	users, err := en.QueryString("SELECT user FROM mysql.user WHERE user = ? AND host = '%'", user)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		if _, err := en.Exec(fmt.Sprintf("CREATE USER %s@'%%' IDENTIFIED BY %s REQUIRE SSL", quoteString(user), quoteString(password))); err != nil {
+			return err
+		}
+		_, err = en.Exec(fmt.Sprintf("GRANT REPLICATION SLAVE ON *.* TO %s@'%%'", quoteString(user)))
+		return err
+	}
+	_, err = en.Exec(fmt.Sprintf("ALTER USER %s@'%%' IDENTIFIED BY %s", quoteString(user), quoteString(password)))
+	return err
+}
+
+func (c *Controller) setRecoveryCredentials(mysql *api.MySQL, host, user, password string) error {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	_, err = en.Exec(fmt.Sprintf("CHANGE MASTER TO MASTER_USER = %s, MASTER_PASSWORD = %s FOR CHANNEL %s",
+		quoteString(user), quoteString(password), quoteString(groupRecoveryChannel)))
+	return err
+}
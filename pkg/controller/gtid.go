@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gtidSet is a parsed GTID set, ie, the value of @@GLOBAL.gtid_executed, mapping the
+// uuid of each originating server to the sorted and merged intervals of its transactions.
+// ref: https://dev.mysql.com/doc/refman/5.7/en/replication-gtids-concepts.html#replication-gtids-concepts-gtid-sets
+type gtidSet map[string][]gtidInterval
+
+type gtidInterval struct {
+	start, end uint64
+}
+
+func parseGTIDSet(s string) (gtidSet, error) {
+	set := gtidSet{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid GTID set %q", s)
+		}
+		uuid := strings.ToLower(fields[0])
+		for _, field := range fields[1:] {
+			bounds := strings.SplitN(field, "-", 2)
+			start, err := strconv.ParseUint(bounds[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid GTID set %q. Reason: %v", s, err)
+			}
+			end := start
+			if len(bounds) == 2 {
+				if end, err = strconv.ParseUint(bounds[1], 10, 64); err != nil {
+					return nil, fmt.Errorf("invalid GTID set %q. Reason: %v", s, err)
+				}
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid GTID set %q", s)
+			}
+			set[uuid] = append(set[uuid], gtidInterval{start: start, end: end})
+		}
+	}
+	for uuid, intervals := range set {
+		set[uuid] = mergeGTIDIntervals(intervals)
+	}
+	return set, nil
+}
+
+func mergeGTIDIntervals(intervals []gtidInterval) []gtidInterval {
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].start < intervals[j].start
+	})
+	merged := intervals[:1]
+	for _, in := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if in.start <= last.end+1 {
+			if in.end > last.end {
+				last.end = in.end
+			}
+			continue
+		}
+		merged = append(merged, in)
+	}
+	return merged
+}
+
+// contains returns true if every transaction of other is also in s.
+func (s gtidSet) contains(other gtidSet) bool {
+	for uuid, intervals := range other {
+		for _, in := range intervals {
+			covered := false
+			for _, cur := range s[uuid] {
+				if cur.start <= in.start && in.end <= cur.end {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// count returns the number of transactions in s.
+func (s gtidSet) count() uint64 {
+	var n uint64
+	for _, intervals := range s {
+		for _, in := range intervals {
+			n += in.end - in.start + 1
+		}
+	}
+	return n
+}
+
+// String formats s the way MySQL does, with the servers sorted by uuid.
+func (s gtidSet) String() string {
+	uuids := make([]string, 0, len(s))
+	for uuid := range s {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	parts := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		part := uuid
+		for _, in := range s[uuid] {
+			if in.start == in.end {
+				part += fmt.Sprintf(":%d", in.start)
+			} else {
+				part += fmt.Sprintf(":%d-%d", in.start, in.end)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",\n")
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"testing"
+)
+
+const (
+	uuidA = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	uuidB = "2174b383-5441-11e8-b90a-c80aa9429562"
+)
+
+func TestParseGTIDSet(t *testing.T) {
+	cases := []struct {
+		name  string
+		set   string
+		count uint64
+		err   bool
+	}{
+		{"empty", "", 0, false},
+		{"single transaction", uuidA + ":7", 1, false},
+		{"intervals", uuidA + ":1-5:11-18", 13, false},
+		{"multiple servers", uuidA + ":1-5,\n" + uuidB + ":1-3", 8, false},
+		{"overlapping intervals", uuidA + ":1-5:3-8", 8, false},
+		{"upper case uuid", "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5", 5, false},
+		{"missing interval", uuidA, 0, true},
+		{"reversed interval", uuidA + ":5-1", 0, true},
+		{"invalid number", uuidA + ":1-x", 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			set, err := parseGTIDSet(c.set)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected error for %q", c.set)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", c.set, err)
+			}
+			if got := set.count(); got != c.count {
+				t.Errorf("expected %d transactions in %q, got %d", c.count, c.set, got)
+			}
+		})
+	}
+}
+
+func TestGTIDSetContains(t *testing.T) {
+	cases := []struct {
+		name     string
+		set      string
+		other    string
+		contains bool
+	}{
+		{"equal", uuidA + ":1-10", uuidA + ":1-10", true},
+		{"behind", uuidA + ":1-10", uuidA + ":1-7", true},
+		{"ahead", uuidA + ":1-7", uuidA + ":1-10", false},
+		{"empty", uuidA + ":1-7", "", true},
+		{"adjacent intervals are merged", uuidA + ":1-5:6-10", uuidA + ":4-8", true},
+		{"gap", uuidA + ":1-5:7-10", uuidA + ":4-8", false},
+		{"errant transaction", uuidA + ":1-10", uuidA + ":1-10," + uuidB + ":1", false},
+		{"case insensitive uuid", uuidA + ":1-10", "3E11FA47-71CA-11E1-9E33-C80AA9429562:2", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			set, err := parseGTIDSet(c.set)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := parseGTIDSet(c.other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := set.contains(other); got != c.contains {
+				t.Errorf("expected %q contains %q to be %v", c.set, c.other, c.contains)
+			}
+		})
+	}
+}
+
+func TestGTIDSetString(t *testing.T) {
+	set, err := parseGTIDSet(uuidA + ":11-18:1-5:7," + uuidB + ":3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := uuidB + ":3,\n" + uuidA + ":1-5:7:11-18"; set.String() != expected {
+		t.Errorf("expected %q, got %q", expected, set.String())
+	}
+}
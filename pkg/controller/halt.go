@@ -0,0 +1,347 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/encoding/json/types"
+	"github.com/appscode/go/log"
+	go_types "github.com/appscode/go/types"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	meta_util "kmodules.xyz/client-go/meta"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+	"kubedb.dev/apimachinery/pkg/eventer"
+)
+
+const (
+	EventReasonHalting = "Halting"
+	EventReasonHalted  = "Halted"
+
+	// how often a replication group is checked while it is stopped for halting
+	haltCheckInterval = 5 * time.Second
+	// how long the members of a replication group that is stopped for halting may take to apply the
+	// last transactions, while they are read-only. It is shorter than sqlTimeout.
+	haltApplyTimeout = 3 * time.Second
+)
+
+// conditions that are not observed while a MySQL is halted
+var haltedConditionTypes = []api.MySQLConditionType{
+	api.MySQLConditionReplicationHealthy,
+	api.MySQLConditionGroupMembersOnline,
+	api.MySQLConditionPodsUpdated,
+	api.MySQLConditionAppBindingReady,
+	api.MySQLConditionInitialized,
+	api.MySQLConditionBackupScheduled,
+	api.MySQLConditionMonitoringReady,
+}
+
+// halt stops the servers of a MySQL with spec.halted set, by scaling its StatefulSet to zero. Backup
+// scheduling and monitoring are stopped, and the other offshoots are kept. A replication group is
+// stopped gracefully first, so that the first member, which bootstraps the group when the MySQL is
+// resumed, has every transaction. The phase is Halted once every pod is gone.
+func (c *Controller) halt(mysql *api.MySQL, conditions *conditionSet) error {
+	for _, t := range haltedConditionTypes {
+		conditions.remove(t)
+	}
+	conditions.set(api.MySQLConditionAllReplicasReady, core.ConditionFalse, ConditionReasonHalted, "servers are stopped")
+
+	c.cronController.StopBackupScheduling(mysql.ObjectMeta)
+	if agent := c.getOldAgent(mysql); agent != nil {
+		if _, err := agent.Delete(mysql.StatsService()); err != nil {
+			log.Errorf("error in deleting Prometheus agent. Reason: %s", err)
+		}
+	}
+
+	if err := c.checkStatefulSet(mysql); err != nil {
+		conditions.failed(api.MySQLConditionStatefulSetReady, err)
+		return err
+	}
+	statefulSet, err := c.stsLister.StatefulSets(mysql.Namespace).Get(mysql.OffshootName())
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	if err == nil && go_types.Int32(statefulSet.Spec.Replicas) > 0 {
+		if mysql.IsGroupReplication() {
+			stopped, err := c.stopGroup(mysql)
+			if err != nil {
+				conditions.set(api.MySQLConditionStatefulSetReady, core.ConditionFalse, ConditionReasonHalted, err.Error())
+				return err
+			}
+			if !stopped {
+				conditions.set(api.MySQLConditionStatefulSetReady, core.ConditionFalse, ConditionReasonHalted, "waiting for the group members to apply every transaction")
+				c.requeueAfter(mysql, haltCheckInterval)
+				return nil
+			}
+		}
+		if statefulSet, _, err = c.createStatefulSet(mysql, go_types.Int32P(0)); err != nil {
+			conditions.failed(api.MySQLConditionStatefulSetReady, err)
+			return err
+		}
+		c.recorder.Event(mysql, core.EventTypeNormal, EventReasonHalting, "Stopping the servers")
+	}
+
+	// The pods are deleted by the StatefulSet controller. The MySQL is re-enqueued by the Pod watcher.
+	if statefulSet != nil && statefulSet.Status.Replicas > 0 {
+		conditions.set(
+			api.MySQLConditionStatefulSetReady,
+			core.ConditionFalse,
+			ConditionReasonHalted,
+			fmt.Sprintf("waiting for %d pods to be deleted", statefulSet.Status.Replicas),
+		)
+		return nil
+	}
+	conditions.ready(api.MySQLConditionStatefulSetReady, fmt.Sprintf("StatefulSet %s is scaled to zero", mysql.OffshootName()))
+
+	if mysql.Status.Phase == api.DatabasePhaseHalted {
+		return nil
+	}
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		in.Phase = api.DatabasePhaseHalted
+		in.Reason = ""
+		in.ObservedGeneration = types.NewIntHash(mysql.Generation, meta_util.GenerationHash(mysql))
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+	c.recorder.Event(mysql, core.EventTypeNormal, EventReasonHalted, "Successfully halted MySQL")
+	return nil
+}
+
+// resume records that the servers of a halted MySQL are started again. The StatefulSet is scaled
+// up by the rest of the reconcile, and the phase is Running once the servers are ready. If the halt
+// was cancelled while a replication group was being stopped, writes are allowed on its primary again,
+// as stopGroup may have made the members read-only.
+func (c *Controller) resume(mysql *api.MySQL, conditions *conditionSet) error {
+	if !wasHalting(mysql) {
+		return nil
+	}
+	statefulSet, err := c.stsLister.StatefulSets(mysql.Namespace).Get(mysql.OffshootName())
+	if err != nil {
+		return nil
+	}
+	if go_types.Int32(statefulSet.Spec.Replicas) == 0 {
+		if mysql.Status.Phase == api.DatabasePhaseHalted {
+			c.recorder.Event(mysql, core.EventTypeNormal, eventer.EventReasonResuming, "Starting the servers")
+		}
+		return nil
+	}
+	if !mysql.IsGroupReplication() {
+		return nil
+	}
+	if err := c.allowGroupWrites(mysql); err != nil {
+		// keeps the MySQL marked as halting, so that it is tried again
+		conditions.set(api.MySQLConditionAllReplicasReady, core.ConditionFalse, ConditionReasonHalted,
+			fmt.Sprintf("failed to allow writes after halting was cancelled. Reason: %v", err))
+		return err
+	}
+	return nil
+}
+
+// wasHalting reports whether the MySQL was being halted, or was halted, in the last pass.
+func wasHalting(mysql *api.MySQL) bool {
+	if mysql.Status.Phase == api.DatabasePhaseHalted {
+		return true
+	}
+	for _, cond := range mysql.Status.Conditions {
+		if cond.Reason == ConditionReasonHalted {
+			return true
+		}
+	}
+	return false
+}
+
+// allowGroupWrites makes the primary of the replication group writable, or every member of a
+// multi-primary group. Nothing is done if no member is ONLINE, as the group is stopped.
+func (c *Controller) allowGroupWrites(mysql *api.MySQL) error {
+	members, err := c.getGroupMembers(mysql)
+	if err != nil {
+		log.Warningf("replication group of MySQL %v/%v is not running. Reason: %v", mysql.Namespace, mysql.Name, err)
+		return nil
+	}
+	for _, m := range members {
+		if m.State != memberStateOnline || !(m.Primary || mysql.IsMultiPrimary()) {
+			continue
+		}
+		if err := c.allowWrites(mysql, memberHost(mysql, podNameFromHost(m.Host))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowWrites makes the server at host writable. super_read_only is cleared along with read_only.
+func (c *Controller) allowWrites(mysql *api.MySQL, host string) error {
+	return c.execOnHost(mysql, host, "SET GLOBAL super_read_only = OFF", "SET GLOBAL read_only = OFF")
+}
+
+// stopGroup stops group replication on every member, once they have applied the same transactions.
+// The members keep accepting writes until the secondaries have caught up with the primary. Only then
+// are they made read-only, right before the group is stopped, and the secondaries are given
+// haltApplyTimeout to apply the last transactions. If they can't, writes are allowed again, so that a
+// halt that is waiting for the members, or is cancelled, never leaves the group read-only. It returns
+// false while the members are catching up, or while the first member is not ONLINE.
+func (c *Controller) stopGroup(mysql *api.MySQL) (bool, error) {
+	members, err := c.getGroupMembers(mysql)
+	if err != nil {
+		// no member is ONLINE, eg, the group is already stopped
+		log.Warningf("replication group of MySQL %v/%v is not stopped. Reason: %v", mysql.Namespace, mysql.Name, err)
+		return true, nil
+	}
+
+	var (
+		hosts    []string
+		primary  string
+		writable []string
+	)
+	for _, m := range members {
+		if m.State != memberStateOnline {
+			continue
+		}
+		host := memberHost(mysql, podNameFromHost(m.Host))
+		if m.Primary || mysql.IsMultiPrimary() {
+			writable = append(writable, host)
+		}
+		if m.Primary && primary == "" {
+			// the primary is stopped last
+			primary = host
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	if primary != "" {
+		hosts = append(hosts, primary)
+	}
+	first := fmt.Sprintf("%s-0", mysql.OffshootName())
+	if m := findGroupMember(members, first); m == nil || m.State != memberStateOnline {
+		// it bootstraps the group when the MySQL is resumed
+		log.Warningf(`MySQL %v/%v is waiting for member "%v" to be ONLINE before halting`, mysql.Namespace, mysql.Name, first)
+		return false, nil
+	}
+
+	// the transactions of the primary are read first, so that the others can catch up with them while
+	// writes continue
+	var executed []gtidSet
+	for i := len(hosts) - 1; i >= 0; i-- {
+		gtids, err := c.getGTIDExecuted(mysql, hosts[i])
+		if err != nil {
+			return false, err
+		}
+		executed = append(executed, gtids)
+	}
+	if !caughtUp(executed[0], executed[1:]) {
+		log.Infof("MySQL %v/%v is waiting for the group members to apply every transaction before halting", mysql.Namespace, mysql.Name)
+		return false, nil
+	}
+
+	if err := c.fenceGroup(mysql, hosts); err != nil {
+		if uerr := c.unfenceGroup(mysql, writable); uerr != nil {
+			return false, fmt.Errorf("%v, and failed to allow writes again. Reason: %v", err, uerr)
+		}
+		log.Infof("MySQL %v/%v is waiting for the group members to apply every transaction before halting. Reason: %v", mysql.Namespace, mysql.Name, err)
+		return false, nil
+	}
+
+	for _, host := range hosts {
+		if err := c.execOnHost(mysql, host, "STOP GROUP_REPLICATION"); err != nil {
+			return false, fmt.Errorf("failed to stop group replication on member %v. Reason: %v", host, err)
+		}
+	}
+	log.Infof("replication group of MySQL %v/%v is stopped", mysql.Namespace, mysql.Name)
+	return true, nil
+}
+
+// caughtUp reports whether every set of others contains the transactions of reference.
+func caughtUp(reference gtidSet, others []gtidSet) bool {
+	for _, other := range others {
+		if !other.contains(reference) {
+			return false
+		}
+	}
+	return true
+}
+
+// fenceGroup makes the members at hosts read-only, and waits for each of them to apply the
+// transactions that any of them executed.
+func (c *Controller) fenceGroup(mysql *api.MySQL, hosts []string) error {
+	var all []string
+	for _, host := range hosts {
+		gtids, err := c.stopWrites(mysql, host)
+		if err != nil {
+			return fmt.Errorf("failed to make member %v read-only. Reason: %v", host, err)
+		}
+		all = append(all, gtids.String())
+	}
+	target, err := parseGTIDSet(strings.Join(all, ","))
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		en, err := c.newMemberClient(mysql, host)
+		if err != nil {
+			return err
+		}
+		rows, err := en.QueryString("SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?) AS result", target.String(), int(haltApplyTimeout.Seconds()))
+		en.Close()
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 || rows[0]["result"] != "0" {
+			return fmt.Errorf("member %v did not apply every transaction within %v", host, haltApplyTimeout)
+		}
+	}
+	return nil
+}
+
+// unfenceGroup allows writes again on the members at hosts, that were writable before fenceGroup.
+func (c *Controller) unfenceGroup(mysql *api.MySQL, hosts []string) error {
+	for _, host := range hosts {
+		if err := c.allowWrites(mysql, host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getGTIDExecuted returns the transactions that the server at host has executed.
+func (c *Controller) getGTIDExecuted(mysql *api.MySQL, host string) (gtidSet, error) {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return nil, err
+	}
+	defer en.Close()
+
+	rows, err := en.QueryString("SELECT @@GLOBAL.gtid_executed AS gtid_executed")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("failed to read gtid_executed")
+	}
+	return parseGTIDSet(rows[0]["gtid_executed"])
+}
+
+// stopWrites makes the server at host read-only, and returns the transactions it has executed.
+func (c *Controller) stopWrites(mysql *api.MySQL, host string) (gtidSet, error) {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return nil, err
+	}
+	defer en.Close()
+
+	if _, err := en.Exec("SET GLOBAL super_read_only = ON"); err != nil {
+		return nil, err
+	}
+	rows, err := en.QueryString("SELECT @@GLOBAL.gtid_executed AS gtid_executed")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("failed to read gtid_executed")
+	}
+	return parseGTIDSet(rows[0]["gtid_executed"])
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestCaughtUp(t *testing.T) {
+	parse := func(s string) gtidSet {
+		set, err := parseGTIDSet(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return set
+	}
+	primary := parse("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-20")
+	cases := []struct {
+		name     string
+		others   []gtidSet
+		expected bool
+	}{
+		{name: "no secondaries", expected: true},
+		{name: "caught up", others: []gtidSet{parse("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-20"), parse("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-25")}, expected: true},
+		{name: "behind", others: []gtidSet{parse("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-20"), parse("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-19")}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := caughtUp(primary, c.others); got != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestWasHalting(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   api.MySQLStatus
+		expected bool
+	}{
+		{name: "running", status: api.MySQLStatus{Phase: api.DatabasePhaseRunning}},
+		{name: "halted", status: api.MySQLStatus{Phase: api.DatabasePhaseHalted}, expected: true},
+		{
+			name: "halting",
+			status: api.MySQLStatus{
+				Phase:      api.DatabasePhaseRunning,
+				Conditions: []api.MySQLCondition{{Type: api.MySQLConditionAllReplicasReady, Reason: ConditionReasonHalted}},
+			},
+			expected: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mysql := &api.MySQL{ObjectMeta: metav1.ObjectMeta{Name: "demo"}, Status: c.status}
+			if got := wasHalting(mysql); got != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
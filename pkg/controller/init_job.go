@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/appscode/go/log"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"kmodules.xyz/client-go/tools/queue"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/pkg/eventer"
+)
+
+// initJob is a Job that initializes a MySQL from spec.init, ie, that restores spec.init.snapshotSource
+// or copies spec.init.mysqlClone. It is polled while it runs, and completed by the operator rather
+// than by the job controller of the Snapshots. Once the Job ran, a failed initialization is not
+// retried, neither by the Job nor by the operator, as the MySQL may hold part of the data. The MySQL
+// is failed instead, and has to be recreated.
+type initJob interface {
+	// running returns the name of the Job, if the initialization of mysql is running
+	running(mysql *api.MySQL) (string, bool)
+	// poll updates the progress in the status of mysql from job, and returns why job failed, if known
+	poll(mysql *api.MySQL, job *batch.Job) (string, error)
+	// finish undoes what the Job needed outside of mysql, before the outcome is recorded
+	finish(mysql *api.MySQL, succeeded bool) error
+	// succeeded and failed record the outcome in the status of mysql
+	succeeded(mysql *api.MySQL, now metav1.Time) error
+	failed(mysql *api.MySQL, cause error, now metav1.Time) error
+	// cleanup deletes the Job, and what it used in the namespace of mysql
+	cleanup(mysql *api.MySQL) error
+}
+
+// newInitJobQueue returns the queue that the Jobs of init are polled with, every interval. The MySQLs
+// whose Job runs are enqueued when the operator starts, so that polling is resumed.
+func (c *Controller) newInitJobQueue(name string, init initJob, interval time.Duration) *queue.Worker {
+	var q *queue.Worker
+	q = queue.New(name, c.MaxNumRequeues, c.NumThreads, func(key string) error {
+		return c.runInitJob(key, q, init, interval)
+	})
+	c.myInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if mysql, ok := obj.(*api.MySQL); ok {
+				if _, running := init.running(mysql); running {
+					queue.Enqueue(q.GetQueue(), obj)
+				}
+			}
+		},
+	})
+	return q
+}
+
+func (c *Controller) runInitJob(key string, q *queue.Worker, init initJob, interval time.Duration) error {
+	log.Debugln("started processing, key:", key)
+	obj, exists, err := c.myInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		log.Errorf("Fetching object with key %s from store failed with %v", key, err)
+		return err
+	}
+	if !exists {
+		log.Debugf("MySQL %s does not exist anymore", key)
+		return nil
+	}
+
+	mysql := obj.(*api.MySQL).DeepCopy()
+	name, running := init.running(mysql)
+	if mysql.DeletionTimestamp != nil || !running {
+		return nil
+	}
+
+	job, err := c.Client.BatchV1().Jobs(mysql.Namespace).Get(name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		return c.failInitJob(mysql, init, fmt.Errorf("Job %v/%v is gone", mysql.Namespace, name))
+	} else if err != nil {
+		return err
+	}
+
+	reason, err := init.poll(mysql, job)
+	if err != nil {
+		return err
+	}
+	switch {
+	case job.Status.Succeeded > 0:
+		return c.completeInitJob(mysql, init)
+	case job.Status.Failed > 0:
+		if reason == "" {
+			reason = fmt.Sprintf("Job %v/%v failed, see the logs of its pod", job.Namespace, job.Name)
+		}
+		return c.failInitJob(mysql, init, errors.New(reason))
+	}
+	q.GetQueue().AddAfter(key, interval)
+	return nil
+}
+
+// startInitJob starts polling the Job that initializes mysql with q, once its start is recorded in the
+// status of mysql.
+func (c *Controller) startInitJob(mysql *api.MySQL, q *queue.Worker, interval time.Duration) error {
+	key, err := cache.MetaNamespaceKeyFunc(mysql)
+	if err != nil {
+		return err
+	}
+	q.GetQueue().AddAfter(key, interval)
+	return nil
+}
+
+// completeInitJob marks mysql initialized, once the Job of init succeeded.
+func (c *Controller) completeInitJob(mysql *api.MySQL, init initJob) error {
+	if err := init.finish(mysql, true); err != nil {
+		return err
+	}
+	if err := c.UpsertDatabaseAnnotation(mysql.ObjectMeta, map[string]string{
+		api.AnnotationInitialized: "",
+	}); err != nil {
+		return err
+	}
+	if err := c.SetDatabaseStatus(mysql.ObjectMeta, api.DatabasePhaseRunning, ""); err != nil {
+		return err
+	}
+	if err := init.succeeded(mysql, metav1.Now()); err != nil {
+		return err
+	}
+	c.recorder.Event(
+		mysql,
+		core.EventTypeNormal,
+		eventer.EventReasonSuccessfulInitialize,
+		"Successfully completed initialization",
+	)
+	return init.cleanup(mysql)
+}
+
+// failInitJob records why the Job of init failed, and fails mysql.
+func (c *Controller) failInitJob(mysql *api.MySQL, init initJob, cause error) error {
+	if err := init.finish(mysql, false); err != nil {
+		return err
+	}
+	if err := init.failed(mysql, cause, metav1.Now()); err != nil {
+		return err
+	}
+	if err := c.SetDatabaseStatus(mysql.ObjectMeta, api.DatabasePhaseFailed, "Failed to complete initialization"); err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		mysql,
+		core.EventTypeWarning,
+		eventer.EventReasonFailedToInitialize,
+		"Failed to complete initialization. Reason: %v",
+		cause,
+	)
+	return init.cleanup(mysql)
+}
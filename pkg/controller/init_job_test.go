@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	batch "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	extfake "kubedb.dev/apimachinery/client/clientset/versioned/fake"
+	api_listers "kubedb.dev/apimachinery/client/listers/kubedb/v1alpha1"
+	amc "kubedb.dev/apimachinery/pkg/controller"
+)
+
+// fakeInitJob records the hooks that are called, and fails finish if finishErr is set.
+type fakeInitJob struct {
+	calls     []string
+	finishErr error
+}
+
+func (f *fakeInitJob) running(mysql *api.MySQL) (string, bool) {
+	return "job", true
+}
+
+func (f *fakeInitJob) poll(mysql *api.MySQL, job *batch.Job) (string, error) {
+	f.calls = append(f.calls, "poll")
+	return "", nil
+}
+
+func (f *fakeInitJob) finish(mysql *api.MySQL, succeeded bool) error {
+	f.calls = append(f.calls, "finish")
+	return f.finishErr
+}
+
+func (f *fakeInitJob) succeeded(mysql *api.MySQL, now metav1.Time) error {
+	f.calls = append(f.calls, "succeeded")
+	return nil
+}
+
+func (f *fakeInitJob) failed(mysql *api.MySQL, cause error, now metav1.Time) error {
+	f.calls = append(f.calls, "failed")
+	return nil
+}
+
+func (f *fakeInitJob) cleanup(mysql *api.MySQL) error {
+	f.calls = append(f.calls, "cleanup")
+	return nil
+}
+
+func newInitJobTestController(t *testing.T, mysql *api.MySQL) *Controller {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(mysql); err != nil {
+		t.Fatal(err)
+	}
+	return &Controller{
+		Controller: &amc.Controller{
+			Client:    fake.NewSimpleClientset(),
+			ExtClient: extfake.NewSimpleClientset(mysql),
+		},
+		myLister: api_listers.NewMySQLLister(indexer),
+		recorder: record.NewFakeRecorder(10),
+	}
+}
+
+func TestCompleteInitJob(t *testing.T) {
+	// the outcome is not recorded until finish succeeds, so that it is retried
+	mysql := &api.MySQL{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	c := newInitJobTestController(t, mysql)
+
+	init := &fakeInitJob{finishErr: errors.New("unreachable")}
+	if err := c.completeInitJob(mysql, init); err == nil {
+		t.Errorf("expected the error of finish")
+	}
+	if expected := []string{"finish"}; !reflect.DeepEqual(init.calls, expected) {
+		t.Errorf("expected hooks %v, got %v", expected, init.calls)
+	}
+	my, err := c.ExtClient.KubedbV1alpha1().MySQLs(mysql.Namespace).Get(mysql.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := my.Annotations[api.AnnotationInitialized]; ok {
+		t.Errorf("expected the MySQL not to be annotated initialized")
+	}
+	if my.Status.Phase != "" {
+		t.Errorf("expected no phase, got %v", my.Status.Phase)
+	}
+}
+
+func TestFailInitJob(t *testing.T) {
+	mysql := &api.MySQL{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	c := newInitJobTestController(t, mysql)
+
+	init := &fakeInitJob{}
+	if err := c.failInitJob(mysql, init, errors.New("Job default/job is gone")); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"finish", "failed", "cleanup"}; !reflect.DeepEqual(init.calls, expected) {
+		t.Errorf("expected hooks %v, got %v", expected, init.calls)
+	}
+	my, err := c.ExtClient.KubedbV1alpha1().MySQLs(mysql.Namespace).Get(mysql.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := my.Annotations[api.AnnotationInitialized]; ok {
+		t.Errorf("expected a failed MySQL not to be annotated initialized")
+	}
+	if my.Status.Phase != api.DatabasePhaseFailed {
+		t.Errorf("expected phase %v, got %v", api.DatabasePhaseFailed, my.Status.Phase)
+	}
+}
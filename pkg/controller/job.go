@@ -3,6 +3,7 @@ package controller
 import (
 	"fmt"
 
+	"github.com/appscode/go/types"
 	batch "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -21,12 +22,14 @@ func (c *Controller) createRestoreJob(mysql *api.MySQL, snapshot *api.Snapshot)
 	if err != nil {
 		return nil, err
 	}
-	jobName := fmt.Sprintf("%s-%s", api.DatabaseNamePrefix, snapshot.OffshootName())
+	jobName := restoreJobName(mysql)
 	jobLabel := mysql.OffshootLabels()
 	if jobLabel == nil {
 		jobLabel = map[string]string{}
 	}
-	jobLabel[api.LabelDatabaseKind] = api.ResourceKindMySQL
+	// The Job watcher of snapshots deletes every completed Job of a MySQL, but the
+	// restore Job is completed as an initJob, after its log is read.
+	delete(jobLabel, api.LabelDatabaseKind)
 	jobLabel[api.AnnotationJobType] = api.JobTypeRestore
 
 	backupSpec := snapshot.Spec.Backend
@@ -35,19 +38,8 @@ func (c *Controller) createRestoreJob(mysql *api.MySQL, snapshot *api.Snapshot)
 		return nil, err
 	}
 
-	// Get PersistentVolume object for Backup Util pod.
-	pvcSpec := snapshot.Spec.PodVolumeClaimSpec
-	if pvcSpec == nil {
-		pvcSpec = mysql.Spec.Storage
-	}
-	st := snapshot.Spec.StorageType
-	if st == nil {
-		st = &mysql.Spec.StorageType
-	}
-	persistentVolume, err := c.GetVolumeForSnapshot(*st, pvcSpec, jobName, snapshot.Namespace)
-	if err != nil {
-		return nil, err
-	}
+	// The dump is streamed to and from the backend, the Job only needs an empty working directory
+	scratchVolume := snapshotScratchVolume()
 
 	// Folder name inside Cloud bucket where backup will be uploaded
 	folderName, err := snapshot.Location()
@@ -55,6 +47,20 @@ func (c *Controller) createRestoreJob(mysql *api.MySQL, snapshot *api.Snapshot)
 		return nil, err
 	}
 
+	args := []string{
+		api.JobTypeRestore,
+		fmt.Sprintf(`--host=%s`, mysql.ServiceName()),
+		fmt.Sprintf(`--data-dir=%s`, snapshotDumpDir),
+		fmt.Sprintf(`--bucket=%s`, bucket),
+		fmt.Sprintf(`--folder=%s`, folderName),
+		fmt.Sprintf(`--snapshot=%s`, snapshot.Name),
+		fmt.Sprintf(`--enable-analytics=%v`, c.EnableAnalytics),
+	}
+	args = append(args, snapshotStreamArgs(snapshot)...)
+	if mysql.Spec.Init.MySQLBinlog != nil {
+		args = append(args, binlogReplayArgs(mysql, snapshot)...)
+	}
+
 	job := &batch.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        jobName,
@@ -70,6 +76,8 @@ func (c *Controller) createRestoreJob(mysql *api.MySQL, snapshot *api.Snapshot)
 			},
 		},
 		Spec: batch.JobSpec{
+			// not retried, see initJob
+			BackoffLimit: types.Int32P(0),
 			Template: core.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Annotations: snapshot.Spec.PodTemplate.Annotations,
@@ -79,16 +87,7 @@ func (c *Controller) createRestoreJob(mysql *api.MySQL, snapshot *api.Snapshot)
 						{
 							Name:  api.JobTypeRestore,
 							Image: mysqlVersion.Spec.Tools.Image,
-							Args: append([]string{
-								api.JobTypeRestore,
-								fmt.Sprintf(`--host=%s`, mysql.ServiceName()),
-								fmt.Sprintf(`--data-dir=%s`, snapshotDumpDir),
-								fmt.Sprintf(`--bucket=%s`, bucket),
-								fmt.Sprintf(`--folder=%s`, folderName),
-								fmt.Sprintf(`--snapshot=%s`, snapshot.Name),
-								fmt.Sprintf(`--enable-analytics=%v`, c.EnableAnalytics),
-								"--",
-							}, mysql.Spec.Init.SnapshotSource.Args...),
+							Args:  append(append(args, "--"), restoreSnapshotSource(mysql).Args...),
 							Env: core_util.UpsertEnvVars([]core.EnvVar{
 								{
 									Name:  analytics.Key,
@@ -123,7 +122,7 @@ func (c *Controller) createRestoreJob(mysql *api.MySQL, snapshot *api.Snapshot)
 							Lifecycle:      snapshot.Spec.PodTemplate.Spec.Lifecycle,
 							VolumeMounts: []core.VolumeMount{
 								{
-									Name:      persistentVolume.Name,
+									Name:      scratchVolume.Name,
 									MountPath: snapshotDumpDir,
 								},
 								{
@@ -136,14 +135,14 @@ func (c *Controller) createRestoreJob(mysql *api.MySQL, snapshot *api.Snapshot)
 					},
 					Volumes: []core.Volume{
 						{
-							Name:         persistentVolume.Name,
-							VolumeSource: persistentVolume.VolumeSource,
+							Name:         scratchVolume.Name,
+							VolumeSource: scratchVolume.VolumeSource,
 						},
 						{
 							Name: "osmconfig",
 							VolumeSource: core.VolumeSource{
 								Secret: &core.SecretVolumeSource{
-									SecretName: snapshot.OSMSecretName(),
+									SecretName: restoreOSMSecretName(mysql),
 								},
 							},
 						},
@@ -176,6 +175,15 @@ func (c *Controller) createRestoreJob(mysql *api.MySQL, snapshot *api.Snapshot)
 		}
 		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, volume)
 	}
+	if volume, mount := encryptionKeyVolume(snapshot, encryptionKeyVolumeName); volume != nil {
+		job.Spec.Template.Spec.Containers[0].VolumeMounts = append(job.Spec.Template.Spec.Containers[0].VolumeMounts, *mount)
+		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, *volume)
+	}
+	if mysql.Spec.Init.MySQLBinlog != nil {
+		if err := c.upsertBinlogPuller(job, mysql, snapshot, mysqlVersion.Spec.Tools.Image); err != nil {
+			return nil, err
+		}
+	}
 
 	if c.EnableRBAC {
 		if snapshot.Spec.PodTemplate.Spec.ServiceAccountName == "" {
@@ -216,30 +224,44 @@ func (c *Controller) getSnapshotterJob(snapshot *api.Snapshot) (*batch.Job, erro
 	}
 
 	dumpArgs := snapshot.Spec.PodTemplate.Spec.Args
-	if len(dumpArgs) == 0 {
+	if len(dumpArgs) == 0 && !isPhysicalSnapshot(snapshot) {
 		dumpArgs = []string{"--all-databases"}
 	}
 
-	// Get PersistentVolume object for Backup Util pod.
-	pvcSpec := snapshot.Spec.PodVolumeClaimSpec
-	if pvcSpec == nil {
-		pvcSpec = mysql.Spec.Storage
-	}
-	st := snapshot.Spec.StorageType
-	if st == nil {
-		st = &mysql.Spec.StorageType
-	}
-	persistentVolume, err := c.GetVolumeForSnapshot(*st, pvcSpec, jobName, snapshot.Namespace)
+	// The dump is streamed to and from the backend, the Job only needs an empty working directory
+	scratchVolume := snapshotScratchVolume()
+
+	// Folder name inside Cloud bucket where backup will be uploaded
+	folderName, err := snapshot.Location()
 	if err != nil {
 		return nil, err
 	}
 
-	// Folder name inside Cloud bucket where backup will be uploaded
-	folderName, err := snapshot.Location()
+	target, err := c.backupTarget(mysql, snapshot)
 	if err != nil {
 		return nil, err
 	}
 
+	args := []string{
+		api.JobTypeBackup,
+		fmt.Sprintf(`--host=%s`, mysql.PeerName(target)),
+	}
+	if isPhysicalSnapshot(snapshot) {
+		args = []string{
+			opBackupPhysical,
+			fmt.Sprintf(`--host=%s`, mysql.PeerName(target)),
+			fmt.Sprintf(`--mysql-data-dir=%s`, "/var/lib/mysql"),
+		}
+	}
+	args = append(args,
+		fmt.Sprintf(`--data-dir=%s`, snapshotDumpDir),
+		fmt.Sprintf(`--bucket=%s`, bucket),
+		fmt.Sprintf(`--folder=%s`, folderName),
+		fmt.Sprintf(`--snapshot=%s`, snapshot.Name),
+		fmt.Sprintf(`--enable-analytics=%v`, c.EnableAnalytics),
+	)
+	args = append(append(args, snapshotStreamArgs(snapshot)...), "--")
+
 	job := &batch.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        jobName,
@@ -264,16 +286,7 @@ func (c *Controller) getSnapshotterJob(snapshot *api.Snapshot) (*batch.Job, erro
 						{
 							Name:  api.JobTypeBackup,
 							Image: mysqlVersion.Spec.Tools.Image,
-							Args: append([]string{
-								api.JobTypeBackup,
-								fmt.Sprintf(`--host=%s`, mysql.ServiceName()),
-								fmt.Sprintf(`--data-dir=%s`, snapshotDumpDir),
-								fmt.Sprintf(`--bucket=%s`, bucket),
-								fmt.Sprintf(`--folder=%s`, folderName),
-								fmt.Sprintf(`--snapshot=%s`, snapshot.Name),
-								fmt.Sprintf(`--enable-analytics=%v`, c.EnableAnalytics),
-								"--",
-							}, dumpArgs...),
+							Args:  append(args, dumpArgs...),
 							Env: core_util.UpsertEnvVars([]core.EnvVar{
 								{
 									Name:  analytics.Key,
@@ -308,7 +321,7 @@ func (c *Controller) getSnapshotterJob(snapshot *api.Snapshot) (*batch.Job, erro
 							Lifecycle:      snapshot.Spec.PodTemplate.Spec.Lifecycle,
 							VolumeMounts: []core.VolumeMount{
 								{
-									Name:      persistentVolume.Name,
+									Name:      scratchVolume.Name,
 									MountPath: snapshotDumpDir,
 								},
 								{
@@ -321,8 +334,8 @@ func (c *Controller) getSnapshotterJob(snapshot *api.Snapshot) (*batch.Job, erro
 					},
 					Volumes: []core.Volume{
 						{
-							Name:         persistentVolume.Name,
-							VolumeSource: persistentVolume.VolumeSource,
+							Name:         scratchVolume.Name,
+							VolumeSource: scratchVolume.VolumeSource,
 						},
 						{
 							Name: "osmconfig",
@@ -360,6 +373,14 @@ func (c *Controller) getSnapshotterJob(snapshot *api.Snapshot) (*batch.Job, erro
 			VolumeSource: snapshot.Spec.Backend.Local.VolumeSource,
 		})
 	}
+	if volume, mount := encryptionKeyVolume(snapshot, encryptionKeyVolumeName); volume != nil {
+		job.Spec.Template.Spec.Containers[0].VolumeMounts = append(job.Spec.Template.Spec.Containers[0].VolumeMounts, *mount)
+		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, *volume)
+	}
+	if isPhysicalSnapshot(snapshot) {
+		// the data files are copied from the server that the Job is scheduled next to
+		upsertPhysicalBackup(job, fmt.Sprintf("%s-%d", mysql.OffshootName(), target))
+	}
 
 	if c.EnableRBAC {
 		if snapshot.Spec.PodTemplate.Spec.ServiceAccountName == "" {
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/appscode/go/log"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/go-xorm/xorm"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	core_util "kmodules.xyz/client-go/core/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+const (
+	// timeout for connecting to and reading from a mysqld server, so that an
+	// unreachable member never blocks a queue worker for long.
+	sqlTimeout = "5s"
+)
+
+// getRootCredentials reads the root user name and password from the database secret.
+func (c *Controller) getRootCredentials(mysql *api.MySQL) (string, string, error) {
+	if mysql.Spec.DatabaseSecret == nil {
+		return "", "", fmt.Errorf("database secret of MySQL %v/%v is not set yet", mysql.Namespace, mysql.Name)
+	}
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(mysql.Spec.DatabaseSecret.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", err
+	}
+	user, ok := secret.Data[KeyMySQLUser]
+	if !ok {
+		user = []byte(mysqlUser)
+	}
+	password, ok := secret.Data[KeyMySQLPassword]
+	if !ok {
+		return "", "", fmt.Errorf(`secret "%v/%v" does not have key %q`, secret.Namespace, secret.Name, KeyMySQLPassword)
+	}
+	return string(user), string(password), nil
+}
+
+// newMemberClient opens a connection to the mysqld server running at host, which is
+// usually the peer address of a pod returned by MySQL.PeerName.
+func (c *Controller) newMemberClient(mysql *api.MySQL, host string) (*xorm.Engine, error) {
+	user, password, err := c.getRootCredentials(mysql)
+	if err != nil {
+		return nil, err
+	}
+	return c.newMemberClientWithCredentials(mysql, host, user, password)
+}
+
+// newMemberClientWithCredentials is like newMemberClient, but connects with the given credentials
+// instead of those in the database secret.
+func (c *Controller) newMemberClientWithCredentials(mysql *api.MySQL, host, user, password string) (*xorm.Engine, error) {
+	return c.newMemberClientWithTimeout(mysql, host, user, password, sqlTimeout)
+}
+
+// newMemberClientWithTimeout is like newMemberClientWithCredentials, but waits up to readTimeout for
+// the result of a statement, eg, of one that reads whole tables.
+func (c *Controller) newMemberClientWithTimeout(mysql *api.MySQL, host, user, password, readTimeout string) (*xorm.Engine, error) {
+	cnnstr := fmt.Sprintf("%v:%v@tcp(%s:%d)/?timeout=%s&readTimeout=%s", user, password, host, api.MySQLNodePort, sqlTimeout, readTimeout)
+	if tlsKey, err := c.registerMemberTLSConfig(mysql, host); err != nil {
+		return nil, err
+	} else if tlsKey != "" {
+		cnnstr += "&tls=" + tlsKey
+	}
+	en, err := xorm.NewEngine("mysql", cnnstr)
+	if err != nil {
+		return nil, err
+	}
+	en.ShowSQL(false)
+	return en, nil
+}
+
+// registerMemberTLSConfig registers the TLS config for connections to the server at host, if it has been
+// started with the server certificate for spec.tls, and returns its name. Until then, eg, while TLS is
+// being enabled, the server is connected to without TLS, as it would present a certificate that the
+// CA can't verify. A server that is not yet restarted with the current server certificate may present
+// one of the previous CA, so the previous CA is trusted too for it, until it is restarted.
+func (c *Controller) registerMemberTLSConfig(mysql *api.MySQL, host string) (string, error) {
+	if mysql.Spec.TLS == nil {
+		return "", nil
+	}
+	pod, err := c.podLister.Pods(mysql.Namespace).Get(podNameFromHost(host))
+	if err != nil || pod.Annotations[tlsSerialAnnotation] == "" {
+		return "", nil
+	}
+	ca, previous, err := c.getTLSCACerts(mysql)
+	if err != nil {
+		return "", err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return "", fmt.Errorf("failed to parse CA certificate of MySQL %v/%v", mysql.Namespace, mysql.Name)
+	}
+	// the server name is set to the host by the driver
+	key := fmt.Sprintf("%s.%s", mysql.Name, mysql.Namespace)
+	if st := mysql.Status.TLS; len(previous) > 0 && (st == nil || pod.Annotations[tlsSerialAnnotation] != st.SerialNumber) {
+		if !pool.AppendCertsFromPEM(previous) {
+			return "", fmt.Errorf("failed to parse previous CA certificate of MySQL %v/%v", mysql.Namespace, mysql.Name)
+		}
+		key += ".rollout"
+	}
+	if err := mysqldriver.RegisterTLSConfig(key, &tls.Config{RootCAs: pool}); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// podNameFromHost returns the pod name from the report_host of a member,
+// ie, "<pod>.<governing-service>.<namespace>".
+func podNameFromHost(host string) string {
+	return strings.Split(host, ".")[0]
+}
+
+// memberHost returns the peer address of the pod with the given name.
+func memberHost(mysql *api.MySQL, podName string) string {
+	return fmt.Sprintf("%s.%s.%s", podName, mysql.GoverningServiceName(), mysql.Namespace)
+}
+
+// quoteString quotes s as a MySQL string literal, for statements that don't accept placeholders.
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// quoteIdentifier quotes s as a MySQL identifier, eg, the name of a database or a table.
+func quoteIdentifier(s string) string {
+	return "`" + strings.Replace(s, "`", "``", -1) + "`"
+}
+
+// ensureMemberRoles labels each pod of a MySQL cluster with its role, so that the primary Service
+// selects the writable member(s) only and the replicas Service selects the secondaries. Pods that
+// are not in roles get no role and are selected by neither. If announcePrimary is set, an event is
+// recorded when a pod becomes the primary.
+func (c *Controller) ensureMemberRoles(mysql *api.MySQL, roles map[string]string, announcePrimary bool) error {
+	pods, err := c.podLister.Pods(mysql.Namespace).List(labels.SelectorFromSet(mysql.OffshootSelectors()))
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		role := roles[pod.Name]
+		if pod.Labels[api.LabelRole] == role {
+			continue
+		}
+		_, _, err := core_util.PatchPod(c.Client, pod, func(in *core.Pod) *core.Pod {
+			if role == "" {
+				delete(in.Labels, api.LabelRole)
+			} else {
+				in.Labels = core_util.UpsertMap(in.Labels, map[string]string{api.LabelRole: role})
+			}
+			return in
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("pod %v/%v of MySQL %v is labeled with role %q", pod.Namespace, pod.Name, mysql.Name, role)
+		if role == api.MySQLPodPrimary && announcePrimary {
+			c.recorder.Eventf(
+				mysql,
+				core.EventTypeNormal,
+				EventReasonPrimaryChanged,
+				`Pod "%v" is now the primary member`,
+				pod.Name,
+			)
+		}
+	}
+	return nil
+}
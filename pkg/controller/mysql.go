@@ -15,7 +15,6 @@ import (
 	kutil "kmodules.xyz/client-go"
 	dynamic_util "kmodules.xyz/client-go/dynamic"
 	meta_util "kmodules.xyz/client-go/meta"
-	storage "kmodules.xyz/objectstore-api/osm"
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
 	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
 	"kubedb.dev/apimachinery/pkg/eventer"
@@ -52,10 +51,21 @@ func (c *Controller) create(mysql *api.MySQL) error {
 		mysql.Status = my.Status
 	}
 
+	// conditions are recomputed on every pass and written to status on return,
+	// irrespective of which step the reconcile stopped at.
+	conditions := newConditionSet()
+	defer func() {
+		if err := c.updateConditions(mysql, conditions); err != nil {
+			log.Errorln(err)
+		}
+	}()
+
 	// create Governing Service
 	governingService, err := c.createMySQLGoverningService(mysql)
 	if err != nil {
-		return fmt.Errorf(`failed to create Service: "%v/%v". Reason: %v`, mysql.Namespace, governingService, err)
+		err = fmt.Errorf(`failed to create Service: "%v/%v". Reason: %v`, mysql.Namespace, governingService, err)
+		conditions.failed(api.MySQLConditionServiceReady, err)
+		return err
 	}
 	c.GoverningService = governingService
 
@@ -69,18 +79,62 @@ func (c *Controller) create(mysql *api.MySQL) error {
 	// ensure database Service
 	vt1, err := c.ensureService(mysql)
 	if err != nil {
+		conditions.failed(api.MySQLConditionServiceReady, err)
 		return err
 	}
+	if _, err := c.ensureReplicasService(mysql); err != nil {
+		conditions.failed(api.MySQLConditionServiceReady, err)
+		return err
+	}
+	conditions.ready(api.MySQLConditionServiceReady, fmt.Sprintf("Service %s is %s", mysql.ServiceName(), vt1))
 
 	if err := c.ensureDatabaseSecret(mysql); err != nil {
+		conditions.failed(api.MySQLConditionDatabaseSecretReady, err)
+		return err
+	}
+	if err := c.ensureReplicationSecret(mysql); err != nil {
+		conditions.failed(api.MySQLConditionDatabaseSecretReady, err)
+		return err
+	}
+	conditions.ready(api.MySQLConditionDatabaseSecretReady, fmt.Sprintf("Secret %s is ready", mysql.Spec.DatabaseSecret.SecretName))
+
+	// record a change of spec.version before the servers are restarted with the new version
+	if err := c.beginUpgrade(mysql); err != nil {
+		return err
+	}
+
+	// issue or renew the server certificate before the servers are started with it
+	if err := c.ensureTLS(mysql); err != nil {
+		return err
+	}
+
+	// render spec.config, and record the configuration that the servers are created with
+	if err := c.ensureConfigMap(mysql); err != nil {
+		return err
+	}
+	if err := c.initConfiguration(mysql); err != nil {
+		return err
+	}
+
+	// write the osm config that the archiver containers ship the binary logs with
+	if err := c.ensureBinlogArchiver(mysql); err != nil {
+		return err
+	}
+
+	if mysql.Spec.Halted {
+		return c.halt(mysql, conditions)
+	}
+	if err := c.resume(mysql, conditions); err != nil {
 		return err
 	}
 
 	// ensure database StatefulSet
 	vt2, err := c.ensureStatefulSet(mysql)
 	if err != nil {
+		conditions.failed(api.MySQLConditionStatefulSetReady, err)
 		return err
 	}
+	conditions.ready(api.MySQLConditionStatefulSetReady, fmt.Sprintf("StatefulSet %s is %s", mysql.OffshootName(), vt2))
 
 	if vt1 == kutil.VerbCreated && vt2 == kutil.VerbCreated {
 		c.recorder.Event(
@@ -98,36 +152,191 @@ func (c *Controller) create(mysql *api.MySQL) error {
 		)
 	}
 
+	// Not fatal, it is tried again in the next pass.
+	if err := c.expirePasswordRotation(mysql); err != nil {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeWarning,
+			eventer.EventReasonFailedToUpdate,
+			"Failed to rotate password. Reason: %v",
+			err,
+		)
+		log.Errorln(err)
+	}
+
+	// Until all the replicas are ready for the first time, return without blocking the worker.
+	// The MySQL is re-enqueued by the StatefulSet and Pod watchers as replicas become ready.
+	if !c.checkReplicasReady(mysql, conditions) && mysql.Status.Phase != api.DatabasePhaseRunning {
+		log.Debugf("MySQL %v/%v is waiting for the replicas to be ready", mysql.Namespace, mysql.Name)
+		return nil
+	}
+
+	// Not fatal, the other servers are still configured. Members are upgraded as they are restarted.
+	upgraded, err := c.ensureUpgrade(mysql)
+	if err != nil {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeWarning,
+			eventer.EventReasonFailedToUpdate,
+			"Failed to upgrade MySQL. Reason: %v",
+			err,
+		)
+		log.Errorln(err)
+	}
+
+	// Not fatal, changes of the configuration that need a restart are applied when the servers are restarted.
+	if err := c.ensureConfiguration(mysql); err != nil {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeWarning,
+			eventer.EventReasonFailedToUpdate,
+			"Failed to apply configuration. Reason: %v",
+			err,
+		)
+		log.Errorln(err)
+	}
+
+	// Not fatal, a failed rotation keeps the old password.
+	if err := c.ensurePasswordRotation(mysql); err != nil {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeWarning,
+			eventer.EventReasonFailedToUpdate,
+			"Failed to rotate password. Reason: %v",
+			err,
+		)
+		log.Errorln(err)
+	}
+
+	if mysql.IsReplication() {
+		if err := c.ensureReplication(mysql, conditions); err != nil {
+			c.recorder.Eventf(
+				mysql,
+				core.EventTypeWarning,
+				eventer.EventReasonFailedToUpdate,
+				"Failed to configure replication. Reason: %v",
+				err,
+			)
+			log.Errorln(err)
+			return err
+		}
+	} else {
+		conditions.remove(api.MySQLConditionReplicationHealthy)
+	}
+
+	if mysql.IsGroupReplication() {
+		// Not fatal, members may still be joining the group. Roles are
+		// updated again when the readiness of any member changes.
+		if err := c.ensureGroupMemberRoles(mysql); err != nil {
+			c.recorder.Eventf(
+				mysql,
+				core.EventTypeWarning,
+				eventer.EventReasonFailedToUpdate,
+				"Failed to update roles of group members. Reason: %v",
+				err,
+			)
+			log.Errorln(err)
+		}
+
+		// Not fatal, the credentials are only used when a member joins the group.
+		if err := c.ensureGroupRecoveryCredentials(mysql); err != nil {
+			c.recorder.Eventf(
+				mysql,
+				core.EventTypeWarning,
+				eventer.EventReasonFailedToUpdate,
+				"Failed to update credentials of group recovery channel. Reason: %v",
+				err,
+			)
+			log.Errorln(err)
+		}
+
+		// Changes of the pod template are rolled out by the operator, one member at a time.
+		rolledOut, err := c.ensureGroupRollout(mysql, conditions)
+		if err != nil {
+			c.recorder.Eventf(
+				mysql,
+				core.EventTypeWarning,
+				eventer.EventReasonFailedToUpdate,
+				"Failed to restart group members. Reason: %v",
+				err,
+			)
+			log.Errorln(err)
+		}
+
+		// A change of spec, ie, of spec.replicas or of the pod template, is not reported done
+		// until every member is updated and ONLINE. The MySQL is re-enqueued until then.
+		online := c.checkGroupMembersOnline(mysql, conditions)
+		if (!online || !rolledOut) && !isSpecObserved(mysql) {
+			log.Debugf("MySQL %v/%v is waiting for the group members to be updated and ONLINE", mysql.Namespace, mysql.Name)
+			c.requeueAfter(mysql, groupScalingCheckInterval)
+			return nil
+		}
+	} else {
+		conditions.remove(api.MySQLConditionGroupMembersOnline)
+		conditions.remove(api.MySQLConditionPodsUpdated)
+	}
+
+	// A change of spec.version is not reported done until every server is upgraded.
+	if !upgraded && !isSpecObserved(mysql) {
+		log.Debugf("MySQL %v/%v is waiting for the servers to be upgraded to version %v", mysql.Namespace, mysql.Name, mysql.Spec.Version)
+		return nil
+	}
+
 	// ensure appbinding before ensuring Restic scheduler and restore
 	_, err = c.ensureAppBinding(mysql)
 	if err != nil {
 		log.Errorln(err)
+		conditions.failed(api.MySQLConditionAppBindingReady, err)
 		return err
 	}
+	conditions.ready(api.MySQLConditionAppBindingReady, fmt.Sprintf("AppBinding %s is ready", mysql.AppBindingMeta().Name()))
 
 	if _, err := meta_util.GetString(mysql.Annotations, api.AnnotationInitialized); err == kutil.ErrNotFound &&
 		mysql.Spec.Init != nil &&
-		(mysql.Spec.Init.SnapshotSource != nil || mysql.Spec.Init.StashRestoreSession != nil) {
+		(mysql.Spec.Init.SnapshotSource != nil || mysql.Spec.Init.MySQLBinlog != nil || mysql.Spec.Init.MySQLClone != nil || mysql.Spec.Init.StashRestoreSession != nil) {
 
-		if mysql.Status.Phase == api.DatabasePhaseInitializing {
+		// a failed initJob is not retried
+		if st := mysql.Status.Clone; mysql.Spec.Init.MySQLClone != nil && st != nil && st.Phase == api.MySQLClonePhaseFailed {
+			conditions.failed(api.MySQLConditionInitialized, fmt.Errorf("failed to clone. Reason: %v", st.Reason))
+			return nil
+		}
+		if st := mysql.Status.Restore; st != nil && st.Phase == api.MySQLRestorePhaseFailed {
+			conditions.failed(api.MySQLConditionInitialized, fmt.Errorf("failed to restore. Reason: %v", st.Reason))
+			return nil
+		}
+
+		conditions.set(api.MySQLConditionInitialized, core.ConditionFalse, ConditionReasonInitializing, "database is being initialized")
+		// a copy is retried until its Job is created, which initializeFromClone checks for
+		if mysql.Status.Phase == api.DatabasePhaseInitializing && mysql.Spec.Init.MySQLClone == nil {
 			return nil
 		}
 
 		// add phase that database is being initialized
-		my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
-			in.Phase = api.DatabasePhaseInitializing
-			return in
-		})
-		if err != nil {
-			return err
+		if mysql.Status.Phase != api.DatabasePhaseInitializing {
+			my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+				in.Phase = api.DatabasePhaseInitializing
+				return in
+			})
+			if err != nil {
+				return err
+			}
+			mysql.Status = my.Status
 		}
-		mysql.Status = my.Status
 
 		init := mysql.Spec.Init
-		if init.SnapshotSource != nil {
+		if init.SnapshotSource != nil || init.MySQLBinlog != nil {
 			err = c.initializeFromSnapshot(mysql)
 			if err != nil {
-				return fmt.Errorf("failed to complete initialization. Reason: %v", err)
+				err = fmt.Errorf("failed to complete initialization. Reason: %v", err)
+				conditions.failed(api.MySQLConditionInitialized, err)
+				return err
+			}
+			return err
+		} else if init.MySQLClone != nil {
+			err = c.initializeFromClone(mysql)
+			if err != nil {
+				err = fmt.Errorf("failed to start copying. Reason: %v", err)
+				conditions.failed(api.MySQLConditionInitialized, err)
 			}
 			return err
 		} else if init.StashRestoreSession != nil {
@@ -136,6 +345,8 @@ func (c *Controller) create(mysql *api.MySQL) error {
 		}
 	}
 
+	conditions.ready(api.MySQLConditionInitialized, "database is initialized")
+
 	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
 		in.Phase = api.DatabasePhaseRunning
 		in.ObservedGeneration = types.NewIntHash(mysql.Generation, meta_util.GenerationHash(mysql))
@@ -155,7 +366,21 @@ func (c *Controller) create(mysql *api.MySQL) error {
 			err.Error(),
 		)
 		log.Errorln(err)
+		conditions.failed(api.MySQLConditionBackupScheduled, err)
 		// Don't return error. Continue processing rest.
+	} else if mysql.Spec.BackupSchedule != nil {
+		conditions.ready(api.MySQLConditionBackupScheduled, fmt.Sprintf("backup is scheduled with %q", mysql.Spec.BackupSchedule.CronExpression))
+	} else {
+		conditions.remove(api.MySQLConditionBackupScheduled)
+	}
+
+	// Not fatal, the binary logs are shipped by the archiver containers. The failure is reported in status.
+	if err := c.syncBinlogArchiveStatus(mysql); err != nil {
+		log.Errorln(err)
+	}
+
+	if mysql.Spec.Monitor == nil {
+		conditions.remove(api.MySQLConditionMonitoringReady)
 	}
 
 	// ensure StatsService for desired monitoring
@@ -168,6 +393,7 @@ func (c *Controller) create(mysql *api.MySQL) error {
 			err,
 		)
 		log.Errorln(err)
+		conditions.failed(api.MySQLConditionMonitoringReady, err)
 		return nil
 	}
 
@@ -180,8 +406,12 @@ func (c *Controller) create(mysql *api.MySQL) error {
 			err,
 		)
 		log.Errorln(err)
+		conditions.failed(api.MySQLConditionMonitoringReady, err)
 		return nil
 	}
+	if mysql.Spec.Monitor != nil {
+		conditions.ready(api.MySQLConditionMonitoringReady, fmt.Sprintf("monitoring is configured with agent %s", mysql.Spec.Monitor.Agent))
+	}
 
 	return nil
 }
@@ -204,15 +434,19 @@ func (c *Controller) ensureBackupScheduler(mysql *api.MySQL) error {
 }
 
 func (c *Controller) initializeFromSnapshot(mysql *api.MySQL) error {
-	snapshotSource := mysql.Spec.Init.SnapshotSource
-	jobName := fmt.Sprintf("%s-%s", api.DatabaseNamePrefix, snapshotSource.Name)
-	if _, err := c.Client.BatchV1().Jobs(snapshotSource.Namespace).Get(jobName, metav1.GetOptions{}); err != nil {
+	snapshotSource := restoreSnapshotSource(mysql)
+	jobName := restoreJobName(mysql)
+	if _, err := c.Client.BatchV1().Jobs(mysql.Namespace).Get(jobName, metav1.GetOptions{}); err != nil {
 		if !kerr.IsNotFound(err) {
 			return err
 		}
 	} else {
 		return nil
 	}
+	// a gone Job is failed by the restoreJob
+	if st := mysql.Status.Restore; st != nil && st.Phase == api.MySQLRestorePhaseRunning {
+		return nil
+	}
 
 	// Event for notification that kubernetes objects are creating
 	c.recorder.Eventf(
@@ -231,26 +465,24 @@ func (c *Controller) initializeFromSnapshot(mysql *api.MySQL) error {
 	if err != nil {
 		return err
 	}
-
-	secret, err := storage.NewOSMSecret(c.Client, snapshot.OSMSecretName(), snapshot.Namespace, snapshot.Spec.Backend)
-	if err != nil {
-		return err
+	if isPhysicalSnapshot(snapshot) {
+		if mysql.Spec.Init.MySQLBinlog != nil {
+			return fmt.Errorf("binary logs can't be replayed on Physical Snapshot %v/%v", snapshot.Namespace, snapshot.Name)
+		}
+		// restored by the init container of the StatefulSet, before the servers were started
+		return c.completePhysicalRestore(mysql)
 	}
-	_, err = c.Client.CoreV1().Secrets(secret.Namespace).Create(secret)
-	if err != nil && !kerr.IsAlreadyExists(err) {
+
+	if err := c.ensureRestoreOSMSecret(mysql, snapshot); err != nil {
 		return err
 	}
 
+	// the Job is owned by the MySQL only, so that it is not garbage collected with the Snapshot
 	job, err := c.createRestoreJob(mysql, snapshot)
 	if err != nil {
 		return err
 	}
-
-	if err := c.SetJobOwnerReference(snapshot, job); err != nil {
-		return err
-	}
-
-	return nil
+	return c.startRestore(mysql, snapshot, job)
 }
 
 func (c *Controller) terminate(mysql *api.MySQL) error {
@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/appscode/go/encoding/json/types"
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	core_informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	kutil "kmodules.xyz/client-go"
+	meta_util "kmodules.xyz/client-go/meta"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+const (
+	EventReasonDriftDetected  = "DriftDetected"
+	EventReasonRepaired       = "Repaired"
+	EventReasonRepairFailed   = "RepairFailed"
+	EventReasonPrimaryChanged = "PrimaryChanged"
+)
+
+// initOffshootWatchers watches the Services, Secrets and PersistentVolumeClaims owned by
+// MySQL objects, so that drift is corrected as soon as it happens instead of on the next resync.
+// Offshoots are selected by the labels set from OffshootSelectors.
+func (c *Controller) initOffshootWatchers() {
+	c.watchOffshoot(&core.Service{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return core_informers.NewFilteredServiceInformer(
+			client,
+			c.WatchNamespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			c.tweakListOptions,
+		)
+	})
+	c.watchOffshoot(&core.Secret{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return core_informers.NewFilteredSecretInformer(
+			client,
+			c.WatchNamespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			c.tweakListOptions,
+		)
+	})
+	c.watchOffshoot(&core.PersistentVolumeClaim{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return core_informers.NewFilteredPersistentVolumeClaimInformer(
+			client,
+			c.WatchNamespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			c.tweakListOptions,
+		)
+	})
+}
+
+func (c *Controller) watchOffshoot(obj runtime.Object, newInformer func(kubernetes.Interface, time.Duration) cache.SharedIndexInformer) {
+	informer := c.KubeInformerFactory.InformerFor(obj, newInformer)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			o1, ok1 := oldObj.(metav1.Object)
+			o2, ok2 := newObj.(metav1.Object)
+			if ok1 && ok2 && o1.GetResourceVersion() == o2.GetResourceVersion() {
+				return
+			}
+			c.enqueueOwnerMySQL(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.recordOffshootDeleted(obj)
+			c.enqueueOwnerMySQL(obj)
+		},
+	})
+}
+
+// offshootRef identifies an offshoot of a MySQL.
+type offshootRef struct {
+	kind string
+	name string
+}
+
+// recordOffshootDeleted records an event on the owning MySQL when one of its offshoots is deleted,
+// and remembers the offshoot, so that reportOffshootRepairs can report whether it was recreated.
+func (c *Controller) recordOffshootDeleted(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	o, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+	mysql, err := c.myLister.MySQLs(o.GetNamespace()).Get(o.GetLabels()[api.LabelDatabaseName])
+	if err != nil || mysql.DeletionTimestamp != nil {
+		return
+	}
+	kind := "object"
+	if ro, ok := obj.(runtime.Object); ok {
+		kind = offshootKind(ro)
+	}
+	c.recorder.Eventf(
+		mysql,
+		core.EventTypeWarning,
+		EventReasonDriftDetected,
+		`%s "%s/%s" was deleted`,
+		kind,
+		o.GetNamespace(),
+		o.GetName(),
+	)
+
+	key := mysql.Namespace + "/" + mysql.Name
+	ref := offshootRef{kind: kind, name: o.GetName()}
+	c.deletedOffshootsMu.Lock()
+	defer c.deletedOffshootsMu.Unlock()
+	if c.deletedOffshoots == nil {
+		c.deletedOffshoots = map[string][]offshootRef{}
+	}
+	for _, r := range c.deletedOffshoots[key] {
+		if r == ref {
+			return
+		}
+	}
+	c.deletedOffshoots[key] = append(c.deletedOffshoots[key], ref)
+}
+
+// isOffshootDeleted reports whether the offshoot was deleted and has not been reported as recreated yet.
+func (c *Controller) isOffshootDeleted(mysql *api.MySQL, kind, name string) bool {
+	c.deletedOffshootsMu.Lock()
+	defer c.deletedOffshootsMu.Unlock()
+	for _, r := range c.deletedOffshoots[mysql.Namespace+"/"+mysql.Name] {
+		if r.kind == kind && r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// reportOffshootRepairs records an event for each deleted offshoot of mysql, once mysql was reconciled
+// with result err. An offshoot that exists again was recreated. If the reconciliation failed, the
+// offshoots are reported as not repaired, and checked again on the next one. A missing Service or
+// Secret was not meant to be recreated, eg, the stats Service of a MySQL without monitoring, while a
+// PersistentVolumeClaim is only recreated along with its pod.
+func (c *Controller) reportOffshootRepairs(mysql *api.MySQL, err error) {
+	key := mysql.Namespace + "/" + mysql.Name
+	c.deletedOffshootsMu.Lock()
+	refs := c.deletedOffshoots[key]
+	delete(c.deletedOffshoots, key)
+	c.deletedOffshootsMu.Unlock()
+
+	var pending []offshootRef
+	for _, ref := range refs {
+		if err != nil {
+			c.recorder.Eventf(
+				mysql,
+				core.EventTypeWarning,
+				EventReasonRepairFailed,
+				`Failed to recreate deleted %s "%s/%s". Reason: %v`,
+				ref.kind,
+				mysql.Namespace,
+				ref.name,
+				err,
+			)
+			pending = append(pending, ref)
+			continue
+		}
+
+		exists, gerr := c.offshootExists(mysql.Namespace, ref)
+		switch {
+		case gerr != nil:
+			log.Errorln(gerr)
+			pending = append(pending, ref)
+		case exists:
+			c.recorder.Eventf(
+				mysql,
+				core.EventTypeNormal,
+				EventReasonRepaired,
+				`Recreated deleted %s "%s/%s"`,
+				ref.kind,
+				mysql.Namespace,
+				ref.name,
+			)
+		case ref.kind == "PersistentVolumeClaim":
+			pending = append(pending, ref)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	c.deletedOffshootsMu.Lock()
+	defer c.deletedOffshootsMu.Unlock()
+	if c.deletedOffshoots == nil {
+		c.deletedOffshoots = map[string][]offshootRef{}
+	}
+	c.deletedOffshoots[key] = append(pending, c.deletedOffshoots[key]...)
+}
+
+func (c *Controller) offshootExists(namespace string, ref offshootRef) (bool, error) {
+	var err error
+	switch ref.kind {
+	case "Service":
+		_, err = c.Client.CoreV1().Services(namespace).Get(ref.name, metav1.GetOptions{})
+	case "Secret":
+		_, err = c.Client.CoreV1().Secrets(namespace).Get(ref.name, metav1.GetOptions{})
+	case "PersistentVolumeClaim":
+		_, err = c.Client.CoreV1().PersistentVolumeClaims(namespace).Get(ref.name, metav1.GetOptions{})
+	default:
+		return false, nil
+	}
+	if kerr.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func offshootKind(obj runtime.Object) string {
+	switch obj.(type) {
+	case *core.Service:
+		return "Service"
+	case *core.Secret:
+		return "Secret"
+	case *core.PersistentVolumeClaim:
+		return "PersistentVolumeClaim"
+	}
+	return obj.GetObjectKind().GroupVersionKind().Kind
+}
+
+// isSpecObserved returns true if the current spec of MySQL has already been reconciled to Running.
+// Any offshoot created or patched after that was not caused by a spec change, but by drift.
+func isSpecObserved(mysql *api.MySQL) bool {
+	return mysql.Status.Phase == api.DatabasePhaseRunning &&
+		mysql.Status.ObservedGeneration != nil &&
+		mysql.Status.ObservedGeneration.Equal(types.NewIntHash(mysql.Generation, meta_util.GenerationHash(mysql)))
+}
+
+// recordRepair records an event when an offshoot had to be recreated or patched back without any spec change.
+// A deleted offshoot that was recreated is reported by reportOffshootRepairs instead.
+func (c *Controller) recordRepair(mysql *api.MySQL, kind, name string, vt kutil.VerbType) {
+	if vt == kutil.VerbUnchanged || !isSpecObserved(mysql) {
+		return
+	}
+	if vt == kutil.VerbCreated && c.isOffshootDeleted(mysql, kind, name) {
+		return
+	}
+	c.recorder.Eventf(
+		mysql,
+		core.EventTypeNormal,
+		EventReasonRepaired,
+		`Repaired drifted %s "%s/%s" (%s)`,
+		kind,
+		mysql.Namespace,
+		name,
+		vt,
+	)
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	amc "kubedb.dev/apimachinery/pkg/controller"
+)
+
+func TestReportOffshootRepairs(t *testing.T) {
+	mysql := &api.MySQL{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "ns"}}
+	recorder := record.NewFakeRecorder(10)
+	c := &Controller{
+		Controller: &amc.Controller{Client: fake.NewSimpleClientset(
+			&core.Service{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "ns"}},
+		)},
+		recorder: recorder,
+		deletedOffshoots: map[string][]offshootRef{
+			"ns/demo": {
+				{kind: "Service", name: "demo"},
+				{kind: "Service", name: "demo-stats"},
+				{kind: "PersistentVolumeClaim", name: "data-demo-0"},
+			},
+		},
+	}
+	events := func() []string {
+		var out []string
+		for len(recorder.Events) > 0 {
+			out = append(out, <-recorder.Events)
+		}
+		return out
+	}
+
+	c.reportOffshootRepairs(mysql, errors.New("secret not found"))
+	if e := events(); len(e) != 3 || !strings.HasPrefix(e[0], "Warning RepairFailed Failed to recreate deleted Service \"ns/demo\"") {
+		t.Errorf("expected 3 failures, got %v", e)
+	}
+	if !c.isOffshootDeleted(mysql, "Service", "demo") {
+		t.Error("expected Service to be checked again after a failure")
+	}
+
+	c.reportOffshootRepairs(mysql, nil)
+	if e := events(); len(e) != 1 || e[0] != `Normal Repaired Recreated deleted Service "ns/demo"` {
+		t.Errorf("expected Service to be reported as recreated, got %v", e)
+	}
+	if c.isOffshootDeleted(mysql, "Service", "demo") || c.isOffshootDeleted(mysql, "Service", "demo-stats") {
+		t.Error("expected Services not to be checked again")
+	}
+	if !c.isOffshootDeleted(mysql, "PersistentVolumeClaim", "data-demo-0") {
+		t.Error("expected PersistentVolumeClaim to be checked again until its pod recreates it")
+	}
+}
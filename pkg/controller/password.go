@@ -0,0 +1,474 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	"github.com/coreos/go-semver/semver"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/go-xorm/xorm"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+	mona "kmodules.xyz/monitoring-agent-api/api/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+)
+
+const (
+	EventReasonPasswordRotated        = "PasswordRotated"
+	EventReasonPasswordRotationFailed = "PasswordRotationFailed"
+
+	// annotation on the MySQL that requests a rotation of the root password. Setting it to a new value,
+	// eg, the current time, starts a rotation.
+	rotatePasswordAnnotation = api.MySQLKey + "/rotate-password"
+	// annotation on the pod template with the time the root password was last rotated
+	passwordRotatedAnnotation = api.MySQLKey + "/password-rotated"
+
+	// key of the database secret with the new root password while it is being set on the servers
+	KeyMySQLPendingPassword = "pending-password"
+
+	// how long the servers have to accept the new password before the rotation is rolled back
+	passwordRotationTimeout = 5 * time.Minute
+	// how often the servers are checked for the new password, eg, until it is replicated
+	passwordRotationCheckInterval = 5 * time.Second
+
+	// ref: https://dev.mysql.com/doc/refman/5.7/en/server-error-reference.html#error_er_parse_error
+	errParse = 1064
+)
+
+// ensurePasswordRotation rotates the root password when the rotate-password annotation of the MySQL
+// is set to a new value:
+//
+//   - a new password is generated and kept in the database secret along with the current one, so that
+//     the rotation is resumed, or rolled back, if the operator is restarted
+//   - the root user is altered on the writable servers, from where the change is replicated to the
+//     other servers. With MySQL 8.0.14 or later, the servers keep accepting the old password as well.
+//   - once every server accepts the new password, it replaces the old one in the database secret
+//   - if the exporter or the health checks read the password from their environment, the time of the
+//     rotation is stamped on the pod template, so that the pods are restarted, and they use the new
+//     password. Otherwise the pods are left running. Then the old password is discarded.
+//
+// If the new password can't be set on every server in time, the old password is restored. A cluster
+// is not rotated if its servers don't support dual passwords, and the pods read the password from
+// their environment: the new password is replicated to every server at once, so the probes of every
+// pod would fail, and the pods would be restarted at the same time.
+func (c *Controller) ensurePasswordRotation(mysql *api.MySQL) error {
+	st := mysql.Status.PasswordRotation
+	if st != nil {
+		switch st.Phase {
+		case api.MySQLPasswordRotationPhaseRotating:
+			return c.rotatePassword(mysql)
+		case api.MySQLPasswordRotationPhaseRestarting:
+			return c.completePasswordRotation(mysql)
+		}
+	}
+	request := mysql.Annotations[rotatePasswordAnnotation]
+	if request == "" || (st != nil && st.Request == request) {
+		return nil
+	}
+	return c.beginPasswordRotation(mysql, request)
+}
+
+func (c *Controller) beginPasswordRotation(mysql *api.MySQL, request string) error {
+	if mysql.HasMemberRoles() && passwordReadFromEnv(mysql) {
+		mysqlVersion, err := c.ExtClient.CatalogV1alpha1().MySQLVersions().Get(string(mysql.Spec.Version), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !supportsDualPasswords(mysqlVersion.Spec.Version) {
+			if err := c.updatePasswordRotationStatus(mysql, &api.MySQLPasswordRotationStatus{Request: request}); err != nil {
+				return err
+			}
+			return c.failPasswordRotation(mysql, fmt.Errorf("version %v has no dual passwords, so the password of a cluster whose pods read it from their environment can't be rotated without restarting every pod at once",
+				mysqlVersion.Spec.Version))
+		}
+	}
+
+	password := generatePassword()
+
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(mysql.Spec.DatabaseSecret.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	_, _, err = core_util.PatchSecret(c.Client, secret, func(in *core.Secret) *core.Secret {
+		if in.Data == nil {
+			in.Data = map[string][]byte{}
+		}
+		in.Data[KeyMySQLPendingPassword] = []byte(password)
+		return in
+	})
+	if err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	st := &api.MySQLPasswordRotationStatus{
+		Request:   request,
+		Phase:     api.MySQLPasswordRotationPhaseRotating,
+		StartTime: &now,
+	}
+	if mysql.Status.PasswordRotation != nil {
+		st.LastRotationTime = mysql.Status.PasswordRotation.LastRotationTime
+	}
+	if err := c.updatePasswordRotationStatus(mysql, st); err != nil {
+		return err
+	}
+	return c.rotatePassword(mysql)
+}
+
+// rotatePassword sets the pending password of the database secret on the servers, and
+// replaces the current password with it once every server accepts it.
+func (c *Controller) rotatePassword(mysql *api.MySQL) error {
+	st := mysql.Status.PasswordRotation
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(mysql.Spec.DatabaseSecret.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	user := mysqlUser
+	if v, ok := secret.Data[KeyMySQLUser]; ok {
+		user = string(v)
+	}
+	oldPassword := string(secret.Data[KeyMySQLPassword])
+	newPassword, ok := secret.Data[KeyMySQLPendingPassword]
+	if !ok {
+		return c.failPasswordRotation(mysql, fmt.Errorf(`secret "%v/%v" does not have key %q`, secret.Namespace, secret.Name, KeyMySQLPendingPassword))
+	}
+
+	hosts, err := c.writableHosts(mysql)
+	if err != nil {
+		return err
+	}
+	if passwordRotationExpired(st) {
+		return c.rollbackPasswordRotation(mysql, hosts, user, oldPassword, string(newPassword),
+			fmt.Errorf("servers did not accept the new password within %v", passwordRotationTimeout))
+	}
+	for _, host := range hosts {
+		if err := c.setRootPassword(mysql, host, user, oldPassword, string(newPassword)); err != nil {
+			return c.rollbackPasswordRotation(mysql, hosts, user, oldPassword, string(newPassword),
+				fmt.Errorf("failed to set the new password on %v. Reason: %v", host, err))
+		}
+	}
+	// the other servers accept the new password once the change is replicated to them
+	for i := 0; i < int(types.Int32(mysql.Spec.Replicas)); i++ {
+		if err := c.checkCredentials(mysql, mysql.PeerName(i), user, string(newPassword)); err != nil {
+			log.Infof("MySQL %v/%v is waiting for server %v to accept the new password. Reason: %v", mysql.Namespace, mysql.Name, mysql.PeerName(i), err)
+			c.requeueAfter(mysql, passwordRotationCheckInterval)
+			return nil
+		}
+	}
+	// the servers keep accepting the old password if they support dual passwords
+	retained := c.checkCredentials(mysql, hosts[0], user, oldPassword) == nil
+
+	// The current password is replaced in a single update, so that jobs and pods started from
+	// now on use the new password, and those started before use the old one.
+	secret.Data[KeyMySQLPassword] = newPassword
+	delete(secret.Data, KeyMySQLPendingPassword)
+	if _, err := c.Client.CoreV1().Secrets(secret.Namespace).Update(secret); err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	if err := c.updatePasswordRotationStatus(mysql, &api.MySQLPasswordRotationStatus{
+		Request:             st.Request,
+		Phase:               api.MySQLPasswordRotationPhaseRestarting,
+		StartTime:           st.StartTime,
+		LastRotationTime:    &now,
+		OldPasswordRetained: retained,
+	}); err != nil {
+		return err
+	}
+	if passwordReadFromEnv(mysql) {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			EventReasonPasswordRotated,
+			`Rotated password of user "%v", restarting the pods to use it`,
+			user,
+		)
+	} else {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			EventReasonPasswordRotated,
+			`Rotated password of user "%v"`,
+			user,
+		)
+	}
+	// the pod template is updated in the next pass
+	c.requeueAfter(mysql, 0)
+	return nil
+}
+
+// expirePasswordRotation rolls back a rotation that did not complete in time. It is called while
+// servers are not ready too, eg, when a pod was restarted during the rotation and its probes fail with
+// the old password, which would otherwise keep the rotation from ever completing or being rolled back.
+func (c *Controller) expirePasswordRotation(mysql *api.MySQL) error {
+	st := mysql.Status.PasswordRotation
+	if st == nil || st.Phase != api.MySQLPasswordRotationPhaseRotating || !passwordRotationExpired(st) {
+		return nil
+	}
+	return c.rotatePassword(mysql)
+}
+
+func passwordRotationExpired(st *api.MySQLPasswordRotationStatus) bool {
+	return st.StartTime != nil && time.Since(st.StartTime.Time) > passwordRotationTimeout
+}
+
+// supportsDualPasswords reports whether servers of version keep accepting the old password of a
+// user, when it is altered with RETAIN CURRENT PASSWORD, ie, MySQL 8.0.14 or later.
+func supportsDualPasswords(version string) bool {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return !v.LessThan(*semver.New("8.0.14"))
+}
+
+// completePasswordRotation discards the old password, if the servers retained it, once every
+// pod is restarted with the new password, if the pods read it from their environment.
+func (c *Controller) completePasswordRotation(mysql *api.MySQL) error {
+	st := mysql.Status.PasswordRotation
+	if passwordReadFromEnv(mysql) && !c.isRolledOut(mysql, passwordRotatedAnnotation, passwordRotatedValue(st)) {
+		// re-enqueued by the StatefulSet watcher as pods are restarted
+		return nil
+	}
+	if st.OldPasswordRetained {
+		user, password, err := c.getRootCredentials(mysql)
+		if err != nil {
+			return err
+		}
+		hosts, err := c.writableHosts(mysql)
+		if err != nil {
+			return err
+		}
+		for _, host := range hosts {
+			en, err := c.newMemberClientWithCredentials(mysql, host, user, password)
+			if err != nil {
+				return err
+			}
+			err = discardOldPassword(en, user)
+			en.Close()
+			if err != nil {
+				return fmt.Errorf("failed to discard the old password on %v. Reason: %v", host, err)
+			}
+		}
+	}
+
+	next := st.DeepCopy()
+	next.Phase = api.MySQLPasswordRotationPhaseSucceeded
+	next.OldPasswordRetained = false
+	return c.updatePasswordRotationStatus(mysql, next)
+}
+
+// rollbackPasswordRotation restores the old password on the servers, and removes the new password
+// from the database secret. If the old password can't be restored, it is tried again in the next pass.
+func (c *Controller) rollbackPasswordRotation(mysql *api.MySQL, hosts []string, user, oldPassword, newPassword string, cause error) error {
+	for _, host := range hosts {
+		if err := c.restoreRootPassword(mysql, host, user, oldPassword, newPassword); err != nil {
+			return fmt.Errorf("failed to restore the old password on %v after rotation failed. Reason: %v, rotation failed with: %v", host, err, cause)
+		}
+	}
+
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(mysql.Spec.DatabaseSecret.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	_, _, err = core_util.PatchSecret(c.Client, secret, func(in *core.Secret) *core.Secret {
+		delete(in.Data, KeyMySQLPendingPassword)
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	return c.failPasswordRotation(mysql, cause)
+}
+
+func (c *Controller) failPasswordRotation(mysql *api.MySQL, cause error) error {
+	next := mysql.Status.PasswordRotation.DeepCopy()
+	next.Phase = api.MySQLPasswordRotationPhaseFailed
+	next.Reason = cause.Error()
+	if err := c.updatePasswordRotationStatus(mysql, next); err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		mysql,
+		core.EventTypeWarning,
+		EventReasonPasswordRotationFailed,
+		"Failed to rotate password, the old password is kept. Reason: %v",
+		cause,
+	)
+	return nil
+}
+
+func (c *Controller) updatePasswordRotationStatus(mysql *api.MySQL, st *api.MySQLPasswordRotationStatus) error {
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		in.PasswordRotation = st
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+	return nil
+}
+
+// writableHosts returns the servers that the root user is altered on: the primary of a replication group,
+// the source of a replication cluster, or every server otherwise, as standalone servers don't replicate.
+func (c *Controller) writableHosts(mysql *api.MySQL) ([]string, error) {
+	switch {
+	case mysql.IsGroupReplication():
+		members, err := c.getGroupMembers(mysql)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			if m.State == memberStateOnline && (m.Primary || mysql.IsMultiPrimary()) {
+				return []string{memberHost(mysql, podNameFromHost(m.Host))}, nil
+			}
+		}
+		return nil, fmt.Errorf("no primary found in replication group for MySQL %v/%v", mysql.Namespace, mysql.Name)
+	case mysql.IsReplication():
+		return []string{memberHost(mysql, replicationSource(mysql))}, nil
+	}
+	var hosts []string
+	for i := 0; i < int(types.Int32(mysql.Spec.Replicas)); i++ {
+		hosts = append(hosts, mysql.PeerName(i))
+	}
+	return hosts, nil
+}
+
+// setRootPassword alters the root user at every host it is defined for, eg, "%" and "localhost".
+// The current password is retained where dual passwords are supported. Nothing is done if the
+// server already accepts the new password, so that it is not retained in place of the old one.
+func (c *Controller) setRootPassword(mysql *api.MySQL, host, user, oldPassword, newPassword string) error {
+	if c.checkCredentials(mysql, host, user, newPassword) == nil {
+		return nil
+	}
+	en, err := c.newMemberClientWithCredentials(mysql, host, user, oldPassword)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	hosts, err := userHosts(en, user)
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		stmt := fmt.Sprintf("ALTER USER %s@%s IDENTIFIED BY %s", quoteString(user), quoteString(h), quoteString(newPassword))
+		_, err := en.Exec(stmt + " RETAIN CURRENT PASSWORD")
+		if me, ok := err.(*mysqldriver.MySQLError); ok && me.Number == errParse {
+			// dual passwords are supported since MySQL 8.0.14
+			_, err = en.Exec(stmt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreRootPassword sets the old password of the root user at every host it is defined for.
+func (c *Controller) restoreRootPassword(mysql *api.MySQL, host, user, oldPassword, newPassword string) error {
+	en, err := c.newMemberClientWithCredentials(mysql, host, user, oldPassword)
+	if err != nil {
+		return err
+	}
+	if err := en.Ping(); err != nil {
+		en.Close()
+		if en, err = c.newMemberClientWithCredentials(mysql, host, user, newPassword); err != nil {
+			return err
+		}
+	}
+	defer en.Close()
+
+	hosts, err := userHosts(en, user)
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		if _, err := en.Exec(fmt.Sprintf("ALTER USER %s@%s IDENTIFIED BY %s", quoteString(user), quoteString(h), quoteString(oldPassword))); err != nil {
+			return err
+		}
+	}
+	return discardOldPassword(en, user)
+}
+
+// discardOldPassword makes the root user accept its current password only, at every host it is defined for.
+func discardOldPassword(en *xorm.Engine, user string) error {
+	hosts, err := userHosts(en, user)
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		_, err := en.Exec(fmt.Sprintf("ALTER USER %s@%s DISCARD OLD PASSWORD", quoteString(user), quoteString(h)))
+		if me, ok := err.(*mysqldriver.MySQLError); ok && me.Number == errParse {
+			// no dual passwords before MySQL 8.0.14, nothing to discard
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func userHosts(en *xorm.Engine, user string) ([]string, error) {
+	rows, err := en.QueryString("SELECT host FROM mysql.user WHERE user = ?", user)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, 0, len(rows))
+	for _, row := range rows {
+		hosts = append(hosts, row["host"])
+	}
+	return hosts, nil
+}
+
+// checkCredentials returns an error if the server at host doesn't accept the credentials.
+func (c *Controller) checkCredentials(mysql *api.MySQL, host, user, password string) error {
+	en, err := c.newMemberClientWithCredentials(mysql, host, user, password)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+	return en.Ping()
+}
+
+// passwordReadFromEnv reports whether a container of the MySQL pods keeps reading the root password from
+// its environment after it started, ie, the exporter, or a probe or lifecycle hook that uses
+// MYSQL_ROOT_PASSWORD. The environment is only updated when the pods are restarted. The servers, and the
+// operator, don't need a restart to use a new password.
+func passwordReadFromEnv(mysql *api.MySQL) bool {
+	if mysql.GetMonitoringVendor() == mona.VendorPrometheus {
+		return true
+	}
+	spec := mysql.Spec.PodTemplate.Spec
+	handlers := []*core.Handler{}
+	for _, probe := range []*core.Probe{spec.LivenessProbe, spec.ReadinessProbe} {
+		if probe != nil {
+			handlers = append(handlers, &probe.Handler)
+		}
+	}
+	if spec.Lifecycle != nil {
+		handlers = append(handlers, spec.Lifecycle.PostStart, spec.Lifecycle.PreStop)
+	}
+	for _, h := range handlers {
+		if h != nil && h.Exec != nil && strings.Contains(strings.Join(h.Exec.Command, " "), "MYSQL_ROOT_PASSWORD") {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordRotatedValue returns the value of the annotation stamped on the pod template for a rotation.
+func passwordRotatedValue(st *api.MySQLPasswordRotationStatus) string {
+	if st.LastRotationTime == nil {
+		return ""
+	}
+	return st.LastRotationTime.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	mona "kmodules.xyz/monitoring-agent-api/api/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestPodTemplateAnnotationsPasswordRotated(t *testing.T) {
+	mysql := &api.MySQL{}
+	if _, ok := podTemplateAnnotations(mysql)[passwordRotatedAnnotation]; ok {
+		t.Errorf("expected no %v annotation before the password is rotated", passwordRotatedAnnotation)
+	}
+
+	// a rotation in progress doesn't restart the pods until the database secret has the new password
+	mysql.Status.PasswordRotation = &api.MySQLPasswordRotationStatus{
+		Request: "1",
+		Phase:   api.MySQLPasswordRotationPhaseRotating,
+	}
+	if _, ok := podTemplateAnnotations(mysql)[passwordRotatedAnnotation]; ok {
+		t.Errorf("expected no %v annotation while the password is being rotated", passwordRotatedAnnotation)
+	}
+
+	// nothing reads the password from the environment, so the pods are not restarted
+	rotated := metav1.NewTime(time.Date(2019, 10, 1, 12, 0, 0, 0, time.FixedZone("", 3600)))
+	mysql.Status.PasswordRotation.Phase = api.MySQLPasswordRotationPhaseRestarting
+	mysql.Status.PasswordRotation.LastRotationTime = &rotated
+	if _, ok := podTemplateAnnotations(mysql)[passwordRotatedAnnotation]; ok {
+		t.Errorf("expected no %v annotation without the exporter or probes using the password", passwordRotatedAnnotation)
+	}
+
+	mysql.Spec.Monitor = &mona.AgentSpec{Agent: mona.AgentPrometheusBuiltin}
+	if v := podTemplateAnnotations(mysql)[passwordRotatedAnnotation]; v != "2019-10-01T11:00:00Z" {
+		t.Errorf("expected %v annotation %q, got %q", passwordRotatedAnnotation, "2019-10-01T11:00:00Z", v)
+	}
+}
+
+func TestPasswordReadFromEnv(t *testing.T) {
+	exec := func(command string) *core.Probe {
+		return &core.Probe{Handler: core.Handler{Exec: &core.ExecAction{Command: []string{"bash", "-c", command}}}}
+	}
+	cases := []struct {
+		name     string
+		monitor  *mona.AgentSpec
+		probe    *core.Probe
+		expected bool
+	}{
+		{name: "nothing"},
+		{name: "exporter", monitor: &mona.AgentSpec{Agent: mona.AgentPrometheusBuiltin}, expected: true},
+		{name: "probe with password", probe: exec("export MYSQL_PWD=${MYSQL_ROOT_PASSWORD}; mysql -e 'select 1'"), expected: true},
+		{name: "probe without password", probe: exec("mysqladmin ping --socket=/var/run/mysqld/mysqld.sock")},
+		{name: "tcp probe", probe: &core.Probe{Handler: core.Handler{TCPSocket: &core.TCPSocketAction{}}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mysql := &api.MySQL{}
+			mysql.Spec.Monitor = c.monitor
+			mysql.Spec.PodTemplate.Spec.ReadinessProbe = c.probe
+			if v := passwordReadFromEnv(mysql); v != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, v)
+			}
+		})
+	}
+}
+
+func TestSupportsDualPasswords(t *testing.T) {
+	cases := map[string]bool{
+		"5.7.25": false,
+		"8.0.3":  false,
+		"8.0.14": true,
+		"8.0.17": true,
+		"8.0":    false,
+	}
+	for version, expected := range cases {
+		if got := supportsDualPasswords(version); got != expected {
+			t.Errorf("version %v: expected %v, got %v", version, expected, got)
+		}
+	}
+}
+
+func TestPasswordRotationExpired(t *testing.T) {
+	started := metav1.NewTime(time.Now().Add(-passwordRotationTimeout - time.Minute))
+	if !passwordRotationExpired(&api.MySQLPasswordRotationStatus{StartTime: &started}) {
+		t.Error("expected rotation to be expired")
+	}
+	started = metav1.Now()
+	if passwordRotationExpired(&api.MySQLPasswordRotationStatus{StartTime: &started}) {
+		t.Error("expected rotation not to be expired")
+	}
+}
@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/appscode/go/types"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kutil "kmodules.xyz/client-go"
+	core_util "kmodules.xyz/client-go/core/v1"
+	meta_util "kmodules.xyz/client-go/meta"
+	"kmodules.xyz/client-go/tools/analytics"
+	storage "kmodules.xyz/objectstore-api/osm"
+	catalog "kubedb.dev/apimachinery/apis/catalog/v1alpha1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/pkg/eventer"
+)
+
+const (
+	// ops of mysql-tools for Snapshots with the Physical backup method
+	opBackupPhysical  = "backup-physical"
+	opRestorePhysical = "restore-physical"
+
+	physicalRestoreContainerName = "restore-physical"
+
+	// volumes of the restore init container in the StatefulSet
+	physicalRestoreOSMVolumeName           = "restore-osmconfig"
+	physicalRestoreLocalVolumeName         = "restore-local"
+	physicalRestoreEncryptionKeyVolumeName = "restore-encryption-key"
+
+	// where the restore init container stages the backup. It is within the data directory, so
+	// that there is room for it wherever there is room for the restored data.
+	physicalRestoreStagingDir = "/var/lib/mysql/.restore"
+)
+
+func isPhysicalSnapshot(snapshot *api.Snapshot) bool {
+	return snapshot.Spec.Method == api.BackupMethodPhysical
+}
+
+// upsertPhysicalBackup makes the backup Job copy the data files of the server in pod while it is
+// running, with xtrabackup. The data volume of the pod is mounted read-only, so the Job is
+// scheduled on the node of the pod.
+func upsertPhysicalBackup(job *batch.Job, pod string) {
+	spec := &job.Spec.Template.Spec
+	spec.Containers[0].VolumeMounts = append(spec.Containers[0].VolumeMounts, core.VolumeMount{
+		Name:      "data",
+		MountPath: "/var/lib/mysql",
+		ReadOnly:  true,
+	})
+	spec.Volumes = append(spec.Volumes, core.Volume{
+		Name: "data",
+		VolumeSource: core.VolumeSource{
+			PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
+				ClaimName: fmt.Sprintf("data-%s", pod),
+			},
+		},
+	})
+
+	if spec.Affinity == nil {
+		spec.Affinity = &core.Affinity{}
+	} else {
+		spec.Affinity = spec.Affinity.DeepCopy()
+	}
+	if spec.Affinity.PodAffinity == nil {
+		spec.Affinity.PodAffinity = &core.PodAffinity{}
+	}
+	spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+		spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+		core.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					apps.StatefulSetPodNameLabel: pod,
+				},
+			},
+			TopologyKey: core.LabelHostname,
+		},
+	)
+}
+
+// physicalRestoreSnapshot returns the Snapshot in spec.init.snapshotSource if it is a Physical
+// Snapshot that the MySQL is not yet initialized from, or nil otherwise.
+func (c *Controller) physicalRestoreSnapshot(mysql *api.MySQL) (*api.Snapshot, error) {
+	if mysql.Spec.Init == nil || mysql.Spec.Init.SnapshotSource == nil {
+		return nil, nil
+	}
+	if _, err := meta_util.GetString(mysql.Annotations, api.AnnotationInitialized); err != kutil.ErrNotFound {
+		return nil, nil
+	}
+	source := mysql.Spec.Init.SnapshotSource
+	namespace := source.Namespace
+	if namespace == "" {
+		namespace = mysql.Namespace
+	}
+	snapshot, err := c.ExtClient.KubedbV1alpha1().Snapshots(namespace).Get(source.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !isPhysicalSnapshot(snapshot) {
+		return nil, nil
+	}
+	return snapshot, nil
+}
+
+// physicalRestoreContainer returns the init container that restores the data directory of the first
+// server from a Physical Snapshot, before mysqld is started. It returns nil if the MySQL is not
+// initialized from a Physical Snapshot, or is already initialized. Only a standalone server can be
+// initialized this way, see the validator. The password of the database user is reset to the one in
+// spec.databaseSecret, as the users are restored along with the data.
+func (c *Controller) physicalRestoreContainer(mysql *api.MySQL, mysqlVersion *catalog.MySQLVersion) (*core.Container, *api.Snapshot, error) {
+	snapshot, err := c.physicalRestoreSnapshot(mysql)
+	if err != nil || snapshot == nil {
+		return nil, nil, err
+	}
+
+	if err := c.ensureRestoreOSMSecret(mysql, snapshot); err != nil {
+		return nil, nil, err
+	}
+
+	bucket, err := snapshot.Spec.Backend.Container()
+	if err != nil {
+		return nil, nil, err
+	}
+	folderName, err := snapshot.Location()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	container := &core.Container{
+		Name:            physicalRestoreContainerName,
+		Image:           mysqlVersion.Spec.Tools.Image,
+		ImagePullPolicy: core.PullIfNotPresent,
+		Args: append([]string{
+			opRestorePhysical,
+			fmt.Sprintf(`--data-dir=%s`, physicalRestoreStagingDir),
+			fmt.Sprintf(`--mysql-data-dir=%s`, "/var/lib/mysql"),
+			fmt.Sprintf(`--bucket=%s`, bucket),
+			fmt.Sprintf(`--folder=%s`, folderName),
+			fmt.Sprintf(`--snapshot=%s`, snapshot.Name),
+			fmt.Sprintf(`--enable-analytics=%v`, c.EnableAnalytics),
+		}, snapshotStreamArgs(snapshot)...),
+		Env: append(databaseCredentialEnvs(mysql), core.EnvVar{
+			Name:  analytics.Key,
+			Value: c.AnalyticsClientID,
+		}),
+		Resources: mysql.Spec.PodTemplate.Spec.Resources,
+		VolumeMounts: []core.VolumeMount{
+			{
+				Name:      "data",
+				MountPath: "/var/lib/mysql",
+			},
+			{
+				Name:      physicalRestoreOSMVolumeName,
+				MountPath: storage.SecretMountPath,
+				ReadOnly:  true,
+			},
+		},
+	}
+	if local := snapshot.Spec.Backend.Local; local != nil {
+		container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
+			Name:      physicalRestoreLocalVolumeName,
+			MountPath: local.MountPath,
+			SubPath:   local.SubPath,
+		})
+	}
+	if _, mount := encryptionKeyVolume(snapshot, physicalRestoreEncryptionKeyVolumeName); mount != nil {
+		container.VolumeMounts = append(container.VolumeMounts, *mount)
+	}
+	return container, snapshot, nil
+}
+
+// upsertPhysicalRestore adds the restore init container to the pod template. It is not removed once
+// the MySQL is initialized, as that would restart the servers. It does nothing if the data directory
+// is not empty. Its osm config is owned by the MySQL, and its encryption key is optional, so that the
+// Snapshot can be deleted.
+func upsertPhysicalRestore(statefulSet *apps.StatefulSet, restore *core.Container, mysql *api.MySQL, snapshot *api.Snapshot) *apps.StatefulSet {
+	if restore == nil {
+		return statefulSet
+	}
+	spec := &statefulSet.Spec.Template.Spec
+	spec.InitContainers = core_util.UpsertContainer(spec.InitContainers, *restore)
+	spec.Volumes = core_util.UpsertVolume(spec.Volumes, core.Volume{
+		Name: physicalRestoreOSMVolumeName,
+		VolumeSource: core.VolumeSource{
+			Secret: &core.SecretVolumeSource{
+				SecretName: restoreOSMSecretName(mysql),
+			},
+		},
+	})
+	if local := snapshot.Spec.Backend.Local; local != nil {
+		spec.Volumes = core_util.UpsertVolume(spec.Volumes, core.Volume{
+			Name:         physicalRestoreLocalVolumeName,
+			VolumeSource: local.VolumeSource,
+		})
+	}
+	if volume, _ := encryptionKeyVolume(snapshot, physicalRestoreEncryptionKeyVolumeName); volume != nil {
+		volume.Secret.Optional = types.BoolP(true)
+		spec.Volumes = core_util.UpsertVolume(spec.Volumes, *volume)
+	}
+	return statefulSet
+}
+
+// completePhysicalRestore marks the MySQL initialized from a Physical Snapshot. The data directory
+// is restored by the init container of the first server, so it is complete once the servers are ready.
+func (c *Controller) completePhysicalRestore(mysql *api.MySQL) error {
+	if err := c.UpsertDatabaseAnnotation(mysql.ObjectMeta, map[string]string{
+		api.AnnotationInitialized: "",
+	}); err != nil {
+		return err
+	}
+	if err := c.SetDatabaseStatus(mysql.ObjectMeta, api.DatabasePhaseRunning, ""); err != nil {
+		return err
+	}
+	c.recorder.Event(
+		mysql,
+		core.EventTypeNormal,
+		eventer.EventReasonSuccessfulInitialize,
+		"Successfully completed initialization",
+	)
+	return nil
+}
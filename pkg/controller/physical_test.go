@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+)
+
+func TestUpsertPhysicalBackup(t *testing.T) {
+	// affinity of the Snapshot pod template
+	affinity := &core.Affinity{
+		NodeAffinity: &core.NodeAffinity{},
+	}
+	job := &batch.Job{
+		Spec: batch.JobSpec{
+			Template: core.PodTemplateSpec{
+				Spec: core.PodSpec{
+					Containers: []core.Container{{Name: "backup"}},
+					Affinity:   affinity,
+				},
+			},
+		},
+	}
+	upsertPhysicalBackup(job, "my-mysql-0")
+
+	spec := job.Spec.Template.Spec
+	if m := spec.Containers[0].VolumeMounts; len(m) != 1 || m[0].MountPath != "/var/lib/mysql" || !m[0].ReadOnly {
+		t.Errorf("unexpected volume mounts %+v", m)
+	}
+	if v := spec.Volumes; len(v) != 1 || v[0].PersistentVolumeClaim == nil || v[0].PersistentVolumeClaim.ClaimName != "data-my-mysql-0" {
+		t.Errorf("unexpected volumes %+v", v)
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		t.Error("expected node affinity of the pod template to be kept")
+	}
+	terms := spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 || terms[0].LabelSelector.MatchLabels[apps.StatefulSetPodNameLabel] != "my-mysql-0" {
+		t.Errorf("unexpected pod affinity %+v", terms)
+	}
+	if affinity.PodAffinity != nil {
+		t.Error("affinity of the pod template is modified")
+	}
+}
@@ -0,0 +1,309 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	"github.com/go-xorm/xorm"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+)
+
+const (
+	EventReasonReplicaConfigured = "ReplicaConfigured"
+
+	// value of Slave_IO_Running and Slave_SQL_Running in SHOW SLAVE STATUS when the thread is running
+	replicationThreadRunning = "Yes"
+	// replication health is not reflected by any Kubernetes object, so it is checked periodically
+	replicationCheckInterval = 30 * time.Second
+
+	// authentication plugin of the replication user, which every version lets replicas use without TLS
+	replicationAuthPlugin = "mysql_native_password"
+)
+
+// replicationSource returns the name of the pod that the replicas of the MySQL replicate from.
+// The first pod is the source, unless status says otherwise.
+func replicationSource(mysql *api.MySQL) string {
+	if mysql.Status.Replication != nil && mysql.Status.Replication.Source != "" {
+		return mysql.Status.Replication.Source
+	}
+	return fmt.Sprintf("%s-0", mysql.OffshootName())
+}
+
+// getReplicationCredentials reads the replication user name and password from the replication secret.
+func (c *Controller) getReplicationCredentials(mysql *api.MySQL) (string, string, error) {
+	if mysql.Spec.ReplicationSecret == nil {
+		return "", "", fmt.Errorf("replication secret of MySQL %v/%v is not set yet", mysql.Namespace, mysql.Name)
+	}
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(mysql.Spec.ReplicationSecret.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", err
+	}
+	user, ok := secret.Data[KeyMySQLUser]
+	if !ok {
+		user = []byte(replicationUser)
+	}
+	password, ok := secret.Data[KeyMySQLPassword]
+	if !ok {
+		return "", "", fmt.Errorf(`secret "%v/%v" does not have key %q`, secret.Namespace, secret.Name, KeyMySQLPassword)
+	}
+	return string(user), string(password), nil
+}
+
+// ensureReplication makes the source writable, points every other server to it as a read-only replica
+// using GTID auto-positioning, and reports the health of each replica in status. Pods are labeled with
+// their role, so that the primary Service follows the source and the replicas Service selects the
+// replicas that are replicating. If the source is unhealthy, it is replaced by failover.
+func (c *Controller) ensureReplication(mysql *api.MySQL, conditions *conditionSet) error {
+	c.requeueAfter(mysql, replicationCheckInterval)
+
+	user, password, err := c.getReplicationCredentials(mysql)
+	if err != nil {
+		conditions.failed(api.MySQLConditionReplicationHealthy, err)
+		return err
+	}
+
+	source := replicationSource(mysql)
+	sourceGTIDs, err := c.ensureReplicationSource(mysql, source, user, password)
+	if err != nil {
+		promoted, err := c.handleSourceFailure(mysql, source, err, conditions)
+		if !promoted {
+			return err
+		}
+		source = replicationSource(mysql)
+		if sourceGTIDs, err = c.ensureReplicationSource(mysql, source, user, password); err != nil {
+			err = fmt.Errorf(`failed to configure source "%v" of MySQL %v/%v. Reason: %v`, source, mysql.Namespace, mysql.Name, err)
+			conditions.failed(api.MySQLConditionReplicationHealthy, err)
+			return err
+		}
+	}
+
+	var replicas []api.MySQLReplicaStatus
+	roles := map[string]string{
+		source: api.MySQLPodPrimary,
+	}
+	var unhealthy []string
+	for i := 0; i < int(types.Int32(mysql.Spec.Replicas)); i++ {
+		name := fmt.Sprintf("%s-%d", mysql.OffshootName(), i)
+		if name == source {
+			continue
+		}
+		replica := c.ensureReplica(mysql, name, source, sourceGTIDs, user, password)
+		replicas = append(replicas, replica)
+		if replica.IOThreadRunning && replica.SQLThreadRunning {
+			roles[name] = api.MySQLPodSecondary
+		} else {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		if in.Replication == nil {
+			in.Replication = &api.MySQLReplicationStatus{}
+		}
+		in.Replication.Source = source
+		in.Replication.SourceUnhealthySince = nil
+		in.Replication.Replicas = replicas
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+
+	if len(unhealthy) > 0 {
+		conditions.set(api.MySQLConditionReplicationHealthy, core.ConditionFalse, ConditionReasonFailed,
+			fmt.Sprintf("replicas %s are not replicating from %s", strings.Join(unhealthy, ", "), source))
+	} else {
+		conditions.ready(api.MySQLConditionReplicationHealthy, fmt.Sprintf("all replicas are replicating from %s", source))
+	}
+
+	return c.ensureMemberRoles(mysql, roles, true)
+}
+
+// ensureReplicationSource makes the source writable and creates the replication user on it.
+// It returns the GTID set executed by the source.
+func (c *Controller) ensureReplicationSource(mysql *api.MySQL, source, user, password string) (string, error) {
+	en, err := c.newMemberClient(mysql, memberHost(mysql, source))
+	if err != nil {
+		return "", err
+	}
+	defer en.Close()
+
+	rows, err := en.QueryString("SELECT @@GLOBAL.read_only AS read_only, @@GLOBAL.gtid_executed AS gtid_executed")
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("failed to read the state of server")
+	}
+	// every server starts read-only, see replicationStartScript
+	if rows[0]["read_only"] != "0" {
+		if _, err := en.Exec("SET GLOBAL read_only = OFF"); err != nil {
+			return "", err
+		}
+		log.Infof("source %v of MySQL %v/%v is made writable", source, mysql.Namespace, mysql.Name)
+	}
+
+	// The replication user is written to the binary log, so that it is replicated to
+	// every replica and exists on whichever server is the source.
+	users, err := en.QueryString("SELECT user FROM mysql.user WHERE user = ? AND host = '%'", user)
+	if err != nil {
+		return "", err
+	}
+	for _, stmt := range replicationUserStatements(user, password, len(users) > 0) {
+		if _, err := en.Exec(stmt); err != nil {
+			return "", err
+		}
+	}
+
+	return rows[0]["gtid_executed"], nil
+}
+
+// replicationUserStatements returns the statements that create the replication user, or reset the
+// password and the authentication plugin of an existing one, so that it matches the replication
+// secret. The plugin is mysql_native_password, as the default plugin of 8.0, caching_sha2_password,
+// refuses replicas that connect without TLS, unless they request the public key of the source, which
+// 5.7 and 8.0.3 can't.
+func replicationUserStatements(user, password string, exists bool) []string {
+	if !exists {
+		return []string{
+			fmt.Sprintf("CREATE USER %s@'%%' IDENTIFIED WITH %s BY %s", quoteString(user), replicationAuthPlugin, quoteString(password)),
+			fmt.Sprintf("GRANT REPLICATION SLAVE ON *.* TO %s@'%%'", quoteString(user)),
+		}
+	}
+	return []string{
+		fmt.Sprintf("ALTER USER %s@'%%' IDENTIFIED WITH %s BY %s", quoteString(user), replicationAuthPlugin, quoteString(password)),
+	}
+}
+
+// ensureReplica configures the server of pod name to replicate from source, and returns its
+// replication status. Errors are reported in the returned status, so that a single broken
+// replica does not stop the others from being configured.
+func (c *Controller) ensureReplica(mysql *api.MySQL, name, source, sourceGTIDs, user, password string) api.MySQLReplicaStatus {
+	status := api.MySQLReplicaStatus{
+		Name: name,
+	}
+
+	en, err := c.newMemberClient(mysql, memberHost(mysql, name))
+	if err != nil {
+		status.LastError = err.Error()
+		return status
+	}
+	defer en.Close()
+
+	if err := c.configureReplica(en, mysql, name, source, sourceGTIDs, user, password); err != nil {
+		log.Errorf("failed to configure replica %v of MySQL %v/%v. Reason: %v", name, mysql.Namespace, mysql.Name, err)
+		status.LastError = err.Error()
+		return status
+	}
+
+	rows, err := en.QueryString("SHOW SLAVE STATUS")
+	if err != nil {
+		status.LastError = err.Error()
+		return status
+	}
+	if len(rows) == 0 {
+		status.LastError = "replication is not configured"
+		return status
+	}
+	row := rows[0]
+	status.IOThreadRunning = row["Slave_IO_Running"] == replicationThreadRunning
+	status.SQLThreadRunning = row["Slave_SQL_Running"] == replicationThreadRunning
+	// NULL, if the replica is not replicating
+	if lag, err := strconv.ParseInt(row["Seconds_Behind_Master"], 10, 64); err == nil {
+		status.SecondsBehindSource = &lag
+	}
+	if row["Last_IO_Error"] != "" {
+		status.LastError = row["Last_IO_Error"]
+	} else if row["Last_SQL_Error"] != "" {
+		status.LastError = row["Last_SQL_Error"]
+	}
+	return status
+}
+
+func (c *Controller) configureReplica(en *xorm.Engine, mysql *api.MySQL, name, source, sourceGTIDs, user, password string) error {
+	// replicas never accept writes from clients, not even from root
+	if _, err := en.Exec("SET GLOBAL super_read_only = ON"); err != nil {
+		return err
+	}
+
+	sourceHost := memberHost(mysql, source)
+	rows, err := en.QueryString("SHOW SLAVE STATUS")
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 &&
+		rows[0]["Master_Host"] == sourceHost &&
+		rows[0]["Master_User"] == user &&
+		rows[0]["Auto_Position"] == "1" &&
+		rows[0]["Master_SSL_Allowed"] == sslAllowed(mysql) {
+		return nil
+	}
+
+	if len(rows) == 0 {
+		// A server that has never replicated must not have executed transactions that the
+		// source does not have, otherwise auto-positioning can't bring it in sync.
+		gtids, err := en.QueryString("SELECT @@GLOBAL.gtid_executed AS gtid_executed")
+		if err != nil {
+			return err
+		}
+		if len(gtids) > 0 && gtids[0]["gtid_executed"] != "" {
+			subset, err := en.QueryString("SELECT GTID_SUBSET(?, ?) AS subset", gtids[0]["gtid_executed"], sourceGTIDs)
+			if err != nil {
+				return err
+			}
+			if len(subset) == 0 || subset[0]["subset"] != "1" {
+				return fmt.Errorf("server has executed transactions %q that source %v does not have", gtids[0]["gtid_executed"], source)
+			}
+		}
+	}
+
+	if _, err := en.Exec("STOP SLAVE"); err != nil {
+		return err
+	}
+	if _, err := en.Exec(changeMasterStatement(mysql, sourceHost, user, password)); err != nil {
+		return err
+	}
+	if _, err := en.Exec("START SLAVE"); err != nil {
+		return err
+	}
+
+	log.Infof("replica %v of MySQL %v/%v is replicating from %v", name, mysql.Namespace, mysql.Name, source)
+	c.recorder.Eventf(
+		mysql,
+		core.EventTypeNormal,
+		EventReasonReplicaConfigured,
+		`Pod "%v" is replicating from "%v"`,
+		name,
+		source,
+	)
+	return nil
+}
+
+// changeMasterStatement returns the statement that points a replica of the MySQL to the source at sourceHost.
+func changeMasterStatement(mysql *api.MySQL, sourceHost, user, password string) string {
+	masterSSL := 0
+	if mysql.Spec.TLS != nil {
+		masterSSL = 1
+	}
+	return fmt.Sprintf(
+		"CHANGE MASTER TO MASTER_HOST = %s, MASTER_PORT = %d, MASTER_USER = %s, MASTER_PASSWORD = %s, MASTER_AUTO_POSITION = 1, MASTER_CONNECT_RETRY = 10, MASTER_SSL = %d",
+		quoteString(sourceHost), api.MySQLNodePort, quoteString(user), quoteString(password), masterSSL,
+	)
+}
+
+// sslAllowed returns Master_SSL_Allowed of SHOW SLAVE STATUS for a replica of the MySQL.
+// With spec.tls, replicas connect to the source with TLS.
+func sslAllowed(mysql *api.MySQL) string {
+	if mysql.Spec.TLS != nil {
+		return "Yes"
+	}
+	return "No"
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestReplicationUserStatements(t *testing.T) {
+	cases := []struct {
+		name     string
+		exists   bool
+		expected []string
+	}{
+		{
+			name: "new user",
+			expected: []string{
+				"CREATE USER 'repl'@'%' IDENTIFIED WITH mysql_native_password BY 'secret'",
+				"GRANT REPLICATION SLAVE ON *.* TO 'repl'@'%'",
+			},
+		},
+		{
+			// the password may have changed, and the plugin may be the default of 8.0, which replicas
+			// without TLS can't authenticate with
+			name:     "existing user",
+			exists:   true,
+			expected: []string{"ALTER USER 'repl'@'%' IDENTIFIED WITH mysql_native_password BY 'secret'"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if stmts := replicationUserStatements("repl", "secret", c.exists); !reflect.DeepEqual(stmts, c.expected) {
+				t.Errorf("expected %q, got %q", c.expected, stmts)
+			}
+		})
+	}
+}
+
+func TestChangeMasterStatement(t *testing.T) {
+	mysql := &api.MySQL{Spec: api.MySQLSpec{Version: "8.0.14"}}
+	expected := "CHANGE MASTER TO MASTER_HOST = 'demo-0.demo-gvr.ns', MASTER_PORT = 3306, MASTER_USER = 'repl', MASTER_PASSWORD = 'secret', MASTER_AUTO_POSITION = 1, MASTER_CONNECT_RETRY = 10, MASTER_SSL = 0"
+	if stmt := changeMasterStatement(mysql, "demo-0.demo-gvr.ns", "repl", "secret"); stmt != expected {
+		t.Errorf("expected %q, got %q", expected, stmt)
+	}
+
+	mysql.Spec.TLS = &api.MySQLTLSConfig{}
+	expected = "CHANGE MASTER TO MASTER_HOST = 'demo-0.demo-gvr.ns', MASTER_PORT = 3306, MASTER_USER = 'repl', MASTER_PASSWORD = 'secret', MASTER_AUTO_POSITION = 1, MASTER_CONNECT_RETRY = 10, MASTER_SSL = 1"
+	if stmt := changeMasterStatement(mysql, "demo-0.demo-gvr.ns", "repl", "secret"); stmt != expected {
+		t.Errorf("expected %q, got %q", expected, stmt)
+	}
+}
+
+func TestReplicationStartScript(t *testing.T) {
+	script := replicationStartScript([]string{"--sql-mode=ANSI_QUOTES,NO_ZERO_DATE", "--init-connect=SET NAMES 'utf8mb4'"})
+	expected := `--read-only=ON '--sql-mode=ANSI_QUOTES,NO_ZERO_DATE' '--init-connect=SET NAMES '\''utf8mb4'\'''`
+	if !strings.HasSuffix(script, expected) {
+		t.Errorf("expected script to end with %s, got\n%s", expected, script)
+	}
+}
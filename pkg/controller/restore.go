@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/reference"
+	core_util "kmodules.xyz/client-go/core/v1"
+	storage "kmodules.xyz/objectstore-api/osm"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+	"kubedb.dev/apimachinery/pkg/eventer"
+)
+
+const (
+	// how often the progress of a restore is checked
+	restorePollInterval = 15 * time.Second
+
+	// how many lines of the log of a failed restore Job are kept in an event
+	restoreLogTailLines = 20
+	// the message of an event is limited in size by the apiserver
+	maxRestoreLogTailBytes = 2048
+)
+
+var (
+	// lines that mysql-tools and osm-stream log while a Snapshot is restored
+	restoreProgressLine     = regexp.MustCompile(`^Downloaded (\d+)(?: of (\d+))? bytes$`)
+	restoreFailedStatements = regexp.MustCompile(`^Restore failed with (\d+) SQL errors$`)
+	restoreSQLError         = regexp.MustCompile(`^ERROR \d+`)
+)
+
+// initMySQLRestoreWatcher reports the progress of the Jobs that restore spec.init.snapshotSource.
+func (c *Controller) initMySQLRestoreWatcher() {
+	c.restoreQueue = c.newInitJobQueue("MySQLRestore", restoreJob{c}, restorePollInterval)
+}
+
+// restoreJobName is named after the MySQL rather than the Snapshot, as MySQLs may be initialized from
+// the same Snapshot.
+func restoreJobName(mysql *api.MySQL) string {
+	return fmt.Sprintf("%s-%s-restore", api.DatabaseNamePrefix, mysql.OffshootName())
+}
+
+// restoreOSMSecretName is the name of the osm config of the backend of spec.init.snapshotSource. It is
+// named after the MySQL, as the Snapshot may be in another namespace.
+func restoreOSMSecretName(mysql *api.MySQL) string {
+	return fmt.Sprintf("osm-%v-restore", mysql.OffshootName())
+}
+
+// ensureRestoreOSMSecret creates the osm config of the backend of snapshot in the namespace of mysql,
+// where it is mounted by the restore Job or the restore init container. It is owned by mysql, so that
+// it is kept as long as the init container of a Physical Snapshot, even if the Snapshot is deleted.
+func (c *Controller) ensureRestoreOSMSecret(mysql *api.MySQL, snapshot *api.Snapshot) error {
+	ref, err := reference.GetReference(clientsetscheme.Scheme, mysql)
+	if err != nil {
+		return err
+	}
+	secret, err := storage.NewOSMSecret(c.Client, restoreOSMSecretName(mysql), mysql.Namespace, snapshot.Spec.Backend)
+	if err != nil {
+		return err
+	}
+	_, _, err = core_util.CreateOrPatchSecret(c.Client, secret.ObjectMeta, func(in *core.Secret) *core.Secret {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
+		in.Labels = mysql.OffshootLabels()
+		in.Data = secret.Data
+		return in
+	})
+	return err
+}
+
+// startRestore records that the restore Job of snapshot was created, and starts polling it as a restoreJob.
+func (c *Controller) startRestore(mysql *api.MySQL, snapshot *api.Snapshot, job *batch.Job) error {
+	now := metav1.Now()
+	if err := c.updateRestoreStatus(mysql, &api.MySQLRestoreStatus{
+		Snapshot:  fmt.Sprintf("%s/%s", snapshot.Namespace, snapshot.Name),
+		Job:       job.Name,
+		Phase:     api.MySQLRestorePhaseRunning,
+		StartTime: &now,
+	}); err != nil {
+		return err
+	}
+	return c.startInitJob(mysql, c.restoreQueue, restorePollInterval)
+}
+
+// restoreJob is the initJob that restores spec.init.snapshotSource. Its progress and the cause of
+// its failure are read from its log.
+type restoreJob struct {
+	c *Controller
+}
+
+func (j restoreJob) running(mysql *api.MySQL) (string, bool) {
+	st := mysql.Status.Restore
+	if st == nil || st.Phase != api.MySQLRestorePhaseRunning {
+		return "", false
+	}
+	return st.Job, true
+}
+
+func (j restoreJob) poll(mysql *api.MySQL, job *batch.Job) (string, error) {
+	// the log is best effort, eg, the pod may not be scheduled yet
+	logs, err := j.c.jobLogTail(job, api.JobTypeRestore, restoreLogTailLines)
+	if err != nil {
+		log.Debugf("failed to read log of restore Job %s/%s. Reason: %v", job.Namespace, job.Name, err)
+	}
+	st := mysql.Status.Restore.DeepCopy()
+	cause := parseRestoreLog(logs, st)
+	if !reflect.DeepEqual(st, mysql.Status.Restore) {
+		if err := j.c.updateRestoreStatus(mysql, st); err != nil {
+			return "", err
+		}
+	}
+	if cause != nil {
+		return cause.Error(), nil
+	}
+	return "", nil
+}
+
+func (j restoreJob) finish(mysql *api.MySQL, succeeded bool) error {
+	return nil
+}
+
+func (j restoreJob) succeeded(mysql *api.MySQL, now metav1.Time) error {
+	st := mysql.Status.Restore.DeepCopy()
+	st.Phase = api.MySQLRestorePhaseSucceeded
+	st.CompletionTime = &now
+	if st.TotalBytes != nil {
+		st.ProcessedBytes = types.Int64P(*st.TotalBytes)
+	}
+	return j.c.updateRestoreStatus(mysql, st)
+}
+
+// failed records why the restore failed, and reports the end of the log of the restore Job.
+func (j restoreJob) failed(mysql *api.MySQL, cause error, now metav1.Time) error {
+	st := mysql.Status.Restore.DeepCopy()
+	if st == nil {
+		st = &api.MySQLRestoreStatus{}
+	}
+	st.Phase = api.MySQLRestorePhaseFailed
+	st.CompletionTime = &now
+	st.Reason = cause.Error()
+	if err := j.c.updateRestoreStatus(mysql, st); err != nil {
+		return err
+	}
+
+	job, err := j.c.Client.BatchV1().Jobs(mysql.Namespace).Get(st.Job, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	logs, err := j.c.jobLogTail(job, api.JobTypeRestore, restoreLogTailLines)
+	if logs = strings.TrimSpace(logs); err != nil || logs == "" {
+		return nil
+	}
+	if len(logs) > maxRestoreLogTailBytes {
+		logs = "..." + logs[len(logs)-maxRestoreLogTailBytes:]
+	}
+	j.c.recorder.Eventf(
+		mysql,
+		core.EventTypeWarning,
+		eventer.EventReasonFailedToInitialize,
+		"Log of restore Job %v:\n%v",
+		st.Job,
+		logs,
+	)
+	return nil
+}
+
+func (j restoreJob) cleanup(mysql *api.MySQL) error {
+	if mysql.Status.Restore == nil || mysql.Status.Restore.Job == "" {
+		return nil
+	}
+	deletePolicy := metav1.DeletePropagationBackground
+	err := j.c.Client.BatchV1().Jobs(mysql.Namespace).Delete(mysql.Status.Restore.Job, &metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	})
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// parseRestoreLog sets the progress of the restore in st from the log of the restore Job, and returns
+// why the restore failed, if the log says so.
+func parseRestoreLog(logs string, st *api.MySQLRestoreStatus) error {
+	var lastError string
+	var cause error
+	for _, line := range strings.Split(logs, "\n") {
+		line = strings.TrimSpace(line)
+		if m := restoreProgressLine.FindStringSubmatch(line); m != nil {
+			processed, _ := strconv.ParseInt(m[1], 10, 64)
+			st.ProcessedBytes = types.Int64P(processed)
+			if m[2] != "" {
+				total, _ := strconv.ParseInt(m[2], 10, 64)
+				st.TotalBytes = types.Int64P(total)
+			}
+		} else if restoreSQLError.MatchString(line) {
+			lastError = line
+		} else if m := restoreFailedStatements.FindStringSubmatch(line); m != nil {
+			failed, _ := strconv.ParseInt(m[1], 10, 32)
+			st.FailedStatements = int32(failed)
+		}
+	}
+	if st.FailedStatements > 0 {
+		cause = fmt.Errorf("%d statement(s) of Snapshot %v failed", st.FailedStatements, st.Snapshot)
+		if lastError != "" {
+			cause = fmt.Errorf("%v, the last with: %v", cause, lastError)
+		}
+	} else if lastError != "" {
+		cause = fmt.Errorf("restore of Snapshot %v failed with: %v", st.Snapshot, lastError)
+	}
+	return cause
+}
+
+// jobLogTail returns the last lines of the log of container, in the latest pod of job.
+func (c *Controller) jobLogTail(job *batch.Job, container string, lines int64) (string, error) {
+	pods, err := c.Client.CoreV1().Pods(job.Namespace).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{"job-name": job.Name}).String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("Job %s/%s has no pod", job.Namespace, job.Name)
+	}
+	latest := pods.Items[0]
+	for _, pod := range pods.Items[1:] {
+		if latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	raw, err := c.Client.CoreV1().Pods(job.Namespace).GetLogs(latest.Name, &core.PodLogOptions{
+		Container: container,
+		TailLines: types.Int64P(lines),
+	}).Do().Raw()
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func (c *Controller) updateRestoreStatus(mysql *api.MySQL, st *api.MySQLRestoreStatus) error {
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		in.Restore = st
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+	return nil
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appscode/go/types"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestParseRestoreLog(t *testing.T) {
+	lines := func(l ...string) string {
+		return strings.Join(l, "\n") + "\n"
+	}
+	cases := []struct {
+		name      string
+		logs      string
+		processed *int64
+		total     *int64
+		failed    int32
+		cause     string
+	}{
+		{
+			name: "no progress",
+			logs: lines("Waiting... database is not ready yet", "Inserting data from the backend into database........"),
+		},
+		{
+			name:      "progress",
+			logs:      lines("Inserting data from the backend into database........", "Downloaded 1024 of 4096 bytes", "Downloaded 2048 of 4096 bytes"),
+			processed: types.Int64P(2048),
+			total:     types.Int64P(4096),
+		},
+		{
+			name:      "unknown size",
+			logs:      lines("Downloaded 2048 bytes"),
+			processed: types.Int64P(2048),
+		},
+		{
+			name: "failed statements",
+			logs: lines(
+				"Downloaded 4096 of 4096 bytes",
+				"mysql: [Warning] Using a password on the command line interface can be insecure.",
+				"ERROR 1062 (23000) at line 40: Duplicate entry '1' for key 'PRIMARY'",
+				"ERROR 1146 (42S02) at line 52: Table 'shop.orders' doesn't exist",
+				"Restore failed with 2 SQL errors",
+			),
+			processed: types.Int64P(4096),
+			total:     types.Int64P(4096),
+			failed:    2,
+			cause:     "2 statement(s) of Snapshot demo/snap failed, the last with: ERROR 1146 (42S02) at line 52: Table 'shop.orders' doesn't exist",
+		},
+		{
+			name:  "connection error",
+			logs:  lines("ERROR 2005 (HY000): Unknown MySQL server host 'mysql' (-2)", "Restore failed"),
+			cause: "restore of Snapshot demo/snap failed with: ERROR 2005 (HY000): Unknown MySQL server host 'mysql' (-2)",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			st := &api.MySQLRestoreStatus{Snapshot: "demo/snap"}
+			cause := parseRestoreLog(c.logs, st)
+			if types.Int64(st.ProcessedBytes) != types.Int64(c.processed) || (st.ProcessedBytes == nil) != (c.processed == nil) {
+				t.Errorf("expected %v processed bytes, got %v", types.Int64(c.processed), types.Int64(st.ProcessedBytes))
+			}
+			if types.Int64(st.TotalBytes) != types.Int64(c.total) || (st.TotalBytes == nil) != (c.total == nil) {
+				t.Errorf("expected %v total bytes, got %v", types.Int64(c.total), types.Int64(st.TotalBytes))
+			}
+			if st.FailedStatements != c.failed {
+				t.Errorf("expected %d failed statements, got %d", c.failed, st.FailedStatements)
+			}
+			if c.cause == "" {
+				if cause != nil {
+					t.Errorf("expected no cause, got %v", cause)
+				}
+			} else if cause == nil || cause.Error() != c.cause {
+				t.Errorf("expected cause %q, got %v", c.cause, cause)
+			}
+		})
+	}
+}
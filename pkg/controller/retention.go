@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"kmodules.xyz/client-go/tools/queue"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	api_listers "kubedb.dev/apimachinery/client/listers/kubedb/v1alpha1"
+)
+
+const (
+	EventReasonSnapshotsPruned        = "SnapshotsPruned"
+	EventReasonSnapshotsPruneDryRun   = "SnapshotsPruneDryRun"
+	EventReasonSnapshotsPruningFailed = "SnapshotsPruningFailed"
+
+	// how long a failed scheduled Snapshot, or one whose verification failed, is kept, so that the
+	// failure can be looked into
+	failedSnapshotGracePeriod = 24 * time.Hour
+)
+
+// initBackupRetentionWatcher applies spec.backupSchedule.retention of a MySQL, each time one of its
+// scheduled Snapshots succeeds or fails.
+func (c *Controller) initBackupRetentionWatcher() {
+	c.retentionQueue = queue.New("BackupRetention", c.MaxNumRequeues, c.NumThreads, c.runBackupRetention)
+	c.SnapInformer.AddEventHandler(queue.NewFilteredHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok1 := oldObj.(*api.Snapshot)
+			nu, ok2 := newObj.(*api.Snapshot)
+			if !ok1 || !ok2 || old.Status.Phase == nu.Status.Phase ||
+				(nu.Status.Phase != api.SnapshotPhaseSucceeded && nu.Status.Phase != api.SnapshotPhaseFailed) ||
+				nu.Labels[api.LabelSnapshotScheduled] != "true" {
+				return
+			}
+			// the key of the MySQL, the Snapshots are pruned per database
+			c.retentionQueue.GetQueue().Add(nu.Namespace + "/" + nu.Spec.DatabaseName)
+		},
+	}, c.selector))
+}
+
+func (c *Controller) runBackupRetention(key string) error {
+	log.Debugln("started processing, key:", key)
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	mysql, err := c.myLister.MySQLs(namespace).Get(name)
+	if kerr.IsNotFound(err) {
+		log.Debugf("MySQL %s does not exist anymore", key)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if mysql.DeletionTimestamp != nil || mysql.Spec.BackupSchedule == nil || mysql.Spec.BackupSchedule.Retention == nil {
+		return nil
+	}
+	return c.applyBackupRetention(mysql, mysql.Spec.BackupSchedule.Retention)
+}
+
+// applyBackupRetention deletes the scheduled Snapshots of mysql that policy does not keep. The backup
+// of a deleted Snapshot is wiped out from the backend by WipeOutSnapshot, when its finalizer runs.
+func (c *Controller) applyBackupRetention(mysql *api.MySQL, policy *api.BackupRetentionPolicy) error {
+	snapshots, err := api_listers.NewSnapshotLister(c.SnapInformer.GetIndexer()).Snapshots(mysql.Namespace).List(labels.SelectorFromSet(map[string]string{
+		api.LabelDatabaseKind:      api.ResourceKindMySQL,
+		api.LabelDatabaseName:      mysql.Name,
+		api.LabelSnapshotScheduled: "true",
+	}))
+	if err != nil {
+		return err
+	}
+
+	expired := expiredSnapshots(policy, snapshots, time.Now())
+	if len(expired) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(expired))
+	for _, snapshot := range expired {
+		names = append(names, snapshot.Name)
+	}
+
+	if policy.DryRun {
+		log.Infof("backup retention of MySQL %s/%s would delete Snapshots %s", mysql.Namespace, mysql.Name, strings.Join(names, ", "))
+		c.recorder.Eventf(mysql, core.EventTypeNormal, EventReasonSnapshotsPruneDryRun,
+			"Backup retention would delete Snapshots %s", strings.Join(names, ", "))
+		return nil
+	}
+
+	for _, snapshot := range expired {
+		err := c.ExtClient.KubedbV1alpha1().Snapshots(snapshot.Namespace).Delete(snapshot.Name, &metav1.DeleteOptions{})
+		if err != nil && !kerr.IsNotFound(err) {
+			c.recorder.Eventf(mysql, core.EventTypeWarning, EventReasonSnapshotsPruningFailed,
+				"Failed to delete Snapshot %s. Reason: %v", snapshot.Name, err)
+			return err
+		}
+	}
+	c.recorder.Eventf(mysql, core.EventTypeNormal, EventReasonSnapshotsPruned,
+		"Backup retention deleted Snapshots %s", strings.Join(names, ", "))
+	return nil
+}
+
+// retentionBuckets are the periods of the rules of a BackupRetentionPolicy, each keeping the last
+// Snapshot of a number of periods.
+var retentionBuckets = []struct {
+	count  func(policy *api.BackupRetentionPolicy) int32
+	period func(t time.Time) string
+}{
+	{
+		count:  func(policy *api.BackupRetentionPolicy) int32 { return policy.KeepHourly },
+		period: func(t time.Time) string { return t.Format("2006-01-02T15") },
+	},
+	{
+		count:  func(policy *api.BackupRetentionPolicy) int32 { return policy.KeepDaily },
+		period: func(t time.Time) string { return t.Format("2006-01-02") },
+	},
+	{
+		count: func(policy *api.BackupRetentionPolicy) int32 { return policy.KeepWeekly },
+		period: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		},
+	},
+	{
+		count:  func(policy *api.BackupRetentionPolicy) int32 { return policy.KeepMonthly },
+		period: func(t time.Time) string { return t.Format("2006-01") },
+	},
+}
+
+// expiredSnapshots returns the succeeded Snapshots that policy does not keep, and the failed Snapshots
+// whose failedSnapshotGracePeriod passed by now, oldest first. A Snapshot whose verification failed is
+// failed, and does not take the place of a Snapshot that policy keeps. Snapshots that are running, being
+// deleted, or being verified, are neither counted nor returned.
+func expiredSnapshots(policy *api.BackupRetentionPolicy, snapshots []*api.Snapshot, now time.Time) []*api.Snapshot {
+	var candidates, failed []*api.Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.DeletionTimestamp != nil ||
+			(snapshot.Status.Verification != nil && snapshot.Status.Verification.Phase == api.SnapshotVerificationPhaseRunning) {
+			continue
+		}
+		if since, ok := snapshotFailedSince(snapshot); ok {
+			if now.Sub(since) > failedSnapshotGracePeriod {
+				failed = append(failed, snapshot)
+			}
+			continue
+		}
+		if snapshot.Status.Phase == api.SnapshotPhaseSucceeded {
+			candidates = append(candidates, snapshot)
+		}
+	}
+	// newest first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return snapshotTime(candidates[j]).Before(snapshotTime(candidates[i]))
+	})
+
+	keep := make([]bool, len(candidates))
+	for i := range candidates {
+		if i < int(policy.KeepLast) {
+			keep[i] = true
+		}
+	}
+	for _, bucket := range retentionBuckets {
+		count := bucket.count(policy)
+		last := ""
+		for i, snapshot := range candidates {
+			if count <= 0 {
+				break
+			}
+			if period := bucket.period(snapshotTime(snapshot)); period != last {
+				keep[i] = true
+				last = period
+				count--
+			}
+		}
+	}
+
+	expired := failed
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if !keep[i] {
+			expired = append(expired, candidates[i])
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool {
+		return snapshotTime(expired[i]).Before(snapshotTime(expired[j]))
+	})
+	return expired
+}
+
+// snapshotFailedSince returns when snapshot failed, or its verification failed, if either did.
+func snapshotFailedSince(snapshot *api.Snapshot) (time.Time, bool) {
+	if snapshot.Status.Phase == api.SnapshotPhaseFailed {
+		return snapshotTime(snapshot), true
+	}
+	if st := snapshot.Status.Verification; st != nil && st.Phase == api.SnapshotVerificationPhaseFailed {
+		if st.CompletionTime != nil {
+			return st.CompletionTime.UTC(), true
+		}
+		return snapshotTime(snapshot), true
+	}
+	return time.Time{}, false
+}
+
+// snapshotTime is when snapshot was taken.
+func snapshotTime(snapshot *api.Snapshot) time.Time {
+	if snapshot.Status.CompletionTime != nil {
+		return snapshot.Status.CompletionTime.UTC()
+	}
+	return snapshot.CreationTimestamp.UTC()
+}
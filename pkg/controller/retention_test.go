@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestExpiredSnapshots(t *testing.T) {
+	snapshot := func(name string, completion string, phase api.SnapshotPhase) *api.Snapshot {
+		ts, err := time.Parse(time.RFC3339, completion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &api.Snapshot{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: api.SnapshotStatus{
+				Phase:          phase,
+				CompletionTime: &metav1.Time{Time: ts},
+			},
+		}
+	}
+	snapshots := []*api.Snapshot{
+		snapshot("jan-31", "2020-01-31T23:00:00Z", api.SnapshotPhaseSucceeded),
+		snapshot("feb-01-a", "2020-02-01T01:00:00Z", api.SnapshotPhaseSucceeded),
+		snapshot("feb-01-b", "2020-02-01T02:00:00Z", api.SnapshotPhaseSucceeded),
+		snapshot("feb-02-failed", "2020-02-02T01:00:00Z", api.SnapshotPhaseFailed),
+		snapshot("feb-02-a", "2020-02-02T01:00:00Z", api.SnapshotPhaseSucceeded),
+		snapshot("feb-02-b", "2020-02-02T01:30:00Z", api.SnapshotPhaseSucceeded),
+		snapshot("feb-03", "2020-02-03T01:00:00Z", api.SnapshotPhaseSucceeded),
+	}
+
+	// within the grace period of feb-02-failed
+	now := snapshots[3].Status.CompletionTime.Add(failedSnapshotGracePeriod - time.Hour)
+
+	cases := []struct {
+		name    string
+		policy  api.BackupRetentionPolicy
+		expired []string
+	}{
+		{name: "keep last", policy: api.BackupRetentionPolicy{KeepLast: 2}, expired: []string{"jan-31", "feb-01-a", "feb-01-b", "feb-02-a"}},
+		{name: "keep hourly", policy: api.BackupRetentionPolicy{KeepHourly: 3}, expired: []string{"jan-31", "feb-01-a", "feb-02-a"}},
+		{name: "keep daily", policy: api.BackupRetentionPolicy{KeepDaily: 3}, expired: []string{"jan-31", "feb-01-a", "feb-02-a"}},
+		{name: "keep weekly", policy: api.BackupRetentionPolicy{KeepWeekly: 2}, expired: []string{"jan-31", "feb-01-a", "feb-01-b", "feb-02-a"}},
+		{name: "keep monthly", policy: api.BackupRetentionPolicy{KeepMonthly: 5}, expired: []string{"feb-01-a", "feb-01-b", "feb-02-a", "feb-02-b"}},
+		{name: "combined", policy: api.BackupRetentionPolicy{KeepLast: 1, KeepMonthly: 2}, expired: []string{"feb-01-a", "feb-01-b", "feb-02-a", "feb-02-b"}},
+		{name: "keep all", policy: api.BackupRetentionPolicy{KeepLast: 10}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var expired []string
+			for _, snapshot := range expiredSnapshots(&c.policy, snapshots, now) {
+				expired = append(expired, snapshot.Name)
+			}
+			if !reflect.DeepEqual(expired, c.expired) {
+				t.Errorf("expected %v to expire, got %v", c.expired, expired)
+			}
+		})
+	}
+
+	// a failed Snapshot expires once its grace period passed
+	later := now.Add(failedSnapshotGracePeriod + time.Hour)
+	var expired []string
+	for _, snapshot := range expiredSnapshots(&api.BackupRetentionPolicy{KeepLast: 10}, snapshots, later) {
+		expired = append(expired, snapshot.Name)
+	}
+	if expected := []string{"feb-02-failed"}; !reflect.DeepEqual(expired, expected) {
+		t.Errorf("expected %v to expire, got %v", expected, expired)
+	}
+
+	// a Snapshot whose verification failed does not take a slot, and expires with its grace period
+	snapshots[6].Status.Verification = &api.SnapshotVerificationStatus{
+		Phase:          api.SnapshotVerificationPhaseFailed,
+		CompletionTime: &metav1.Time{Time: now},
+	}
+	expired = nil
+	for _, snapshot := range expiredSnapshots(&api.BackupRetentionPolicy{KeepLast: 2}, snapshots, now) {
+		expired = append(expired, snapshot.Name)
+	}
+	if expected := []string{"jan-31", "feb-01-a", "feb-01-b"}; !reflect.DeepEqual(expired, expected) {
+		t.Errorf("expected %v to expire, got %v", expected, expired)
+	}
+	expired = nil
+	for _, snapshot := range expiredSnapshots(&api.BackupRetentionPolicy{KeepLast: 2}, snapshots, later) {
+		expired = append(expired, snapshot.Name)
+	}
+	if expected := []string{"jan-31", "feb-01-a", "feb-01-b", "feb-02-failed", "feb-03"}; !reflect.DeepEqual(expired, expected) {
+		t.Errorf("expected %v to expire, got %v", expected, expired)
+	}
+
+	// a Snapshot being verified is kept until the verification completes
+	snapshots[0].Status.Verification = &api.SnapshotVerificationStatus{Phase: api.SnapshotVerificationPhaseRunning}
+	for _, snapshot := range expiredSnapshots(&api.BackupRetentionPolicy{KeepLast: 1}, snapshots, now) {
+		if snapshot.Name == "jan-31" {
+			t.Error("expected Snapshot being verified not to expire")
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	core_util "kmodules.xyz/client-go/core/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+const (
+	EventReasonRestartingMember = "RestartingMember"
+	EventReasonSwitchover       = "Switchover"
+
+	// how often a replication group is checked while its pods are restarted
+	groupRolloutCheckInterval = 5 * time.Second
+)
+
+// ensureGroupRollout restarts the pods of a replication group that don't run the latest revision
+// of the StatefulSet, which uses the OnDelete strategy in group mode. Pods are restarted one at a
+// time, and only when every other member is ONLINE and, during an upgrade, has been upgraded:
+//
+//   - the secondaries are restarted first, from the highest ordinal
+//   - the primary is restarted last. It first leaves the group, so that a new primary is elected
+//     among the members that are already updated, before its pod is deleted.
+//
+// It returns true if every pod runs the latest revision.
+func (c *Controller) ensureGroupRollout(mysql *api.MySQL, conditions *conditionSet) (bool, error) {
+	statefulSet, err := c.stsLister.StatefulSets(mysql.Namespace).Get(mysql.OffshootName())
+	if kerr.IsNotFound(err) {
+		conditions.set(api.MySQLConditionPodsUpdated, core.ConditionFalse, ConditionReasonProvisioning, "StatefulSet is not observed yet")
+		return false, nil
+	} else if err != nil {
+		conditions.failed(api.MySQLConditionPodsUpdated, err)
+		return false, err
+	}
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation || statefulSet.Status.UpdateRevision == "" {
+		conditions.set(api.MySQLConditionPodsUpdated, core.ConditionFalse, ConditionReasonProvisioning, "StatefulSet is not observed yet")
+		c.requeueAfter(mysql, groupRolloutCheckInterval)
+		return false, nil
+	}
+	revision := statefulSet.Status.UpdateRevision
+
+	pods, err := c.podLister.Pods(mysql.Namespace).List(labels.SelectorFromSet(mysql.OffshootSelectors()))
+	if err != nil {
+		conditions.failed(api.MySQLConditionPodsUpdated, err)
+		return false, err
+	}
+	// highest ordinal first
+	sort.Slice(pods, func(i, j int) bool {
+		return podOrdinal(pods[i]) > podOrdinal(pods[j])
+	})
+
+	var outdated []*core.Pod
+	for _, pod := range pods {
+		if pod.Labels[apps.StatefulSetRevisionLabel] != revision {
+			outdated = append(outdated, pod)
+		}
+	}
+	msg := fmt.Sprintf("%d of %d pods are updated to revision %s", len(pods)-len(outdated), len(pods), revision)
+	if len(outdated) == 0 {
+		conditions.ready(api.MySQLConditionPodsUpdated, msg)
+		return true, nil
+	}
+	conditions.set(api.MySQLConditionPodsUpdated, core.ConditionFalse, ConditionReasonProvisioning, msg)
+	c.requeueAfter(mysql, groupRolloutCheckInterval)
+
+	if types.Int32(statefulSet.Spec.Replicas) != types.Int32(mysql.Spec.Replicas) {
+		// members joining or leaving the group, see groupStatefulSetReplicas
+		return false, nil
+	}
+
+	members, err := c.getGroupMembers(mysql)
+	if err != nil {
+		log.Warningf("pods of MySQL %v/%v are not restarted. Reason: %v", mysql.Namespace, mysql.Name, err)
+		return false, nil
+	}
+
+	var offline, secondary, primary *core.Pod
+	for _, pod := range pods {
+		member := findGroupMember(members, pod.Name)
+		online := member != nil && member.State == memberStateOnline
+		updated := pod.Labels[apps.StatefulSetRevisionLabel] == revision
+		if ready, _ := core_util.PodRunningAndReady(*pod); pod.DeletionTimestamp != nil || (updated && !(ready && online)) {
+			log.Infof("MySQL %v/%v is waiting for pod %v to be ONLINE before restarting the next pod", mysql.Namespace, mysql.Name, pod.Name)
+			return false, nil
+		}
+		if updated && upgradePending(mysql, pod.Name) {
+			log.Infof("MySQL %v/%v is waiting for pod %v to be upgraded before restarting the next pod", mysql.Namespace, mysql.Name, pod.Name)
+			return false, nil
+		}
+		switch {
+		case updated:
+		case !online:
+			if offline == nil {
+				offline = pod
+			}
+		case member.Primary && !mysql.IsMultiPrimary():
+			primary = pod
+		case secondary == nil:
+			secondary = pod
+		}
+	}
+
+	switch {
+	case offline != nil:
+		// Not ONLINE in the group, eg, a primary that has left the group during switchover.
+		// Restarting it doesn't affect the members that are ONLINE.
+		if !mysql.IsMultiPrimary() && !hasGroupPrimary(members) {
+			log.Infof("MySQL %v/%v is waiting for a primary to be elected", mysql.Namespace, mysql.Name)
+			return false, nil
+		}
+		return false, c.restartMember(mysql, offline, revision)
+	case secondary != nil:
+		return false, c.restartMember(mysql, secondary, revision)
+	default:
+		// only the primary is left
+		return false, c.switchover(mysql, primary.Name)
+	}
+}
+
+// switchover makes the primary leave the group, so that the group elects a new primary among the
+// other members. The pod of the old primary is restarted by ensureGroupRollout once it is out of the group.
+func (c *Controller) switchover(mysql *api.MySQL, primary string) error {
+	// Stop routing clients to the primary before it stops accepting writes.
+	if err := c.removeMemberRole(mysql, primary); err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		mysql,
+		core.EventTypeNormal,
+		EventReasonSwitchover,
+		`Primary "%v" is leaving the group, so that a new primary is elected before it is restarted`,
+		primary,
+	)
+	if err := c.leaveGroup(mysql, primary); err != nil {
+		return fmt.Errorf(`failed to switch over from primary "%v" of MySQL %v/%v. Reason: %v`, primary, mysql.Namespace, mysql.Name, err)
+	}
+	return nil
+}
+
+// restartMember deletes the pod, so that it is recreated by the StatefulSet with the latest revision.
+func (c *Controller) restartMember(mysql *api.MySQL, pod *core.Pod, revision string) error {
+	if err := c.removeMemberRole(mysql, pod.Name); err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		mysql,
+		core.EventTypeNormal,
+		EventReasonRestartingMember,
+		`Restarting pod "%v" to update it to revision %v`,
+		pod.Name,
+		revision,
+	)
+	err := c.Client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &pod.UID},
+	})
+	if err != nil && !kerr.IsNotFound(err) {
+		return fmt.Errorf(`failed to restart pod "%v/%v". Reason: %v`, pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
+
+// isRolledOut reports whether every pod of the StatefulSet has been restarted
+// since the pod template was stamped with the given value of the annotation.
+func (c *Controller) isRolledOut(mysql *api.MySQL, annotation, value string) bool {
+	statefulSet, err := c.stsLister.StatefulSets(mysql.Namespace).Get(mysql.OffshootName())
+	if err != nil {
+		return false
+	}
+	replicas := types.Int32(statefulSet.Spec.Replicas)
+	return statefulSet.Spec.Template.Annotations[annotation] == value &&
+		statefulSet.Status.ObservedGeneration >= statefulSet.Generation &&
+		statefulSet.Status.UpdatedReplicas == replicas &&
+		statefulSet.Status.ReadyReplicas == replicas
+}
+
+func hasGroupPrimary(members []groupMember) bool {
+	for _, m := range members {
+		if m.Primary {
+			return true
+		}
+	}
+	return false
+}
+
+// podOrdinal returns the ordinal of a pod of a StatefulSet, or -1 if the name has none.
+func podOrdinal(pod *core.Pod) int {
+	i := strings.LastIndex(pod.Name, "-")
+	if i < 0 {
+		return -1
+	}
+	ordinal, err := strconv.Atoi(pod.Name[i+1:])
+	if err != nil {
+		return -1
+	}
+	return ordinal
+}
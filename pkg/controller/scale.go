@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+const (
+	EventReasonMemberLeaving = "MemberLeaving"
+	EventReasonMemberJoining = "MemberJoining"
+
+	// how often a replication group is checked while members are joining or leaving
+	groupScalingCheckInterval = 5 * time.Second
+)
+
+// groupStatefulSetReplicas returns the number of replicas that the StatefulSet of a replication
+// group should have now. Members are added and removed one at a time, so that the group never
+// loses quorum:
+//
+//   - a new member is added only when all the current members are ONLINE
+//   - the member with the highest ordinal leaves the group before its pod is removed
+func (c *Controller) groupStatefulSetReplicas(mysql *api.MySQL) (*int32, error) {
+	desired := types.Int32(mysql.Spec.Replicas)
+	if desired > api.MySQLMaxGroupMembers {
+		return nil, fmt.Errorf("group size can't be greater than max size %d", api.MySQLMaxGroupMembers)
+	}
+
+	statefulSet, err := c.stsLister.StatefulSets(mysql.Namespace).Get(mysql.OffshootName())
+	if kerr.IsNotFound(err) {
+		// the group is bootstrapped by on-start.sh
+		return types.Int32P(desired), nil
+	} else if err != nil {
+		return nil, err
+	}
+	current := types.Int32(statefulSet.Spec.Replicas)
+	if current == desired {
+		return types.Int32P(desired), nil
+	}
+	if current == 0 {
+		// The MySQL is resumed from halt. The group is bootstrapped by on-start.sh on the
+		// first member, and the others join one at a time.
+		return types.Int32P(1), nil
+	}
+
+	// wait for the members to catch up, even if the group can't be reached
+	c.requeueAfter(mysql, groupScalingCheckInterval)
+	members, err := c.getGroupMembers(mysql)
+	if err != nil {
+		log.Warningf("replication group of MySQL %v/%v is not scaled. Reason: %v", mysql.Namespace, mysql.Name, err)
+		return types.Int32P(current), nil
+	}
+
+	if desired > current {
+		if online := countOnlineMembers(members); online < current {
+			log.Infof("MySQL %v/%v is waiting for %d of %d members to be ONLINE before adding a member", mysql.Namespace, mysql.Name, current-online, current)
+			return types.Int32P(current), nil
+		}
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			EventReasonMemberJoining,
+			`Adding member "%s-%d" to the group`,
+			mysql.OffshootName(),
+			current,
+		)
+		return types.Int32P(current + 1), nil
+	}
+
+	departing := fmt.Sprintf("%s-%d", mysql.OffshootName(), current-1)
+	member := findGroupMember(members, departing)
+	if member == nil || member.State == memberStateUnreachable {
+		// The member has left the group, or is already gone. Its pod can be removed.
+		return types.Int32P(current - 1), nil
+	}
+	if err := c.leaveGroup(mysql, departing); err != nil {
+		return nil, fmt.Errorf(`failed to remove member "%v" from the group. Reason: %v`, departing, err)
+	}
+	return types.Int32P(current), nil
+}
+
+// leaveGroup stops group replication on the member, so that it leaves the group gracefully.
+// It is removed from replication_group_members of the other members shortly after.
+func (c *Controller) leaveGroup(mysql *api.MySQL, name string) error {
+	en, err := c.newMemberClient(mysql, memberHost(mysql, name))
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	rows, err := en.QueryString("SELECT MEMBER_STATE FROM performance_schema.replication_group_members WHERE MEMBER_ID = @@server_uuid")
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 || rows[0]["MEMBER_STATE"] == memberStateOffline {
+		// already stopped, waiting for the others to notice
+		return nil
+	}
+	if _, err := en.Exec("STOP GROUP_REPLICATION"); err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		mysql,
+		core.EventTypeNormal,
+		EventReasonMemberLeaving,
+		`Member "%v" is leaving the group`,
+		name,
+	)
+	return nil
+}
+
+// checkGroupMembersOnline reports whether every member of the replication group is ONLINE.
+func (c *Controller) checkGroupMembersOnline(mysql *api.MySQL, conditions *conditionSet) bool {
+	members, err := c.getGroupMembers(mysql)
+	if err != nil {
+		conditions.failed(api.MySQLConditionGroupMembersOnline, err)
+		return false
+	}
+	desired := types.Int32(mysql.Spec.Replicas)
+	online := countOnlineMembers(members)
+	msg := fmt.Sprintf("%d of %d members are ONLINE", online, desired)
+	if online != desired || int32(len(members)) != desired {
+		conditions.set(api.MySQLConditionGroupMembersOnline, core.ConditionFalse, ConditionReasonProvisioning, msg)
+		return false
+	}
+	conditions.ready(api.MySQLConditionGroupMembersOnline, msg)
+	return true
+}
+
+func countOnlineMembers(members []groupMember) int32 {
+	var n int32
+	for _, m := range members {
+		if m.State == memberStateOnline {
+			n++
+		}
+	}
+	return n
+}
+
+func findGroupMember(members []groupMember, name string) *groupMember {
+	for i := range members {
+		if podNameFromHost(members[i].Host) == name {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+// requeueAfter processes the MySQL again after the given duration, to observe
+// changes inside the database that are not reflected by any Kubernetes object.
+func (c *Controller) requeueAfter(mysql *api.MySQL, d time.Duration) {
+	if key, err := cache.MetaNamespaceKeyFunc(mysql); err == nil {
+		c.myQueue.GetQueue().AddAfter(key, d)
+	}
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/appscode/go/encoding/json/types"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	meta_util "kmodules.xyz/client-go/meta"
+	"kmodules.xyz/client-go/tools/queue"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+const (
+	// interval at which MySQLDatabases and MySQLUsers are checked against the servers, so that drift is
+	// corrected, and at which they are retried while the referenced MySQL is not running
+	schemaSyncInterval = time.Minute
+)
+
+// getRunningMySQL returns the MySQL referenced by spec.databaseRef of a MySQLDatabase or a MySQLUser,
+// if it is running.
+func (c *Controller) getRunningMySQL(namespace, name string) (*api.MySQL, error) {
+	mysql, err := c.myLister.MySQLs(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if mysql.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("MySQL %v/%v is being deleted", namespace, name)
+	}
+	if mysql.Status.Phase != api.DatabasePhaseRunning {
+		return nil, fmt.Errorf("MySQL %v/%v is not running", namespace, name)
+	}
+	return mysql.DeepCopy(), nil
+}
+
+// getMySQLForCleanup returns the MySQL that the objects of a deleted MySQLDatabase or MySQLUser are
+// dropped from. It returns nil if the MySQL is gone or being deleted, as its data goes with it.
+func (c *Controller) getMySQLForCleanup(namespace, name string) (*api.MySQL, error) {
+	mysql, err := c.myLister.MySQLs(namespace).Get(name)
+	if kerr.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if mysql.DeletionTimestamp != nil {
+		return nil, nil
+	}
+	if mysql.Status.Phase != api.DatabasePhaseRunning {
+		return nil, fmt.Errorf("MySQL %v/%v is not running", namespace, name)
+	}
+	return mysql.DeepCopy(), nil
+}
+
+// newObjectStatus returns the status of a MySQLDatabase or a MySQLUser, with the generation of obj observed.
+func newObjectStatus(obj metav1.Object, phase api.MySQLObjectPhase, reason string) *api.MySQLObjectStatus {
+	return &api.MySQLObjectStatus{
+		Phase:              phase,
+		Reason:             reason,
+		ObservedGeneration: types.NewIntHash(obj.GetGeneration(), meta_util.GenerationHash(obj)),
+	}
+}
+
+// isObjectStatusChanged reports whether st differs from the current status, so that an unchanged
+// status is not written on every sync.
+func isObjectStatusChanged(cur api.MySQLObjectStatus, st *api.MySQLObjectStatus) bool {
+	return cur.Phase != st.Phase || cur.Reason != st.Reason || !cur.ObservedGeneration.Equal(st.ObservedGeneration)
+}
+
+// isManagedBy reports whether obj is managed by one of others, that claim the same database or user on the
+// same MySQL. Only the oldest of them, ties broken by name, manages it, and the others fail, so that an
+// object is never changed by two of them.
+func isManagedBy(obj metav1.Object, others []metav1.Object) (metav1.Object, bool) {
+	for _, o := range others {
+		ts, ots := obj.GetCreationTimestamp(), o.GetCreationTimestamp()
+		if ots.Before(&ts) || (ots.Equal(&ts) && o.GetName() < obj.GetName()) {
+			return o, true
+		}
+	}
+	return nil, false
+}
+
+// resync adds the key of obj into q after schemaSyncInterval.
+func resync(q *queue.Worker, obj metav1.Object) {
+	q.GetQueue().AddAfter(obj.GetNamespace()+"/"+obj.GetName(), schemaSyncInterval)
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestIsManagedBy(t *testing.T) {
+	now := time.Now()
+	db := func(name string, created time.Time) *api.MySQLDatabase {
+		return &api.MySQLDatabase{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.Time{Time: created}}}
+	}
+	first := db("b", now.Add(-time.Hour))
+	second := db("a", now)
+	tie := db("c", now)
+
+	if owner, ok := isManagedBy(second, []metav1.Object{first, tie}); !ok || owner.GetName() != "b" {
+		t.Errorf("expected the older MySQLDatabase to manage the database, got %v", owner)
+	}
+	if _, ok := isManagedBy(first, []metav1.Object{second, tie}); ok {
+		t.Error("expected the oldest MySQLDatabase to manage the database")
+	}
+	// ties are broken by name
+	if owner, ok := isManagedBy(tie, []metav1.Object{second}); !ok || owner.GetName() != "a" {
+		t.Errorf("expected the MySQLDatabase with the first name to manage the database, got %v", owner)
+	}
+	if _, ok := isManagedBy(second, []metav1.Object{tie}); ok {
+		t.Error("expected the MySQLDatabase with the first name to manage the database")
+	}
+}
@@ -14,6 +14,8 @@ import (
 
 const (
 	mysqlUser = "root"
+	// user that the replicas of a MySQL cluster use to connect to the source
+	replicationUser = "repl"
 
 	KeyMySQLUser     = "username"
 	KeyMySQLPassword = "password"
@@ -39,6 +41,16 @@ func (c *Controller) ensureDatabaseSecret(mysql *api.MySQL) error {
 	return c.upgradeDatabaseSecret(mysql)
 }
 
+// generatePassword returns a random password that does not start with "-", as it would cause errors
+// in bash scripts (in mysql-tools).
+func generatePassword() string {
+	password := rand.GeneratePassword()
+	for password[0] == '-' {
+		password = rand.GeneratePassword()
+	}
+	return password
+}
+
 func (c *Controller) createDatabaseSecret(mysql *api.MySQL) (*core.SecretVolumeSource, error) {
 	authSecretName := mysql.Name + "-auth"
 
@@ -47,11 +59,7 @@ func (c *Controller) createDatabaseSecret(mysql *api.MySQL) (*core.SecretVolumeS
 		return nil, err
 	}
 	if sc == nil {
-		randPassword := ""
-
-		// if the password starts with "-", it will cause error in bash scripts (in mysql-tools)
-		for randPassword = rand.GeneratePassword(); randPassword[0] == '-'; {
-		}
+		randPassword := generatePassword()
 
 		secret := &core.Secret{
 			ObjectMeta: metav1.ObjectMeta{
@@ -73,6 +81,66 @@ func (c *Controller) createDatabaseSecret(mysql *api.MySQL) (*core.SecretVolumeS
 	}, nil
 }
 
+// ensureReplicationSecret generates the credentials of the replication user for a MySQL cluster,
+// unless they are provided in spec.replicationSecret. Replicas use them to connect to the source,
+// and members of a replication group for distributed recovery.
+func (c *Controller) ensureReplicationSecret(mysql *api.MySQL) error {
+	if !mysql.HasMemberRoles() {
+		return nil
+	}
+	if mysql.Spec.ReplicationSecret != nil {
+		_, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(mysql.Spec.ReplicationSecret.SecretName, metav1.GetOptions{})
+		if kerr.IsNotFound(err) {
+			return fmt.Errorf(`replication secret "%v/%v" not found`, mysql.Namespace, mysql.Spec.ReplicationSecret.SecretName)
+		}
+		return err
+	}
+
+	secretVolumeSource, err := c.createReplicationSecret(mysql)
+	if err != nil {
+		return err
+	}
+	ms, _, err := util.PatchMySQL(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQL) *api.MySQL {
+		in.Spec.ReplicationSecret = secretVolumeSource
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Spec.ReplicationSecret = ms.Spec.ReplicationSecret
+	return nil
+}
+
+func (c *Controller) createReplicationSecret(mysql *api.MySQL) (*core.SecretVolumeSource, error) {
+	secretName := mysql.Name + "-replication-auth"
+
+	sc, err := c.checkSecret(secretName, mysql)
+	if err != nil {
+		return nil, err
+	}
+	if sc == nil {
+		randPassword := generatePassword()
+
+		secret := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   secretName,
+				Labels: mysql.OffshootLabels(),
+			},
+			Type: core.SecretTypeOpaque,
+			StringData: map[string]string{
+				KeyMySQLUser:     replicationUser,
+				KeyMySQLPassword: randPassword,
+			},
+		}
+		if _, err := c.Client.CoreV1().Secrets(mysql.Namespace).Create(secret); err != nil {
+			return nil, err
+		}
+	}
+	return &core.SecretVolumeSource{
+		SecretName: secretName,
+	}, nil
+}
+
 // This is done to fix 0.8.0 -> 0.9.0 upgrade due to
 // https://github.com/kubedb/mysql/pull/115/files#diff-10ddaf307bbebafda149db10a28b9c24R17 commit
 func (c *Controller) upgradeDatabaseSecret(mysql *api.MySQL) error {
@@ -81,6 +149,15 @@ func (c *Controller) upgradeDatabaseSecret(mysql *api.MySQL) error {
 		Namespace: mysql.Namespace,
 	}
 
+	// The password of a running database can't be recovered once its secret is gone.
+	// So, never recreate a missing secret with empty credentials.
+	if _, err := c.Client.CoreV1().Secrets(meta.Namespace).Get(meta.Name, metav1.GetOptions{}); err != nil {
+		if kerr.IsNotFound(err) {
+			return fmt.Errorf(`database secret "%v/%v" not found`, meta.Namespace, meta.Name)
+		}
+		return err
+	}
+
 	_, _, err := core_util.CreateOrPatchSecret(c.Client, meta, func(in *core.Secret) *core.Secret {
 		if _, ok := in.Data[KeyMySQLUser]; !ok {
 			if val, ok2 := in.Data["user"]; ok2 {
@@ -43,6 +43,7 @@ func (c *Controller) ensureService(mysql *api.MySQL) (kutil.VerbType, error) {
 			"Successfully %s Service",
 			vt,
 		)
+		c.recordRepair(mysql, "Service", mysql.ServiceName(), vt)
 	}
 	return vt, nil
 }
@@ -81,6 +82,10 @@ func (c *Controller) createService(mysql *api.MySQL) (kutil.VerbType, error) {
 		in.Annotations = mysql.Spec.ServiceTemplate.Annotations
 
 		in.Spec.Selector = mysql.OffshootSelectors()
+		if mysql.HasMemberRoles() {
+			// clients of the main Service must only reach the writable member(s)
+			in.Spec.Selector = mysql.PrimaryServiceSelectors()
+		}
 		in.Spec.Ports = ofst.MergeServicePorts(
 			core_util.MergeServicePorts(in.Spec.Ports, []core.ServicePort{defaultDBPort}),
 			mysql.Spec.ServiceTemplate.Spec.Ports,
@@ -104,6 +109,51 @@ func (c *Controller) createService(mysql *api.MySQL) (kutil.VerbType, error) {
 	return ok, err
 }
 
+// ensureReplicasService creates the Service that selects the read-only secondary members of a MySQL cluster.
+// In Multi-Primary mode there are no read-only members, so no such Service is created.
+func (c *Controller) ensureReplicasService(mysql *api.MySQL) (kutil.VerbType, error) {
+	if !mysql.HasMemberRoles() || mysql.IsMultiPrimary() {
+		return kutil.VerbUnchanged, nil
+	}
+
+	// Check if replicas service name exists
+	if err := c.checkService(mysql, mysql.ReplicasServiceName()); err != nil {
+		return kutil.VerbUnchanged, err
+	}
+
+	ref, rerr := reference.GetReference(clientsetscheme.Scheme, mysql)
+	if rerr != nil {
+		return kutil.VerbUnchanged, rerr
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:      mysql.ReplicasServiceName(),
+		Namespace: mysql.Namespace,
+	}
+	_, vt, err := core_util.CreateOrPatchService(c.Client, meta, func(in *core.Service) *core.Service {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
+		in.Labels = mysql.OffshootLabels()
+		in.Annotations = mysql.Spec.ServiceTemplate.Annotations
+
+		in.Spec.Selector = mysql.ReplicasServiceSelectors()
+		in.Spec.Ports = core_util.MergeServicePorts(in.Spec.Ports, []core.ServicePort{defaultDBPort})
+		return in
+	})
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	} else if vt != kutil.VerbUnchanged {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			eventer.EventReasonSuccessful,
+			"Successfully %s replicas service",
+			vt,
+		)
+		c.recordRepair(mysql, "Service", mysql.ReplicasServiceName(), vt)
+	}
+	return vt, nil
+}
+
 func (c *Controller) ensureStatsService(mysql *api.MySQL) (kutil.VerbType, error) {
 	// return if monitoring is not prometheus
 	if mysql.GetMonitoringVendor() != mona.VendorPrometheus {
@@ -187,7 +237,9 @@ func (c *Controller) createMySQLGoverningService(mysql *api.MySQL) (string, erro
 	core_util.EnsureOwnerReference(&service.ObjectMeta, ref)
 
 	_, err := c.Client.CoreV1().Services(mysql.Namespace).Create(service)
-	if err != nil && !kerr.IsAlreadyExists(err) {
+	if err == nil {
+		c.recordRepair(mysql, "Service", service.Name, kutil.VerbCreated)
+	} else if !kerr.IsAlreadyExists(err) {
 		return "", err
 	}
 	return service.Name, nil
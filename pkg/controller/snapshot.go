@@ -54,9 +54,46 @@ func (c *Controller) ValidateSnapshot(snapshot *api.Snapshot) error {
 		return fmt.Errorf(`object 'DatabaseName' is missing in '%v'`, snapshot.Spec)
 	}
 
-	if _, err := c.myLister.MySQLs(snapshot.Namespace).Get(databaseName); err != nil {
+	mysql, err := c.myLister.MySQLs(snapshot.Namespace).Get(databaseName)
+	if err != nil {
+		return err
+	}
+
+	// the folder of the Snapshot would be the folder of the archived binary logs
+	if snapshot.Name == binlogFolder {
+		return fmt.Errorf(`name of Snapshot %v/%v is reserved for the binary logs of MySQL %v`, snapshot.Namespace, snapshot.Name, databaseName)
+	}
+
+	if err := amv.ValidateBackupMethod(snapshot.Spec.Method); err != nil {
+		return err
+	}
+	if err := amv.ValidateBackupTarget(snapshot.Spec.Target); err != nil {
 		return err
 	}
+	if err := amv.ValidateBackupCompression(snapshot.Spec.Compression); err != nil {
+		return err
+	}
+	if err := amv.ValidateBackupEncryption(c.Client, snapshot.Spec.Encryption, snapshot.Namespace); err != nil {
+		return err
+	}
+	if err := amv.ValidateBackupVerification(snapshot.Spec.Verification); err != nil {
+		return err
+	}
+	// the backup Job mounts the data volume of a server
+	if isPhysicalSnapshot(snapshot) && mysql.Spec.StorageType == api.StorageTypeEphemeral {
+		return fmt.Errorf(`method "%v" of Snapshot %v/%v can not be used for MySQL %v with "%v" storage`,
+			api.BackupMethodPhysical, snapshot.Namespace, snapshot.Name, databaseName, api.StorageTypeEphemeral)
+	}
+	if isPhysicalSnapshot(snapshot) {
+		mysqlVersion, err := c.ExtClient.CatalogV1alpha1().MySQLVersions().Get(string(mysql.Spec.Version), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !mysqlVersion.Spec.Xtrabackup {
+			return fmt.Errorf(`method "%v" of Snapshot %v/%v can not be used for MySQL %v, xtrabackup is not available for mysqlVersion %q`,
+				api.BackupMethodPhysical, snapshot.Namespace, snapshot.Name, databaseName, mysqlVersion.Name)
+		}
+	}
 
 	return amv.ValidateSnapshotSpec(snapshot.Spec.Backend)
 }
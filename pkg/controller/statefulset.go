@@ -27,17 +27,23 @@ func (c *Controller) ensureStatefulSet(mysql *api.MySQL) (kutil.VerbType, error)
 		return kutil.VerbUnchanged, err
 	}
 
+	replicas := mysql.Spec.Replicas
+	if mysql.IsGroupReplication() {
+		var err error
+		if replicas, err = c.groupStatefulSetReplicas(mysql); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+	}
+
 	// Create statefulSet for MySQL database
-	statefulSet, vt, err := c.createStatefulSet(mysql)
+	statefulSet, vt, err := c.createStatefulSet(mysql, replicas)
 	if err != nil {
 		return kutil.VerbUnchanged, err
 	}
 
-	// Check StatefulSet Pod status
+	// Pod readiness is not waited for here. The StatefulSet and Pod watchers
+	// re-enqueue the MySQL as replicas become ready.
 	if vt != kutil.VerbUnchanged {
-		if err := c.checkStatefulSetPodStatus(statefulSet); err != nil {
-			return kutil.VerbUnchanged, err
-		}
 		c.recorder.Eventf(
 			mysql,
 			core.EventTypeNormal,
@@ -45,6 +51,7 @@ func (c *Controller) ensureStatefulSet(mysql *api.MySQL) (kutil.VerbType, error)
 			"Successfully %v StatefulSet",
 			vt,
 		)
+		c.recordRepair(mysql, "StatefulSet", statefulSet.Name, vt)
 	}
 
 	// ensure pdb
@@ -73,7 +80,7 @@ func (c *Controller) checkStatefulSet(mysql *api.MySQL) error {
 	return nil
 }
 
-func (c *Controller) createStatefulSet(mysql *api.MySQL) (*apps.StatefulSet, kutil.VerbType, error) {
+func (c *Controller) createStatefulSet(mysql *api.MySQL, replicas *int32) (*apps.StatefulSet, kutil.VerbType, error) {
 	statefulSetMeta := metav1.ObjectMeta{
 		Name:      mysql.OffshootName(),
 		Namespace: mysql.Namespace,
@@ -88,19 +95,27 @@ func (c *Controller) createStatefulSet(mysql *api.MySQL) (*apps.StatefulSet, kut
 	if err != nil {
 		return nil, kutil.VerbUnchanged, rerr
 	}
+	archiver, err := c.binlogArchiverContainer(mysql, mysqlVersion)
+	if err != nil {
+		return nil, kutil.VerbUnchanged, err
+	}
+	restore, snapshot, err := c.physicalRestoreContainer(mysql, mysqlVersion)
+	if err != nil {
+		return nil, kutil.VerbUnchanged, err
+	}
 
 	return app_util.CreateOrPatchStatefulSet(c.Client, statefulSetMeta, func(in *apps.StatefulSet) *apps.StatefulSet {
 		in.Labels = mysql.OffshootLabels()
 		in.Annotations = mysql.Spec.PodTemplate.Controller.Annotations
 		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
 
-		in.Spec.Replicas = mysql.Spec.Replicas
+		in.Spec.Replicas = replicas
 		in.Spec.ServiceName = c.GoverningService
 		in.Spec.Selector = &metav1.LabelSelector{
 			MatchLabels: mysql.OffshootSelectors(),
 		}
 		in.Spec.Template.Labels = mysql.OffshootSelectors()
-		in.Spec.Template.Annotations = mysql.Spec.PodTemplate.Annotations
+		in.Spec.Template.Annotations = podTemplateAnnotations(mysql)
 		in.Spec.Template.Spec.InitContainers = core_util.UpsertContainers(
 			in.Spec.Template.Spec.InitContainers,
 			append(
@@ -126,12 +141,13 @@ func (c *Controller) createStatefulSet(mysql *api.MySQL) (*apps.StatefulSet, kut
 				mysql.Spec.PodTemplate.Spec.InitContainers...,
 			),
 		)
+		in = upsertPhysicalRestore(in, restore, mysql, snapshot)
 
 		container := core.Container{
 			Name:            api.ResourceSingularMySQL,
 			Image:           mysqlVersion.Spec.DB.Image,
 			ImagePullPolicy: core.PullIfNotPresent,
-			Args:            mysql.Spec.PodTemplate.Spec.Args,
+			Args:            serverArgs(mysql),
 			Resources:       mysql.Spec.PodTemplate.Spec.Resources,
 			LivenessProbe:   mysql.Spec.PodTemplate.Spec.LivenessProbe,
 			ReadinessProbe:  mysql.Spec.PodTemplate.Spec.ReadinessProbe,
@@ -149,7 +165,7 @@ func (c *Controller) createStatefulSet(mysql *api.MySQL) (*apps.StatefulSet, kut
 			container.Command = []string{
 				"peer-finder",
 			}
-			userProvidedArgs := strings.Join(mysql.Spec.PodTemplate.Spec.Args, " ")
+			userProvidedArgs := strings.Join(serverArgs(mysql), " ")
 			container.Args = []string{
 				fmt.Sprintf("-service=%s", c.GoverningService),
 				fmt.Sprintf("-on-start=/on-start.sh %s", userProvidedArgs),
@@ -160,6 +176,14 @@ func (c *Controller) createStatefulSet(mysql *api.MySQL) (*apps.StatefulSet, kut
 			if container.ReadinessProbe != nil && structs.IsZero(*container.ReadinessProbe) {
 				container.ReadinessProbe = nil
 			}
+		} else if mysql.IsReplication() {
+			container.Command = []string{
+				"bash",
+				"-c",
+			}
+			container.Args = []string{
+				replicationStartScript(serverArgs(mysql)),
+			}
 		}
 		in.Spec.Template.Spec.Containers = core_util.UpsertContainer(in.Spec.Template.Spec.Containers, container)
 
@@ -173,9 +197,9 @@ func (c *Controller) createStatefulSet(mysql *api.MySQL) (*apps.StatefulSet, kut
 					"-c",
 					// DATA_SOURCE_NAME=user:password@tcp(localhost:5555)/dbname
 					// ref: https://github.com/prometheus/mysqld_exporter#setting-the-mysql-servers-data-source-name
-					fmt.Sprintf(`export DATA_SOURCE_NAME="${MYSQL_ROOT_USERNAME:-}:${MYSQL_ROOT_PASSWORD:-}@(127.0.0.1:3306)/"
+					fmt.Sprintf(`export DATA_SOURCE_NAME="${MYSQL_ROOT_USERNAME:-}:${MYSQL_ROOT_PASSWORD:-}@(127.0.0.1:3306)/%v"
 						/bin/mysqld_exporter --web.listen-address=:%v --web.telemetry-path=%v %v`,
-						mysql.Spec.Monitor.Prometheus.Port, mysql.StatsService().Path(), strings.Join(mysql.Spec.Monitor.Args, " ")),
+						exporterDSNParams(mysql), mysql.Spec.Monitor.Prometheus.Port, mysql.StatsService().Path(), strings.Join(mysql.Spec.Monitor.Args, " ")),
 				},
 				Image: mysqlVersion.Spec.Exporter.Image,
 				Ports: []core.ContainerPort{
@@ -194,9 +218,16 @@ func (c *Controller) createStatefulSet(mysql *api.MySQL) (*apps.StatefulSet, kut
 		in = upsertEnv(in, mysql)
 		in = upsertDataVolume(in, mysql)
 		in = upsertCustomConfig(in, mysql)
+		in = upsertTLSVolume(in, mysql)
+		in = upsertBinlogArchiver(in, mysql, archiver)
 
 		if mysql.Spec.Init != nil && mysql.Spec.Init.ScriptSource != nil {
-			in = upsertInitScript(in, mysql.Spec.Init.ScriptSource.VolumeSource)
+			initScriptPath := "/docker-entrypoint-initdb.d"
+			if mysql.IsReplication() {
+				// staged by replicationStartScript for the source only
+				initScriptPath = replicationInitScriptPath
+			}
+			in = upsertInitScript(in, mysql.Spec.Init.ScriptSource.VolumeSource, initScriptPath)
 		}
 
 		in.Spec.Template.Spec.NodeSelector = mysql.Spec.PodTemplate.Spec.NodeSelector
@@ -215,6 +246,12 @@ func (c *Controller) createStatefulSet(mysql *api.MySQL) (*apps.StatefulSet, kut
 		}
 
 		in.Spec.UpdateStrategy = mysql.Spec.UpdateStrategy
+		if mysql.IsGroupReplication() {
+			// pods of a replication group are restarted by ensureGroupRollout
+			in.Spec.UpdateStrategy = apps.StatefulSetUpdateStrategy{
+				Type: apps.OnDeleteStatefulSetStrategyType,
+			}
+		}
 		in = upsertUserEnv(in, mysql)
 
 		return in
@@ -332,6 +369,52 @@ func upsertEnv(statefulSet *apps.StatefulSet, mysql *api.MySQL) *apps.StatefulSe
 						Name:  "BASE_SERVER_ID",
 						Value: strconv.Itoa(int(*mysql.Spec.Topology.Group.BaseServerID)),
 					},
+					{
+						Name:  "GROUP_MODE",
+						Value: string(groupMode(mysql)),
+					},
+					{
+						Name: "REPLICATION_USER",
+						ValueFrom: &core.EnvVarSource{
+							SecretKeyRef: &core.SecretKeySelector{
+								LocalObjectReference: core.LocalObjectReference{
+									Name: mysql.Spec.ReplicationSecret.SecretName,
+								},
+								Key: KeyMySQLUser,
+							},
+						},
+					},
+					{
+						Name: "REPLICATION_PASSWORD",
+						ValueFrom: &core.EnvVarSource{
+							SecretKeyRef: &core.SecretKeySelector{
+								LocalObjectReference: core.LocalObjectReference{
+									Name: mysql.Spec.ReplicationSecret.SecretName,
+								},
+								Key: KeyMySQLPassword,
+							},
+						},
+					},
+				}...)
+			}
+			if mysql.IsReplication() && container.Name == api.ResourceSingularMySQL {
+				envs = append(envs, []core.EnvVar{
+					{
+						Name:  "GOV_SVC",
+						Value: mysql.GoverningServiceName(),
+					},
+					{
+						Name: "POD_NAMESPACE",
+						ValueFrom: &core.EnvVarSource{
+							FieldRef: &core.ObjectFieldSelector{
+								FieldPath: "metadata.namespace",
+							},
+						},
+					},
+					{
+						Name:  "BASE_SERVER_ID",
+						Value: strconv.Itoa(int(*mysql.Spec.Topology.Replication.BaseServerID)),
+					},
 				}...)
 			}
 			statefulSet.Spec.Template.Spec.Containers[i].Env = core_util.UpsertEnvVars(container.Env, envs...)
@@ -352,12 +435,12 @@ func upsertUserEnv(statefulSet *apps.StatefulSet, mysql *api.MySQL) *apps.Statef
 	return statefulSet
 }
 
-func upsertInitScript(statefulSet *apps.StatefulSet, script core.VolumeSource) *apps.StatefulSet {
+func upsertInitScript(statefulSet *apps.StatefulSet, script core.VolumeSource, mountPath string) *apps.StatefulSet {
 	for i, container := range statefulSet.Spec.Template.Spec.Containers {
 		if container.Name == api.ResourceSingularMySQL {
 			volumeMount := core.VolumeMount{
 				Name:      "initial-script",
-				MountPath: "/docker-entrypoint-initdb.d",
+				MountPath: mountPath,
 			}
 			statefulSet.Spec.Template.Spec.Containers[i].VolumeMounts = core_util.UpsertVolumeMount(
 				container.VolumeMounts,
@@ -378,21 +461,32 @@ func upsertInitScript(statefulSet *apps.StatefulSet, script core.VolumeSource) *
 	return statefulSet
 }
 
-func (c *Controller) checkStatefulSetPodStatus(statefulSet *apps.StatefulSet) error {
-	err := core_util.WaitUntilPodRunningBySelector(
-		c.Client,
-		statefulSet.Namespace,
-		statefulSet.Spec.Selector,
-		int(types.Int32(statefulSet.Spec.Replicas)),
-	)
+// checkReplicasReady reports whether all the replicas of the StatefulSet are ready, as
+// observed by the StatefulSet watcher. It never blocks.
+func (c *Controller) checkReplicasReady(mysql *api.MySQL, conditions *conditionSet) bool {
+	statefulSet, err := c.stsLister.StatefulSets(mysql.Namespace).Get(mysql.OffshootName())
 	if err != nil {
-		return err
+		if kerr.IsNotFound(err) {
+			// not yet observed by the watcher
+			conditions.set(api.MySQLConditionAllReplicasReady, core.ConditionFalse, ConditionReasonProvisioning, "StatefulSet is not observed yet")
+			return false
+		}
+		conditions.failed(api.MySQLConditionAllReplicasReady, err)
+		return false
 	}
-	return nil
+	replicas := types.Int32(statefulSet.Spec.Replicas)
+	msg := fmt.Sprintf("%d of %d replicas are ready", statefulSet.Status.ReadyReplicas, replicas)
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation ||
+		statefulSet.Status.ReadyReplicas < replicas {
+		conditions.set(api.MySQLConditionAllReplicasReady, core.ConditionFalse, ConditionReasonProvisioning, msg)
+		return false
+	}
+	conditions.ready(api.MySQLConditionAllReplicasReady, msg)
+	return true
 }
 
 func upsertCustomConfig(statefulSet *apps.StatefulSet, mysql *api.MySQL) *apps.StatefulSet {
-	if mysql.Spec.ConfigSource != nil {
+	if source := configVolumeSource(mysql); source != nil {
 		for i, container := range statefulSet.Spec.Template.Spec.Containers {
 			if container.Name == api.ResourceSingularMySQL {
 				configVolumeMount := core.VolumeMount{
@@ -405,7 +499,7 @@ func upsertCustomConfig(statefulSet *apps.StatefulSet, mysql *api.MySQL) *apps.S
 
 				configVolume := core.Volume{
 					Name:         "custom-config",
-					VolumeSource: *mysql.Spec.ConfigSource,
+					VolumeSource: *source,
 				}
 
 				volumes := statefulSet.Spec.Template.Spec.Volumes
@@ -417,3 +511,91 @@ func upsertCustomConfig(statefulSet *apps.StatefulSet, mysql *api.MySQL) *apps.S
 	}
 	return statefulSet
 }
+
+// upsertTLSVolume mounts the server certificate for spec.tls into the mysql container.
+func upsertTLSVolume(statefulSet *apps.StatefulSet, mysql *api.MySQL) *apps.StatefulSet {
+	if mysql.Spec.TLS == nil {
+		return statefulSet
+	}
+	for i, container := range statefulSet.Spec.Template.Spec.Containers {
+		if container.Name == api.ResourceSingularMySQL {
+			statefulSet.Spec.Template.Spec.Containers[i].VolumeMounts = core_util.UpsertVolumeMount(
+				container.VolumeMounts,
+				core.VolumeMount{
+					Name:      "tls",
+					MountPath: tlsCertMountPath,
+					ReadOnly:  true,
+				},
+			)
+			statefulSet.Spec.Template.Spec.Volumes = core_util.UpsertVolume(
+				statefulSet.Spec.Template.Spec.Volumes,
+				core.Volume{
+					Name: "tls",
+					VolumeSource: core.VolumeSource{
+						Secret: &core.SecretVolumeSource{
+							SecretName: mysql.TLSServerSecretName(),
+						},
+					},
+				},
+			)
+			break
+		}
+	}
+	return statefulSet
+}
+
+// exporterDSNParams returns the parameters of the data source name of the exporter. With spec.tls, the
+// exporter connects with TLS, as the server may require it even from 127.0.0.1. The certificate is not
+// verified, as the CA is not mounted into the exporter container.
+func exporterDSNParams(mysql *api.MySQL) string {
+	if mysql.Spec.TLS == nil {
+		return ""
+	}
+	return "?tls=skip-verify"
+}
+
+func groupMode(mysql *api.MySQL) api.MySQLGroupMode {
+	if mysql.IsMultiPrimary() {
+		return api.MySQLGroupModeMultiPrimary
+	}
+	return api.MySQLGroupModeSinglePrimary
+}
+
+// replicationInitScriptPath is where the init scripts are mounted for asynchronous replication.
+const replicationInitScriptPath = "/kubedb/initdb.d"
+
+// replicationStartScript wraps the entrypoint of the mysql image, so that each server of an
+// asynchronous replication cluster starts with GTIDs enabled and a unique server_id.
+// Only the first server is initialized with time zone tables and init scripts, the others
+// receive them through replication from the source. Every server starts read-only until the
+// operator makes the source writable. "$$" escapes "$" from expansion by the kubelet. The args are
+// quoted, so that they are passed to mysqld as they are.
+func replicationStartScript(userArgs []string) string {
+	quoted := make([]string, 0, len(userArgs))
+	for _, arg := range userArgs {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return fmt.Sprintf(`ordinal=${HOSTNAME##*-}
+if [ "$ordinal" != "0" ]; then
+  export MYSQL_INITDB_SKIP_TZINFO=yes
+elif [ -d %[1]s ]; then
+  ln -sf %[1]s/* /docker-entrypoint-initdb.d/
+fi
+exec docker-entrypoint.sh mysqld \
+  --server-id=$$((BASE_SERVER_ID + ordinal)) \
+  --report-host=${HOSTNAME}.${GOV_SVC}.${POD_NAMESPACE} \
+  --log-bin=binlog \
+  --relay-log=relay-bin \
+  --binlog-format=ROW \
+  --log-slave-updates=ON \
+  --gtid-mode=ON \
+  --enforce-gtid-consistency=ON \
+  --master-info-repository=TABLE \
+  --relay-log-info-repository=TABLE \
+  --read-only=ON %[2]s`, replicationInitScriptPath, strings.Join(quoted, " "))
+}
+
+// shellQuote quotes s as a single word for bash.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	amc "kubedb.dev/apimachinery/pkg/controller"
+)
+
+const (
+	// where the passphrase that a Snapshot is encrypted with is mounted in the backup and restore containers
+	encryptionKeyMountPath = "/etc/backup-encryption"
+	encryptionKeyFile      = "key"
+
+	encryptionKeyVolumeName = "encryption-key"
+)
+
+// snapshotScratchVolume returns the working directory of the backup and restore Jobs. Backups are
+// streamed to and from the backend, so it holds no dump, and is never backed by a PVC.
+func snapshotScratchVolume() core.Volume {
+	return core.Volume{
+		Name: amc.UtilVolumeName,
+		VolumeSource: core.VolumeSource{
+			EmptyDir: &core.EmptyDirVolumeSource{},
+		},
+	}
+}
+
+// snapshotStreamArgs returns the args of mysql-tools that compress and encrypt the backup of snapshot
+// as it is streamed to the backend, and reverse it on restore.
+func snapshotStreamArgs(snapshot *api.Snapshot) []string {
+	var args []string
+	if snapshot.Spec.Compression != "" {
+		args = append(args, fmt.Sprintf(`--compression=%s`, strings.ToLower(string(snapshot.Spec.Compression))))
+	}
+	if snapshot.Spec.Encryption != nil {
+		args = append(args, fmt.Sprintf(`--encryption-key-file=%s`, filepath.Join(encryptionKeyMountPath, encryptionKeyFile)))
+	}
+	return args
+}
+
+// encryptionKeyVolume returns a volume with the passphrase that snapshot is encrypted with, and its
+// mount, or nil if snapshot is not encrypted.
+func encryptionKeyVolume(snapshot *api.Snapshot, name string) (*core.Volume, *core.VolumeMount) {
+	if snapshot.Spec.Encryption == nil {
+		return nil, nil
+	}
+	ref := snapshot.Spec.Encryption.SecretKeyRef
+	volume := &core.Volume{
+		Name: name,
+		VolumeSource: core.VolumeSource{
+			Secret: &core.SecretVolumeSource{
+				SecretName: ref.Name,
+				Items: []core.KeyToPath{
+					{
+						Key:  ref.Key,
+						Path: encryptionKeyFile,
+					},
+				},
+			},
+		},
+	}
+	mount := &core.VolumeMount{
+		Name:      name,
+		MountPath: encryptionKeyMountPath,
+		ReadOnly:  true,
+	}
+	return volume, mount
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestSnapshotStreamArgs(t *testing.T) {
+	snapshot := &api.Snapshot{}
+	if args := snapshotStreamArgs(snapshot); len(args) != 0 {
+		t.Errorf("expected no args, got %v", args)
+	}
+	if volume, mount := encryptionKeyVolume(snapshot, encryptionKeyVolumeName); volume != nil || mount != nil {
+		t.Errorf("expected no encryption key volume, got %+v", volume)
+	}
+
+	snapshot.Spec.Compression = api.BackupCompressionZstd
+	snapshot.Spec.Encryption = &api.BackupEncryptionSpec{
+		SecretKeyRef: core.SecretKeySelector{
+			LocalObjectReference: core.LocalObjectReference{Name: "backup-key"},
+			Key:                  "passphrase",
+		},
+	}
+	expected := []string{"--compression=zstd", "--encryption-key-file=/etc/backup-encryption/key"}
+	if args := snapshotStreamArgs(snapshot); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	volume, mount := encryptionKeyVolume(snapshot, encryptionKeyVolumeName)
+	if volume == nil || volume.Secret.SecretName != "backup-key" ||
+		!reflect.DeepEqual(volume.Secret.Items, []core.KeyToPath{{Key: "passphrase", Path: "key"}}) {
+		t.Errorf("unexpected encryption key volume %+v", volume)
+	}
+	if mount == nil || mount.Name != volume.Name || mount.MountPath != "/etc/backup-encryption" {
+		t.Errorf("unexpected encryption key mount %+v", mount)
+	}
+}
@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"bytes"
+	"crypto"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"path/filepath"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/reference"
+	"k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	core_util "kmodules.xyz/client-go/core/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+)
+
+const (
+	EventReasonCertificateIssued = "CertificateIssued"
+
+	// where the server certificate Secret is mounted in the mysql container
+	tlsCertMountPath = "/etc/mysql/certs"
+
+	tlsCACertKey = "ca.crt"
+	tlsCAKeyKey  = "ca.key"
+	// the CA certificate that the server certificate was signed with before the CA changed, that the
+	// servers which are not restarted yet present certificates of
+	tlsPreviousCACertKey = "previous-ca.crt"
+
+	// annotation on the pod template with the serial number of the server certificate that the server is started with
+	tlsSerialAnnotation = api.MySQLKey + "/tls-serial"
+)
+
+func tlsCertDuration(mysql *api.MySQL) time.Duration {
+	if mysql.Spec.TLS.Duration != nil {
+		return mysql.Spec.TLS.Duration.Duration
+	}
+	return api.MySQLDefaultCertDuration
+}
+
+func tlsCertRenewBefore(mysql *api.MySQL) time.Duration {
+	if mysql.Spec.TLS.RenewBefore != nil {
+		return mysql.Spec.TLS.RenewBefore.Duration
+	}
+	return api.MySQLDefaultCertRenewBefore
+}
+
+// ensureTLS issues the server certificate for spec.tls, signed by the CA in spec.tls.issuerSecret or by a
+// CA generated by the operator. The certificate is renewed before it expires. Its serial number is recorded
+// in status, and stamped on the pod template, so that the servers are restarted to load a new certificate.
+func (c *Controller) ensureTLS(mysql *api.MySQL) error {
+	if mysql.Spec.TLS == nil {
+		if mysql.Status.TLS == nil {
+			return nil
+		}
+		return c.updateTLSStatus(mysql, nil)
+	}
+
+	caCert, caKey, err := c.getTLSIssuer(mysql)
+	if err != nil {
+		return err
+	}
+
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(mysql.TLSServerSecretName(), metav1.GetOptions{})
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	var serverCert *x509.Certificate
+	if err == nil && bytes.Equal(secret.Data[tlsCACertKey], encodeCertPEM(caCert)) {
+		if certs, err := cert.ParseCertsPEM(secret.Data[core.TLSCertKey]); err == nil && len(certs) > 0 {
+			serverCert = certs[0]
+		}
+	}
+
+	if serverCert == nil || time.Until(serverCert.NotAfter) < tlsCertRenewBefore(mysql) {
+		if serverCert, err = c.issueServerCert(mysql, caCert, caKey); err != nil {
+			return fmt.Errorf("failed to issue server certificate. Reason: %v", err)
+		}
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			EventReasonCertificateIssued,
+			"Issued server certificate with serial number %v, valid until %v",
+			serverCert.SerialNumber.Text(16),
+			serverCert.NotAfter.UTC().Format(time.RFC3339),
+		)
+	}
+	// renew the certificate in time, even if the MySQL is not resynced
+	c.requeueAfter(mysql, time.Until(serverCert.NotAfter)-tlsCertRenewBefore(mysql))
+
+	notAfter := metav1.NewTime(serverCert.NotAfter)
+	st := &api.MySQLTLSStatus{
+		SerialNumber: serverCert.SerialNumber.Text(16),
+		NotAfter:     &notAfter,
+	}
+	if mysql.Status.TLS != nil && mysql.Status.TLS.SerialNumber == st.SerialNumber {
+		return nil
+	}
+	return c.updateTLSStatus(mysql, st)
+}
+
+func (c *Controller) updateTLSStatus(mysql *api.MySQL, st *api.MySQLTLSStatus) error {
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		in.TLS = st
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+	return nil
+}
+
+// getTLSIssuer returns the CA certificate and key from spec.tls.issuerSecret. If it is not set, a CA
+// is generated once, and kept in a Secret owned by the MySQL.
+func (c *Controller) getTLSIssuer(mysql *api.MySQL) (*x509.Certificate, crypto.Signer, error) {
+	name := mysql.TLSCASecretName()
+	if mysql.Spec.TLS.IssuerSecret != nil {
+		name = mysql.Spec.TLS.IssuerSecret.Name
+	}
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) && mysql.Spec.TLS.IssuerSecret == nil {
+		secret, err = c.createTLSCASecret(mysql)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certs, err := cert.ParseCertsPEM(secret.Data[tlsCACertKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf(`failed to parse %v of secret "%v/%v". Reason: %v`, tlsCACertKey, secret.Namespace, secret.Name, err)
+	}
+	key, err := keyutil.ParsePrivateKeyPEM(secret.Data[tlsCAKeyKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf(`failed to parse %v of secret "%v/%v". Reason: %v`, tlsCAKeyKey, secret.Namespace, secret.Name, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf(`%v of secret "%v/%v" is not a signing key`, tlsCAKeyKey, secret.Namespace, secret.Name)
+	}
+	return certs[0], signer, nil
+}
+
+func (c *Controller) createTLSCASecret(mysql *api.MySQL) (*core.Secret, error) {
+	ref, rerr := reference.GetReference(clientsetscheme.Scheme, mysql)
+	if rerr != nil {
+		return nil, rerr
+	}
+	key, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := cert.NewSelfSignedCACert(cert.Config{CommonName: mysql.OffshootName() + "-ca"}, key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mysql.TLSCASecretName(),
+			Namespace: mysql.Namespace,
+			Labels:    mysql.OffshootLabels(),
+		},
+		Data: map[string][]byte{
+			tlsCACertKey: encodeCertPEM(caCert),
+			tlsCAKeyKey:  keyPEM,
+		},
+	}
+	core_util.EnsureOwnerReference(&secret.ObjectMeta, ref)
+	return c.Client.CoreV1().Secrets(mysql.Namespace).Create(secret)
+}
+
+// issueServerCert signs a new server certificate for the Services and pods of the MySQL, and stores
+// it in the Secret that is mounted into the mysql container, along with the CA certificate. If the CA
+// changed, the previous CA certificate is kept too.
+func (c *Controller) issueServerCert(mysql *api.MySQL, caCert *x509.Certificate, caKey crypto.Signer) (*x509.Certificate, error) {
+	ref, rerr := reference.GetReference(clientsetscheme.Scheme, mysql)
+	if rerr != nil {
+		return nil, rerr
+	}
+	key, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := cryptorand.Int(cryptorand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: mysql.ServiceName(),
+		},
+		DNSNames:    serverCertDNSNames(mysql),
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:   now.Add(-5 * time.Minute).UTC(),
+		NotAfter:    now.Add(tlsCertDuration(mysql)).UTC(),
+		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, &tmpl, caCert, key.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	serverCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:      mysql.TLSServerSecretName(),
+		Namespace: mysql.Namespace,
+	}
+	_, _, err = core_util.CreateOrPatchSecret(c.Client, meta, func(in *core.Secret) *core.Secret {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
+		in.Labels = mysql.OffshootLabels()
+		in.Data = serverCertSecretData(in.Data, encodeCertPEM(caCert), encodeCertPEM(serverCert), keyPEM)
+		return in
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serverCert, nil
+}
+
+// serverCertSecretData returns the data of the server certificate Secret, whose current data is old.
+// The CA certificate that old has is kept as the previous one, if the CA changed.
+func serverCertSecretData(old map[string][]byte, caPEM, certPEM, keyPEM []byte) map[string][]byte {
+	previous := old[tlsPreviousCACertKey]
+	if cur := old[tlsCACertKey]; len(cur) > 0 && !bytes.Equal(cur, caPEM) {
+		previous = cur
+	}
+	data := map[string][]byte{
+		tlsCACertKey:          caPEM,
+		core.TLSCertKey:       certPEM,
+		core.TLSPrivateKeyKey: keyPEM,
+	}
+	if len(previous) > 0 {
+		data[tlsPreviousCACertKey] = previous
+	}
+	return data
+}
+
+// serverCertDNSNames returns the names that clients reach the servers with, ie, the Services
+// of the MySQL and the peer addresses of its pods.
+func serverCertDNSNames(mysql *api.MySQL) []string {
+	var names []string
+	for _, host := range []string{mysql.ServiceName(), mysql.ReplicasServiceName(), "*." + mysql.GoverningServiceName()} {
+		names = append(names,
+			host,
+			fmt.Sprintf("%s.%s", host, mysql.Namespace),
+			fmt.Sprintf("%s.%s.svc", host, mysql.Namespace),
+		)
+	}
+	return append(names, "localhost")
+}
+
+// getTLSCACert returns the PEM encoded CA certificate that the server certificate is signed with.
+func (c *Controller) getTLSCACert(mysql *api.MySQL) ([]byte, error) {
+	ca, _, err := c.getTLSCACerts(mysql)
+	return ca, err
+}
+
+// getTLSCACerts returns the PEM encoded CA certificate that the server certificate is signed with, and
+// the one that the previous server certificate was signed with, if the CA changed.
+func (c *Controller) getTLSCACerts(mysql *api.MySQL) ([]byte, []byte, error) {
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(mysql.TLSServerSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return secret.Data[tlsCACertKey], secret.Data[tlsPreviousCACertKey], nil
+}
+
+func encodeCertPEM(crt *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  cert.CertificateBlockType,
+		Bytes: crt.Raw,
+	})
+}
+
+// tlsServerArgs returns the arguments of mysqld that load the server certificate.
+func tlsServerArgs(mysql *api.MySQL) []string {
+	if mysql.Spec.TLS == nil {
+		return nil
+	}
+	args := []string{
+		"--ssl-ca=" + filepath.Join(tlsCertMountPath, tlsCACertKey),
+		"--ssl-cert=" + filepath.Join(tlsCertMountPath, core.TLSCertKey),
+		"--ssl-key=" + filepath.Join(tlsCertMountPath, core.TLSPrivateKeyKey),
+	}
+	if mysql.Spec.TLS.RequireSecureTransport {
+		args = append(args, "--require-secure-transport=ON")
+	}
+	return args
+}
+
+// serverArgs returns the arguments of mysqld, ie, the arguments in the pod template and those for
+// spec.tls and for the binary logs of a standalone server.
+func serverArgs(mysql *api.MySQL) []string {
+	args := append(append([]string(nil), mysql.Spec.PodTemplate.Spec.Args...), tlsServerArgs(mysql)...)
+	return append(args, binlogServerArgs(mysql)...)
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	amc "kubedb.dev/apimachinery/pkg/controller"
+)
+
+func TestIssueServerCert(t *testing.T) {
+	c := &Controller{Controller: &amc.Controller{Client: fake.NewSimpleClientset()}}
+	mysql := &api.MySQL{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       api.ResourceKindMySQL,
+			APIVersion: api.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "demo",
+		},
+		Spec: api.MySQLSpec{
+			TLS: &api.MySQLTLSConfig{},
+		},
+	}
+
+	caCert, caKey, err := c.getTLSIssuer(mysql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := c.issueServerCert(mysql, caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(serverCert.NotAfter); d < api.MySQLDefaultCertDuration-time.Minute || d > api.MySQLDefaultCertDuration {
+		t.Errorf("expected server certificate to be valid for %v, got %v", api.MySQLDefaultCertDuration, d)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	for _, host := range []string{mysql.PeerName(0), mysql.ServiceName(), mysql.ServiceName() + ".demo.svc", "127.0.0.1"} {
+		if _, err := serverCert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("server certificate is not valid for %v: %v", host, err)
+		}
+	}
+
+	// the CA is generated once, and the Secret mounted into the pods has the CA certificate
+	again, _, err := c.getTLSIssuer(mysql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Equal(caCert) {
+		t.Errorf("expected the generated CA to be reused")
+	}
+	secret, err := c.Client.CoreV1().Secrets(mysql.Namespace).Get(mysql.TLSServerSecretName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{tlsCACertKey, core.TLSCertKey, core.TLSPrivateKeyKey} {
+		if len(secret.Data[key]) == 0 {
+			t.Errorf("expected key %v in server certificate secret", key)
+		}
+	}
+}
+
+func TestServerCertSecretData(t *testing.T) {
+	oldCA, newCA := []byte("old-ca"), []byte("new-ca")
+
+	// the servers that still present a certificate of the previous CA are verified with it
+	data := serverCertSecretData(nil, oldCA, []byte("cert"), []byte("key"))
+	if _, ok := data[tlsPreviousCACertKey]; ok {
+		t.Errorf("expected no previous CA certificate for a new Secret")
+	}
+	data = serverCertSecretData(data, oldCA, []byte("cert"), []byte("key"))
+	if _, ok := data[tlsPreviousCACertKey]; ok {
+		t.Errorf("expected no previous CA certificate while the CA is unchanged")
+	}
+	for i := 0; i < 2; i++ {
+		data = serverCertSecretData(data, newCA, []byte("cert"), []byte("key"))
+		if !bytes.Equal(data[tlsCACertKey], newCA) {
+			t.Errorf("expected the current CA certificate %q, got %q", newCA, data[tlsCACertKey])
+		}
+		if !bytes.Equal(data[tlsPreviousCACertKey], oldCA) {
+			t.Errorf("expected the previous CA certificate %q, got %q", oldCA, data[tlsPreviousCACertKey])
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	catalog "kubedb.dev/apimachinery/apis/catalog/v1alpha1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+)
+
+const (
+	EventReasonUpgrading     = "Upgrading"
+	EventReasonUpgraded      = "Upgraded"
+	EventReasonUpgradeFailed = "UpgradeFailed"
+
+	// how often an upgrade is checked while the servers are restarted and upgraded
+	upgradeCheckInterval = 10 * time.Second
+
+	upgradeJobType = "upgrade"
+	// the version that an upgrade Job upgrades a server to
+	upgradeVersionAnnotation = api.MySQLKey + "/upgrade-version"
+)
+
+// upgradeScript runs mysql_upgrade against the server at $HOST, so that the system tables are
+// upgraded to the version of the server. Replicas and group secondaries are super_read_only,
+// which is lifted while mysql_upgrade runs. The changes are not written to the binary log, so
+// every server is upgraded on its own. Since 8.0.16, the server upgrades itself when it starts,
+// and mysql_upgrade does nothing, or is not available at all.
+// ref: https://dev.mysql.com/doc/refman/5.7/en/mysql-upgrade.html
+const upgradeScript = `if ! command -v mysql_upgrade >/dev/null; then
+  echo "mysql_upgrade is not available, the server upgrades itself"
+  exit 0
+fi
+read_only=$(mysql --host="$HOST" --user="$DB_USER" -N -s -e 'SELECT @@GLOBAL.super_read_only') || exit 1
+if [ "$read_only" = "1" ]; then
+  mysql --host="$HOST" --user="$DB_USER" -e 'SET GLOBAL super_read_only = OFF' || exit 1
+fi
+mysql_upgrade --host="$HOST" --user="$DB_USER"
+code=$?
+if [ "$read_only" = "1" ]; then
+  mysql --host="$HOST" --user="$DB_USER" -e 'SET GLOBAL super_read_only = ON' || exit 1
+fi
+exit $code`
+
+// beginUpgrade records a change of spec.version in status, before the StatefulSet is updated to
+// the image of the new version. status.upgrade is recorded once the servers are created, so for a
+// MySQL that has none yet, the servers run the version of the image of its StatefulSet, if any.
+func (c *Controller) beginUpgrade(mysql *api.MySQL) error {
+	version := string(mysql.Spec.Version)
+	st := mysql.Status.Upgrade
+	if st != nil && st.Version == version {
+		return nil
+	}
+
+	// the version, or the image if it is of no MySQLVersion, that the servers are upgraded from
+	var previous, from string
+	if st != nil {
+		previous, from = st.Version, st.Version
+	} else {
+		image, err := c.statefulSetImage(mysql)
+		if err != nil {
+			return err
+		}
+		if image != "" {
+			if previous, err = c.imageVersion(image, version); err != nil {
+				return err
+			}
+			switch previous {
+			case version:
+				previous = ""
+			case "":
+				from = image
+			default:
+				from = previous
+			}
+		}
+	}
+
+	now := metav1.Now()
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		if in.Upgrade != nil {
+			previous = in.Upgrade.Version
+		} else if from == "" {
+			// the servers are created with spec.version
+			in.Upgrade = &api.MySQLUpgradeStatus{
+				Version: version,
+			}
+			return in
+		}
+		in.Upgrade = &api.MySQLUpgradeStatus{
+			Version:         version,
+			PreviousVersion: previous,
+			Phase:           api.MySQLUpgradePhaseUpgrading,
+			StartTime:       &now,
+		}
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	mysql.Status = my.Status
+
+	if from != "" {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			EventReasonUpgrading,
+			"Upgrading from version %v to %v",
+			from,
+			version,
+		)
+	}
+	return nil
+}
+
+// statefulSetImage returns the image that the StatefulSet of mysql runs the servers with, or "" if
+// the StatefulSet is not created yet.
+func (c *Controller) statefulSetImage(mysql *api.MySQL) (string, error) {
+	statefulSet, err := c.stsLister.StatefulSets(mysql.Namespace).Get(mysql.OffshootName())
+	if kerr.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	for _, container := range statefulSet.Spec.Template.Spec.Containers {
+		if container.Name == api.ResourceSingularMySQL {
+			return container.Image, nil
+		}
+	}
+	return "", nil
+}
+
+// imageVersion returns the name of the MySQLVersion whose image is image, preferring version, or ""
+// if image is of no MySQLVersion. The names are sorted, as deprecated versions may share an image.
+func (c *Controller) imageVersion(image, version string) (string, error) {
+	versions, err := c.ExtClient.CatalogV1alpha1().MySQLVersions().List(metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, v := range versions.Items {
+		if v.Spec.DB.Image != image {
+			continue
+		}
+		if v.Name == version {
+			return version, nil
+		}
+		names = append(names, v.Name)
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// ensureUpgrade runs the post-upgrade step on each server, once its pod runs the image of the new
+// version and is ready. The pods are restarted by the StatefulSet, or by ensureGroupRollout in group
+// mode, which waits for the post-upgrade step of a member before restarting the next one.
+// It returns true if no upgrade is in progress. A failed upgrade is not retried, until spec.version
+// is changed again, eg, back to status.upgrade.previousVersion.
+func (c *Controller) ensureUpgrade(mysql *api.MySQL) (bool, error) {
+	st := mysql.Status.Upgrade
+	if st == nil || st.Phase == "" || st.Phase == api.MySQLUpgradePhaseSucceeded {
+		return true, nil
+	}
+	if st.Phase == api.MySQLUpgradePhaseFailed {
+		return false, nil
+	}
+	c.requeueAfter(mysql, upgradeCheckInterval)
+
+	mysqlVersion, err := c.ExtClient.CatalogV1alpha1().MySQLVersions().Get(st.Version, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	pods, err := c.podLister.Pods(mysql.Namespace).List(labels.SelectorFromSet(mysql.OffshootSelectors()))
+	if err != nil {
+		return false, err
+	}
+
+	upgraded := sets.NewString(st.UpgradedMembers...)
+	var failure error
+	for _, pod := range pods {
+		if upgraded.Has(pod.Name) || pod.DeletionTimestamp != nil || !isPodReady(pod) || podImage(pod) != mysqlVersion.Spec.DB.Image {
+			continue
+		}
+		done, err := c.ensureUpgradeJob(mysql, pod, mysqlVersion)
+		if err == errUpgradeJobFailed {
+			failure = fmt.Errorf(`failed to upgrade pod "%v" to version %v. Reason: Job "%v" has failed, see the logs of its pods`, pod.Name, st.Version, upgradeJobName(pod.Name))
+			break
+		} else if err != nil {
+			return false, err
+		}
+		if done {
+			log.Infof("pod %v/%v of MySQL %v is upgraded to version %v", pod.Namespace, pod.Name, mysql.Name, st.Version)
+			upgraded.Insert(pod.Name)
+		}
+	}
+
+	succeeded := failure == nil && upgraded.Len() >= int(types.Int32(mysql.Spec.Replicas))
+	if failure == nil && !succeeded && upgraded.Len() == len(st.UpgradedMembers) {
+		return false, nil
+	}
+
+	now := metav1.Now()
+	my, err := util.UpdateMySQLStatus(c.ExtClient.KubedbV1alpha1(), mysql, func(in *api.MySQLStatus) *api.MySQLStatus {
+		if in.Upgrade == nil || in.Upgrade.Version != st.Version {
+			return in
+		}
+		in.Upgrade.UpgradedMembers = upgraded.List()
+		if failure != nil {
+			in.Upgrade.Phase = api.MySQLUpgradePhaseFailed
+			in.Upgrade.Reason = failure.Error()
+			in.Upgrade.CompletionTime = &now
+		} else if succeeded {
+			in.Upgrade.Phase = api.MySQLUpgradePhaseSucceeded
+			in.Upgrade.CompletionTime = &now
+		}
+		return in
+	})
+	if err != nil {
+		return false, err
+	}
+	mysql.Status = my.Status
+
+	if failure != nil {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeWarning,
+			EventReasonUpgradeFailed,
+			"%v. To roll back, set spec.version to %v",
+			failure,
+			st.PreviousVersion,
+		)
+		return false, failure
+	}
+	if succeeded {
+		c.recorder.Eventf(
+			mysql,
+			core.EventTypeNormal,
+			EventReasonUpgraded,
+			"Successfully upgraded from version %v to %v",
+			st.PreviousVersion,
+			st.Version,
+		)
+	}
+	return succeeded, nil
+}
+
+var errUpgradeJobFailed = errors.New("upgrade Job has failed")
+
+// ensureUpgradeJob runs upgradeScript against the server of the pod in a Job, and returns true once it
+// has succeeded. The Job is deleted on success, and kept on failure for its logs.
+func (c *Controller) ensureUpgradeJob(mysql *api.MySQL, pod *core.Pod, mysqlVersion *catalog.MySQLVersion) (bool, error) {
+	name := upgradeJobName(pod.Name)
+	job, err := c.Client.BatchV1().Jobs(mysql.Namespace).Get(name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		_, err = c.Client.BatchV1().Jobs(mysql.Namespace).Create(newUpgradeJob(mysql, name, pod.Name, mysqlVersion))
+		return false, err
+	} else if err != nil {
+		return false, err
+	}
+
+	switch {
+	case job.Annotations[upgradeVersionAnnotation] != mysqlVersion.Name:
+		// left from an older upgrade
+		return false, c.deleteJob(job)
+	case job.Status.Succeeded > 0:
+		return true, c.deleteJob(job)
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batch.JobFailed && cond.Status == core.ConditionTrue {
+			return false, errUpgradeJobFailed
+		}
+	}
+	return false, nil
+}
+
+func upgradeJobName(podName string) string {
+	return fmt.Sprintf("%s-%s", podName, upgradeJobType)
+}
+
+func newUpgradeJob(mysql *api.MySQL, name, podName string, mysqlVersion *catalog.MySQLVersion) *batch.Job {
+	jobLabels := mysql.OffshootLabels()
+	// The Job watcher of snapshots deletes every completed Job of a MySQL, but the
+	// result of an upgrade Job is checked by ensureUpgradeJob.
+	delete(jobLabels, api.LabelDatabaseKind)
+	jobLabels[api.AnnotationJobType] = upgradeJobType
+
+	return &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: mysql.Namespace,
+			Labels:    jobLabels,
+			Annotations: map[string]string{
+				upgradeVersionAnnotation: mysqlVersion.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: api.SchemeGroupVersion.String(),
+					Kind:       api.ResourceKindMySQL,
+					Name:       mysql.Name,
+					UID:        mysql.UID,
+				},
+			},
+		},
+		Spec: batch.JobSpec{
+			BackoffLimit: types.Int32P(2),
+			Template: core.PodTemplateSpec{
+				Spec: core.PodSpec{
+					Containers: []core.Container{
+						{
+							Name:  upgradeJobType,
+							Image: mysqlVersion.Spec.DB.Image,
+							Command: []string{
+								"bash",
+								"-c",
+								upgradeScript,
+							},
+							Env: []core.EnvVar{
+								{
+									Name:  "HOST",
+									Value: memberHost(mysql, podName),
+								},
+								{
+									Name: "DB_USER",
+									ValueFrom: &core.EnvVarSource{
+										SecretKeyRef: &core.SecretKeySelector{
+											LocalObjectReference: core.LocalObjectReference{
+												Name: mysql.Spec.DatabaseSecret.SecretName,
+											},
+											Key: KeyMySQLUser,
+										},
+									},
+								},
+								{
+									// read by the mysql clients
+									Name: "MYSQL_PWD",
+									ValueFrom: &core.EnvVarSource{
+										SecretKeyRef: &core.SecretKeySelector{
+											LocalObjectReference: core.LocalObjectReference{
+												Name: mysql.Spec.DatabaseSecret.SecretName,
+											},
+											Key: KeyMySQLPassword,
+										},
+									},
+								},
+							},
+						},
+					},
+					RestartPolicy:    core.RestartPolicyNever,
+					SecurityContext:  mysql.Spec.PodTemplate.Spec.SecurityContext,
+					ImagePullSecrets: mysql.Spec.PodTemplate.Spec.ImagePullSecrets,
+				},
+			},
+		},
+	}
+}
+
+func (c *Controller) deleteJob(job *batch.Job) error {
+	policy := metav1.DeletePropagationBackground
+	err := c.Client.BatchV1().Jobs(job.Namespace).Delete(job.Name, &metav1.DeleteOptions{
+		PropagationPolicy: &policy,
+	})
+	if kerr.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// upgradePending reports whether the pod has yet to complete the post-upgrade step of an upgrade
+// that is in progress or has failed.
+func upgradePending(mysql *api.MySQL, podName string) bool {
+	st := mysql.Status.Upgrade
+	if st == nil || st.Phase == "" || st.Phase == api.MySQLUpgradePhaseSucceeded {
+		return false
+	}
+	return !sets.NewString(st.UpgradedMembers...).Has(podName)
+}
+
+func podImage(pod *core.Pod) string {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == api.ResourceSingularMySQL {
+			return container.Image
+		}
+	}
+	return ""
+}
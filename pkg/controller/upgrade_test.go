@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	apps_listers "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	catalog "kubedb.dev/apimachinery/apis/catalog/v1alpha1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	extfake "kubedb.dev/apimachinery/client/clientset/versioned/fake"
+	amc "kubedb.dev/apimachinery/pkg/controller"
+)
+
+func TestBeginUpgrade(t *testing.T) {
+	newVersion := func(name, image string) *catalog.MySQLVersion {
+		return &catalog.MySQLVersion{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       catalog.MySQLVersionSpec{DB: catalog.MySQLVersionDatabase{Image: image}},
+		}
+	}
+	cases := []struct {
+		name     string
+		image    string
+		previous string
+		phase    api.MySQLUpgradePhase
+	}{
+		{name: "new MySQL"},
+		{name: "same version", image: "mysql:8.0.20"},
+		{name: "older version", image: "mysql:5.7.29", previous: "5.7.29", phase: api.MySQLUpgradePhaseUpgrading},
+		{name: "unknown image", image: "mysql:5.6", phase: api.MySQLUpgradePhaseUpgrading},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mysql := &api.MySQL{
+				ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+				Spec:       api.MySQLSpec{Version: "8.0.20"},
+			}
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tc.image != "" {
+				statefulSet := &apps.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: mysql.OffshootName(), Namespace: mysql.Namespace}}
+				statefulSet.Spec.Template.Spec.Containers = []core.Container{{Name: api.ResourceSingularMySQL, Image: tc.image}}
+				if err := indexer.Add(statefulSet); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c := &Controller{
+				Controller: &amc.Controller{
+					Client: fake.NewSimpleClientset(),
+					ExtClient: extfake.NewSimpleClientset(mysql,
+						newVersion("8.0.20", "mysql:8.0.20"),
+						newVersion("5.7.29", "mysql:5.7.29"),
+						newVersion("5.7.29-v1", "mysql:5.7.29"),
+					),
+				},
+				stsLister: apps_listers.NewStatefulSetLister(indexer),
+				recorder:  record.NewFakeRecorder(10),
+			}
+
+			if err := c.beginUpgrade(mysql); err != nil {
+				t.Fatal(err)
+			}
+			st := mysql.Status.Upgrade
+			if st == nil {
+				t.Fatalf("expected the upgrade status to be recorded")
+			}
+			if st.Version != "8.0.20" || st.PreviousVersion != tc.previous || st.Phase != tc.phase {
+				t.Errorf("expected version 8.0.20 from %q in phase %q, got %v from %q in phase %q",
+					tc.previous, tc.phase, st.Version, st.PreviousVersion, st.Phase)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+package controller
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	"github.com/go-xorm/xorm"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/reference"
+	kutil "kmodules.xyz/client-go"
+	core_util "kmodules.xyz/client-go/core/v1"
+	meta_util "kmodules.xyz/client-go/meta"
+	"kmodules.xyz/client-go/tools/queue"
+	appcat "kmodules.xyz/custom-resources/apis/appcatalog/v1alpha1"
+	appcat_util "kmodules.xyz/custom-resources/client/clientset/versioned/typed/appcatalog/v1alpha1/util"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+	"kubedb.dev/apimachinery/pkg/eventer"
+)
+
+const (
+	// maximum length of user names in MySQL
+	maxUserNameLength = 32
+)
+
+func (c *Controller) initMySQLUserWatcher() {
+	c.myuserInformer = c.KubedbInformerFactory.Kubedb().V1alpha1().MySQLUsers().Informer()
+	c.myuserQueue = queue.New(api.ResourceKindMySQLUser, c.MaxNumRequeues, c.NumThreads, c.runMySQLUser)
+	c.myuserLister = c.KubedbInformerFactory.Kubedb().V1alpha1().MySQLUsers().Lister()
+	c.myuserInformer.AddEventHandler(queue.NewObservableUpdateHandler(c.myuserQueue.GetQueue(), true))
+}
+
+func (c *Controller) runMySQLUser(key string) error {
+	log.Debugln("started processing, key:", key)
+	obj, exists, err := c.myuserInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		log.Errorf("Fetching object with key %s from store failed with %v", key, err)
+		return err
+	}
+
+	if !exists {
+		log.Debugf("MySQLUser %s does not exist anymore", key)
+		return nil
+	}
+
+	user := obj.(*api.MySQLUser).DeepCopy()
+	if user.DeletionTimestamp != nil {
+		if core_util.HasFinalizer(user.ObjectMeta, api.GenericKey) {
+			if err := c.dropUser(user); err != nil {
+				log.Errorln(err)
+				return err
+			}
+			_, _, err = util.PatchMySQLUser(c.ExtClient.KubedbV1alpha1(), user, func(in *api.MySQLUser) *api.MySQLUser {
+				in.ObjectMeta = core_util.RemoveFinalizer(in.ObjectMeta, api.GenericKey)
+				return in
+			})
+			return err
+		}
+		return nil
+	}
+
+	user, _, err = util.PatchMySQLUser(c.ExtClient.KubedbV1alpha1(), user, func(in *api.MySQLUser) *api.MySQLUser {
+		in.ObjectMeta = core_util.AddFinalizer(in.ObjectMeta, api.GenericKey)
+		return in
+	})
+	if err != nil {
+		return err
+	}
+	return c.syncMySQLUser(user)
+}
+
+// syncMySQLUser creates the user of a MySQLUser on the referenced MySQL with the password in its
+// credentials Secret, and the privileges in spec.grants. A password or privileges that were changed
+// on the server are reset. It is repeated every schemaSyncInterval.
+func (c *Controller) syncMySQLUser(user *api.MySQLUser) error {
+	user.SetDefaults()
+	if err := validateMySQLUser(user); err != nil {
+		c.recorder.Event(user, core.EventTypeWarning, eventer.EventReasonInvalid, err.Error())
+		return c.updateMySQLUserStatus(user, newObjectStatus(user, api.MySQLObjectPhaseFailed, err.Error()))
+	}
+	defer resync(c.myuserQueue, user)
+
+	others, err := c.otherMySQLUsers(user)
+	if err != nil {
+		return err
+	}
+	if owner, ok := isManagedBy(user, others); ok {
+		err := fmt.Errorf("user %q is managed by MySQLUser %v", user.UserName(), owner.GetName())
+		c.recorder.Event(user, core.EventTypeWarning, eventer.EventReasonInvalid, err.Error())
+		return c.updateMySQLUserStatus(user, newObjectStatus(user, api.MySQLObjectPhaseFailed, err.Error()))
+	}
+
+	mysql, err := c.getRunningMySQL(user.Namespace, user.Spec.DatabaseRef.Name)
+	if err != nil {
+		return c.updateMySQLUserStatus(user, newObjectStatus(user, api.MySQLObjectPhasePending, err.Error()))
+	}
+	if reserved, err := c.isReservedUser(mysql, user); err != nil {
+		return c.updateMySQLUserStatus(user, newObjectStatus(user, api.MySQLObjectPhasePending, err.Error()))
+	} else if reserved {
+		err := fmt.Errorf("user %q is reserved", user.UserName())
+		c.recorder.Event(user, core.EventTypeWarning, eventer.EventReasonInvalid, err.Error())
+		return c.updateMySQLUserStatus(user, newObjectStatus(user, api.MySQLObjectPhaseFailed, err.Error()))
+	}
+
+	if err := c.reconcileUser(mysql, user); err != nil {
+		c.recorder.Event(user, core.EventTypeWarning, eventer.EventReasonFailedToCreate, err.Error())
+		return c.updateMySQLUserStatus(user, newObjectStatus(user, api.MySQLObjectPhaseFailed, err.Error()))
+	}
+	return c.updateMySQLUserStatus(user, newObjectStatus(user, api.MySQLObjectPhaseReady, ""))
+}
+
+func (c *Controller) reconcileUser(mysql *api.MySQL, user *api.MySQLUser) error {
+	password, err := c.ensureUserSecret(user)
+	if err != nil {
+		return fmt.Errorf("failed to create secret for user %q. Reason: %v", user.UserName(), err)
+	}
+	hosts, err := c.writableHosts(mysql)
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		if err := c.ensureUser(mysql, host, user, password); err != nil {
+			return fmt.Errorf("failed to create user %q on %v. Reason: %v", user.UserName(), host, err)
+		}
+	}
+	if err := c.ensureUserAppBinding(mysql, user); err != nil {
+		return fmt.Errorf("failed to create appbinding for user %q. Reason: %v", user.UserName(), err)
+	}
+	return nil
+}
+
+func validateMySQLUser(user *api.MySQLUser) error {
+	if user.Spec.DatabaseRef.Name == "" {
+		return fmt.Errorf(`spec.databaseRef.name of MySQLUser %v/%v is not set`, user.Namespace, user.Name)
+	}
+	name := user.UserName()
+	if len(name) > maxUserNameLength {
+		return fmt.Errorf("user name %q is longer than %d characters", name, maxUserNameLength)
+	}
+	// users of the server itself, those of the operator are checked by isReservedUser
+	if strings.HasPrefix(name, "mysql.") {
+		return fmt.Errorf("user %q is reserved", name)
+	}
+	for _, g := range user.Spec.Grants {
+		if err := validateGrant(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// otherMySQLUsers returns the MySQLUsers, other than user and not being deleted, that claim the same
+// account on the same MySQL.
+func (c *Controller) otherMySQLUsers(user *api.MySQLUser) ([]metav1.Object, error) {
+	users, err := c.myuserLister.MySQLUsers(user.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var others []metav1.Object
+	for _, o := range users {
+		if o.Name != user.Name && o.DeletionTimestamp == nil && o.Spec.DatabaseRef.Name == user.Spec.DatabaseRef.Name &&
+			o.UserName() == user.UserName() && strings.EqualFold(o.Host(), user.Host()) {
+			others = append(others, o)
+		}
+	}
+	return others, nil
+}
+
+// isReservedUser reports whether user is one that the operator connects with, ie, the user of the
+// database secret or of the replication secret of mysql, or the user that spec.init.mysqlClone copies with.
+func (c *Controller) isReservedUser(mysql *api.MySQL, user *api.MySQLUser) (bool, error) {
+	name := user.UserName()
+	if name == cloneUserName(mysql) {
+		return true, nil
+	}
+	root, _, err := c.getRootCredentials(mysql)
+	if err != nil || name == root {
+		return name == root, err
+	}
+	if mysql.Spec.ReplicationSecret == nil {
+		return false, nil
+	}
+	repl, _, err := c.getReplicationCredentials(mysql)
+	return name == repl, err
+}
+
+// ensureUserSecret creates the credentials Secret of a MySQLUser with a generated password, and
+// returns the password. The password of an existing Secret is kept, so that it can be set by users.
+func (c *Controller) ensureUserSecret(user *api.MySQLUser) (string, error) {
+	ref, err := reference.GetReference(clientsetscheme.Scheme, user)
+	if err != nil {
+		return "", err
+	}
+	secret, err := c.Client.CoreV1().Secrets(user.Namespace).Get(user.OffshootName(), metav1.GetOptions{})
+	if err == nil {
+		if secret.Labels[api.LabelDatabaseKind] != api.ResourceKindMySQLUser ||
+			secret.Labels[meta_util.InstanceLabelKey] != user.Name {
+			return "", fmt.Errorf(`intended secret "%v/%v" already exists`, secret.Namespace, secret.Name)
+		}
+	} else if !kerr.IsNotFound(err) {
+		return "", err
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:      user.OffshootName(),
+		Namespace: user.Namespace,
+	}
+	secret, _, err = core_util.CreateOrPatchSecret(c.Client, meta, func(in *core.Secret) *core.Secret {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
+		in.Labels = core_util.UpsertMap(in.Labels, user.OffshootLabels())
+		if in.Data == nil {
+			in.Data = map[string][]byte{}
+		}
+		in.Data[KeyMySQLUser] = []byte(user.UserName())
+		if len(in.Data[KeyMySQLPassword]) == 0 {
+			in.Data[KeyMySQLPassword] = []byte(generatePassword())
+		}
+		return in
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(secret.Data[KeyMySQLPassword]), nil
+}
+
+// ensureUser creates the user on the server at host, resets its password if it doesn't match the
+// credentials Secret, and changes its privileges to those in spec.grants.
+func (c *Controller) ensureUser(mysql *api.MySQL, host string, user *api.MySQLUser, password string) error {
+	en, err := c.newMemberClient(mysql, host)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	name := user.UserName()
+	account := quoteString(name) + "@" + quoteString(user.Host())
+	rows, err := en.QueryString("SELECT plugin, authentication_string FROM mysql.user WHERE user = ? AND host = ?", name, user.Host())
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		if _, err := en.Exec(fmt.Sprintf("CREATE USER %s IDENTIFIED BY %s", account, quoteString(password))); err != nil {
+			return err
+		}
+		c.recorder.Eventf(user, core.EventTypeNormal, eventer.EventReasonSuccessful, "Successfully created user %q on %v", name, host)
+	} else if !c.isUserPassword(mysql, host, user, password, rows[0]) {
+		c.recorder.Eventf(user, core.EventTypeWarning, EventReasonDriftDetected, "Password of user %q on %v doesn't match secret %q", name, host, user.OffshootName())
+		if _, err := en.Exec(fmt.Sprintf("ALTER USER %s IDENTIFIED BY %s", account, quoteString(password))); err != nil {
+			return err
+		}
+		c.recorder.Eventf(user, core.EventTypeNormal, EventReasonRepaired, "Reset password of user %q on %v", name, host)
+	}
+
+	cur, err := showGrants(en, account)
+	if err != nil {
+		return err
+	}
+	stmts := grantStatements(account, cur, desiredGrants(user.Spec.Grants))
+	for _, stmt := range stmts {
+		if _, err := en.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if len(stmts) > 0 {
+		log.Infof("privileges of user %q on %v are changed for MySQLUser %v/%v", name, host, user.Namespace, user.Name)
+	}
+	return nil
+}
+
+// isUserPassword reports whether password is the password of the user of user. Hashes of
+// mysql_native_password are compared. Other authentication plugins salt the hash, so the password is
+// checked by logging in, which is only possible if the user may connect from any host. The password of
+// a user restricted to some hosts is not checked then.
+func (c *Controller) isUserPassword(mysql *api.MySQL, host string, user *api.MySQLUser, password string, row map[string]string) bool {
+	if row["plugin"] == "mysql_native_password" {
+		return row["authentication_string"] == nativePasswordHash(password)
+	}
+	if user.Host() != "%" {
+		return true
+	}
+	return c.checkCredentials(mysql, host, user.UserName(), password) == nil
+}
+
+// nativePasswordHash returns the hash of password that mysql_native_password stores, ie, PASSWORD(password).
+func nativePasswordHash(password string) string {
+	h1 := sha1.Sum([]byte(password))
+	h2 := sha1.Sum(h1[:])
+	return "*" + strings.ToUpper(hex.EncodeToString(h2[:]))
+}
+
+func showGrants(en *xorm.Engine, account string) (grantSet, error) {
+	rows, err := en.QueryString("SHOW GRANTS FOR " + account)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, row := range rows {
+		// the only column is named "Grants for <account>"
+		for _, line := range row {
+			lines = append(lines, line)
+		}
+	}
+	return parseGrants(lines), nil
+}
+
+// ensureUserAppBinding publishes the connection information of the MySQL with the credentials
+// Secret of the user.
+func (c *Controller) ensureUserAppBinding(mysql *api.MySQL, user *api.MySQLUser) error {
+	appmeta := user.AppBindingMeta()
+
+	meta := metav1.ObjectMeta{
+		Name:      appmeta.Name(),
+		Namespace: user.Namespace,
+	}
+
+	ref, err := reference.GetReference(clientsetscheme.Scheme, user)
+	if err != nil {
+		return err
+	}
+
+	mysqlVersion, err := c.ExtClient.CatalogV1alpha1().MySQLVersions().Get(string(mysql.Spec.Version), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get MySQLVersion %v for %v/%v. Reason: %v", mysql.Spec.Version, mysql.Namespace, mysql.Name, err)
+	}
+
+	params, err := json.Marshal(clusterParameters(mysql))
+	if err != nil {
+		return err
+	}
+
+	var caBundle []byte
+	if mysql.Spec.TLS != nil {
+		if caBundle, err = c.getTLSCACert(mysql); err != nil {
+			return fmt.Errorf("failed to get CA certificate for %v/%v. Reason: %v", mysql.Namespace, mysql.Name, err)
+		}
+	}
+
+	_, vt, err := appcat_util.CreateOrPatchAppBinding(c.AppCatalogClient.AppcatalogV1alpha1(), meta, func(in *appcat.AppBinding) *appcat.AppBinding {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, ref)
+		in.Labels = user.OffshootLabels()
+
+		in.Spec.Type = appmeta.Type()
+		in.Spec.Version = mysqlVersion.Spec.Version
+		in.Spec.ClientConfig.URL = types.StringP(fmt.Sprintf("tcp(%s:%d)/", mysql.ServiceName(), defaultDBPort.Port))
+		in.Spec.ClientConfig.Service = &appcat.ServiceReference{
+			Scheme: "mysql",
+			Name:   mysql.ServiceName(),
+			Port:   defaultDBPort.Port,
+			Path:   "/",
+		}
+		in.Spec.ClientConfig.InsecureSkipTLSVerify = false
+		in.Spec.ClientConfig.CABundle = caBundle
+
+		in.Spec.Secret = &core.LocalObjectReference{
+			Name: user.OffshootName(),
+		}
+
+		in.Spec.Parameters = nil
+		if mysql.HasMemberRoles() {
+			in.Spec.Parameters = &runtime.RawExtension{Raw: params}
+		}
+
+		return in
+	})
+	if err != nil {
+		return err
+	} else if vt != kutil.VerbUnchanged {
+		c.recorder.Eventf(
+			user,
+			core.EventTypeNormal,
+			eventer.EventReasonSuccessful,
+			"Successfully %s appbinding",
+			vt,
+		)
+	}
+	return nil
+}
+
+// dropUser drops the user of a deleted MySQLUser, if its deletionPolicy is Delete. The credentials
+// Secret and the AppBinding are garbage collected. With deletionPolicy Retain, the user is kept, and
+// so is the Secret with its password. Like dropDatabase, it fails while the MySQL is not running, and
+// keeps a user that another MySQLUser claims. A reserved user is never dropped.
+func (c *Controller) dropUser(user *api.MySQLUser) error {
+	user.SetDefaults()
+	if user.Spec.DeletionPolicy != api.MySQLDeletionPolicyDelete {
+		return c.retainUserSecret(user)
+	}
+	if validateMySQLUser(user) != nil {
+		return nil
+	}
+	if others, err := c.otherMySQLUsers(user); err != nil || len(others) > 0 {
+		return err
+	}
+	mysql, err := c.getMySQLForCleanup(user.Namespace, user.Spec.DatabaseRef.Name)
+	if err != nil || mysql == nil {
+		return err
+	}
+	if reserved, err := c.isReservedUser(mysql, user); err != nil || reserved {
+		return err
+	}
+	hosts, err := c.writableHosts(mysql)
+	if err != nil {
+		return err
+	}
+	account := quoteString(user.UserName()) + "@" + quoteString(user.Host())
+	for _, host := range hosts {
+		if err := c.execOnHost(mysql, host, "DROP USER IF EXISTS "+account); err != nil {
+			return fmt.Errorf("failed to drop user %q on %v. Reason: %v", user.UserName(), host, err)
+		}
+	}
+	log.Infof("user %q of MySQLUser %v/%v is dropped", user.UserName(), user.Namespace, user.Name)
+	return nil
+}
+
+// retainUserSecret removes the owner reference of the MySQLUser from its credentials Secret, so
+// that the Secret is not garbage collected.
+func (c *Controller) retainUserSecret(user *api.MySQLUser) error {
+	ref, err := reference.GetReference(clientsetscheme.Scheme, user)
+	if err != nil {
+		return err
+	}
+	secret, err := c.Client.CoreV1().Secrets(user.Namespace).Get(user.OffshootName(), metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	_, _, err = core_util.PatchSecret(c.Client, secret, func(in *core.Secret) *core.Secret {
+		core_util.RemoveOwnerReference(&in.ObjectMeta, ref)
+		return in
+	})
+	return err
+}
+
+func (c *Controller) updateMySQLUserStatus(user *api.MySQLUser, st *api.MySQLObjectStatus) error {
+	if !isObjectStatusChanged(user.Status, st) {
+		return nil
+	}
+	_, err := util.UpdateMySQLUserStatus(c.ExtClient.KubedbV1alpha1(), user, func(in *api.MySQLObjectStatus) *api.MySQLObjectStatus {
+		return st
+	})
+	return err
+}
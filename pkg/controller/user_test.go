@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	amc "kubedb.dev/apimachinery/pkg/controller"
+)
+
+func TestIsReservedUser(t *testing.T) {
+	secret := func(name, user string) *core.Secret {
+		return &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "demo"},
+			Data: map[string][]byte{
+				KeyMySQLUser:     []byte(user),
+				KeyMySQLPassword: []byte("secret"),
+			},
+		}
+	}
+	mysql := &api.MySQL{
+		ObjectMeta: metav1.ObjectMeta{Name: "my", Namespace: "demo", UID: "0123-4567-89ab"},
+		Spec: api.MySQLSpec{
+			DatabaseSecret:    &core.SecretVolumeSource{SecretName: "my-auth"},
+			ReplicationSecret: &core.SecretVolumeSource{SecretName: "my-repl"},
+		},
+	}
+	c := &Controller{Controller: &amc.Controller{Client: fake.NewSimpleClientset(
+		secret("my-auth", "admin"),
+		secret("my-repl", "replicator"),
+	)}}
+
+	cases := []struct {
+		name     string
+		reserved bool
+	}{
+		{name: "admin", reserved: true},
+		{name: "replicator", reserved: true},
+		{name: cloneUserName(mysql), reserved: true},
+		// the defaults are not reserved if the secrets have other users
+		{name: mysqlUser},
+		{name: replicationUser},
+		{name: "app"},
+	}
+	for _, tc := range cases {
+		user := &api.MySQLUser{Spec: api.MySQLUserSpec{UserName: tc.name}}
+		reserved, err := c.isReservedUser(mysql, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reserved != tc.reserved {
+			t.Errorf("expected user %q to be reserved: %v, got %v", tc.name, tc.reserved, reserved)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	"github.com/go-xorm/xorm"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kmodules.xyz/client-go/tools/queue"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
+)
+
+const (
+	EventReasonSnapshotVerified           = "SnapshotVerified"
+	EventReasonSnapshotVerificationFailed = "SnapshotVerificationFailed"
+
+	// how often a Snapshot is checked while it is restored into the throwaway database
+	verificationPollInterval = 15 * time.Second
+	// counting the rows of a table, or computing its checksum, reads the whole table
+	verificationQueryTimeout = "30m"
+	// the reasons of a failed verification are listed up to this many tables
+	maxVerificationFailures = 5
+)
+
+// initSnapshotVerificationWatcher verifies the Snapshots with spec.verification, once they succeed.
+func (c *Controller) initSnapshotVerificationWatcher() {
+	c.verifyQueue = queue.New("SnapshotVerification", c.MaxNumRequeues, c.NumThreads, c.runSnapshotVerification)
+	c.SnapInformer.AddEventHandler(queue.NewFilteredHandler(queue.NewEventHandler(c.verifyQueue.GetQueue(), func(oldObj, newObj interface{}) bool {
+		old, ok1 := oldObj.(*api.Snapshot)
+		nu, ok2 := newObj.(*api.Snapshot)
+		return ok1 && ok2 && old.Status.Phase != nu.Status.Phase
+	}), c.selector))
+}
+
+func (c *Controller) runSnapshotVerification(key string) error {
+	log.Debugln("started processing, key:", key)
+	obj, exists, err := c.SnapInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		log.Errorf("Fetching object with key %s from store failed with %v", key, err)
+		return err
+	}
+	if !exists {
+		log.Debugf("Snapshot %s does not exist anymore", key)
+		return nil
+	}
+
+	snapshot := obj.(*api.Snapshot).DeepCopy()
+	if snapshot.DeletionTimestamp != nil || snapshot.Spec.Verification == nil || snapshot.Status.Phase != api.SnapshotPhaseSucceeded {
+		return nil
+	}
+	return c.verifySnapshot(key, snapshot)
+}
+
+// verifySnapshot restores snapshot into a throwaway MySQL of the same version, with the restore path of
+// spec.init.snapshotSource, and checks its tables once it is initialized, one table per pass, so that the
+// worker is not blocked until all are read. The progress and result are recorded in status.verification,
+// and the throwaway MySQL is deleted.
+func (c *Controller) verifySnapshot(key string, snapshot *api.Snapshot) error {
+	st := snapshot.Status.Verification
+	if st != nil && st.Phase != api.SnapshotVerificationPhaseRunning {
+		// make sure the throwaway MySQL is gone, eg, if it could not be deleted before
+		return c.deleteVerificationInstance(snapshot)
+	}
+	if st == nil {
+		now := metav1.Now()
+		st = &api.SnapshotVerificationStatus{
+			Phase:     api.SnapshotVerificationPhaseRunning,
+			StartTime: &now,
+		}
+		var err error
+		if snapshot, err = util.UpdateSnapshotStatus(c.ExtClient.KubedbV1alpha1(), snapshot, func(in *api.SnapshotStatus) *api.SnapshotStatus {
+			in.Verification = st
+			return in
+		}); err != nil {
+			return err
+		}
+	}
+
+	mysql, err := c.myLister.MySQLs(snapshot.Namespace).Get(snapshot.Spec.DatabaseName)
+	if kerr.IsNotFound(err) {
+		return c.completeVerification(snapshot, fmt.Sprintf("MySQL %v/%v is not found", snapshot.Namespace, snapshot.Spec.DatabaseName))
+	} else if err != nil {
+		return err
+	}
+	instance, err := c.ensureVerificationInstance(mysql, snapshot)
+	if err != nil {
+		return err
+	}
+
+	_, initialized := instance.Annotations[api.AnnotationInitialized]
+	switch {
+	case instance.Status.Phase == api.DatabasePhaseFailed:
+		return c.completeVerification(snapshot, fmt.Sprintf("failed to restore Snapshot. Reason: %v", instance.Status.Reason))
+	case initialized && instance.Status.Phase == api.DatabasePhaseRunning:
+		cur, checked, err := c.verifyNextTable(instance, snapshot)
+		if err != nil {
+			log.Warningf("failed to check the tables restored from Snapshot %v/%v. Reason: %v", snapshot.Namespace, snapshot.Name, err)
+			break
+		}
+		snapshot = cur
+		if !checked {
+			reason := ""
+			if failures := verificationFailures(snapshot.Status.Verification.Tables); len(failures) > 0 {
+				reason = fmt.Sprintf("failed to check %d table(s): %v", len(failures), strings.Join(truncateFailures(failures), "; "))
+			}
+			return c.completeVerification(snapshot, reason)
+		}
+		if !verificationTimedOut(snapshot, time.Now()) {
+			// the next table is checked right away, after the keys that are already queued
+			c.verifyQueue.GetQueue().Add(key)
+			return nil
+		}
+	}
+
+	if verificationTimedOut(snapshot, time.Now()) {
+		return c.completeVerification(snapshot, "timed out while restoring and checking Snapshot")
+	}
+	c.verifyQueue.GetQueue().AddAfter(key, verificationPollInterval)
+	return nil
+}
+
+// verificationTimedOut reports whether the verification of snapshot started longer than its timeout ago.
+func verificationTimedOut(snapshot *api.Snapshot, now time.Time) bool {
+	timeout := api.MySQLDefaultBackupVerificationTimeout
+	if t := snapshot.Spec.Verification.Timeout; t != nil {
+		timeout = t.Duration
+	}
+	st := snapshot.Status.Verification
+	return st != nil && st.StartTime != nil && now.Sub(st.StartTime.Time) > timeout
+}
+
+func verificationInstanceName(snapshot *api.Snapshot) string {
+	return fmt.Sprintf("%s-verify", snapshot.Name)
+}
+
+// newVerificationInstance returns the throwaway MySQL that snapshot of mysql is restored into. It is a
+// standalone server of the same version and configuration with ephemeral storage, and uses the
+// database secret of mysql, as the restored grant tables have its credentials. It is owned by snapshot,
+// so it is garbage collected with the Snapshot.
+func newVerificationInstance(mysql *api.MySQL, snapshot *api.Snapshot) *api.MySQL {
+	return &api.MySQL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      verificationInstanceName(snapshot),
+			Namespace: snapshot.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: api.SchemeGroupVersion.String(),
+					Kind:       api.ResourceKindSnapshot,
+					Name:       snapshot.Name,
+					UID:        snapshot.UID,
+				},
+			},
+		},
+		Spec: api.MySQLSpec{
+			Version:        mysql.Spec.Version,
+			Replicas:       types.Int32P(1),
+			StorageType:    api.StorageTypeEphemeral,
+			DatabaseSecret: mysql.Spec.DatabaseSecret.DeepCopy(),
+			Config:         copyConfig(mysql.Spec.Config),
+			ConfigSource:   mysql.Spec.ConfigSource.DeepCopy(),
+			PodTemplate:    *mysql.Spec.PodTemplate.DeepCopy(),
+			Init: &api.InitSpec{
+				SnapshotSource: &api.SnapshotSourceSpec{
+					Namespace: snapshot.Namespace,
+					Name:      snapshot.Name,
+				},
+			},
+			TerminationPolicy: api.TerminationPolicyDelete,
+		},
+	}
+}
+
+func copyConfig(config map[string]string) map[string]string {
+	if config == nil {
+		return nil
+	}
+	out := make(map[string]string, len(config))
+	for k, v := range config {
+		out[k] = v
+	}
+	return out
+}
+
+// ensureVerificationInstance creates the throwaway MySQL that snapshot is restored into, unless it exists.
+func (c *Controller) ensureVerificationInstance(mysql *api.MySQL, snapshot *api.Snapshot) (*api.MySQL, error) {
+	instance, err := c.myLister.MySQLs(snapshot.Namespace).Get(verificationInstanceName(snapshot))
+	if kerr.IsNotFound(err) {
+		instance, err = c.ExtClient.KubedbV1alpha1().MySQLs(snapshot.Namespace).Create(newVerificationInstance(mysql, snapshot))
+		if kerr.IsAlreadyExists(err) {
+			instance, err = c.ExtClient.KubedbV1alpha1().MySQLs(snapshot.Namespace).Get(verificationInstanceName(snapshot), metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isVerificationInstance(instance, snapshot) {
+		return nil, fmt.Errorf("MySQL %v/%v exists, and is not owned by Snapshot %v", instance.Namespace, instance.Name, snapshot.Name)
+	}
+	return instance, nil
+}
+
+// isVerificationInstance reports whether instance is the throwaway MySQL of snapshot, so that a MySQL
+// of a user with the same name is never deleted.
+func isVerificationInstance(instance *api.MySQL, snapshot *api.Snapshot) bool {
+	for _, ref := range instance.OwnerReferences {
+		if ref.Kind == api.ResourceKindSnapshot && ref.UID == snapshot.UID {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Controller) deleteVerificationInstance(snapshot *api.Snapshot) error {
+	instance, err := c.myLister.MySQLs(snapshot.Namespace).Get(verificationInstanceName(snapshot))
+	if kerr.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !isVerificationInstance(instance, snapshot) || instance.DeletionTimestamp != nil {
+		return nil
+	}
+	err = c.ExtClient.KubedbV1alpha1().MySQLs(instance.Namespace).Delete(instance.Name, &metav1.DeleteOptions{})
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// completeVerification records the result of the verification of snapshot, and deletes the throwaway
+// MySQL. The verification failed if reason is not empty. The tables that are checked are kept.
+func (c *Controller) completeVerification(snapshot *api.Snapshot, reason string) error {
+	phase := api.SnapshotVerificationPhaseSucceeded
+	if reason != "" {
+		phase = api.SnapshotVerificationPhaseFailed
+	}
+	snapshot, err := util.UpdateSnapshotStatus(c.ExtClient.KubedbV1alpha1(), snapshot, func(in *api.SnapshotStatus) *api.SnapshotStatus {
+		if in.Verification == nil {
+			in.Verification = &api.SnapshotVerificationStatus{}
+		}
+		now := metav1.Now()
+		in.Verification.Phase = phase
+		in.Verification.Reason = reason
+		in.Verification.CompletionTime = &now
+		return in
+	})
+	if err != nil {
+		return err
+	}
+
+	if phase == api.SnapshotVerificationPhaseSucceeded {
+		c.recorder.Eventf(snapshot, core.EventTypeNormal, EventReasonSnapshotVerified, "Successfully restored Snapshot, and checked %d table(s)", len(snapshot.Status.Verification.Tables))
+	} else {
+		c.recorder.Event(snapshot, core.EventTypeWarning, EventReasonSnapshotVerificationFailed, reason)
+	}
+	return c.deleteVerificationInstance(snapshot)
+}
+
+// verifyNextTable counts the rows of the first table of the user databases of instance that is not yet
+// checked, or computes its checksum, by the method of snapshot, and appends it to status.verification.
+// A table that can't be read is appended with the reason. It returns the updated snapshot, and whether
+// a table was checked, ie, false once all the tables are checked. It fails if the tables can't be listed.
+func (c *Controller) verifyNextTable(instance *api.MySQL, snapshot *api.Snapshot) (*api.Snapshot, bool, error) {
+	user, password, err := c.getRootCredentials(instance)
+	if err != nil {
+		return nil, false, err
+	}
+	en, err := c.newMemberClientWithTimeout(instance, instance.PeerName(0), user, password, verificationQueryTimeout)
+	if err != nil {
+		return nil, false, err
+	}
+	defer en.Close()
+
+	excluded := make([]string, 0, len(systemDatabases))
+	for _, db := range systemDatabases {
+		excluded = append(excluded, quoteString(db))
+	}
+	rows, err := en.QueryString(fmt.Sprintf(
+		"SELECT TABLE_SCHEMA AS db, TABLE_NAME AS tbl FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA NOT IN (%s) ORDER BY TABLE_SCHEMA, TABLE_NAME",
+		strings.Join(excluded, ", "),
+	))
+	if err != nil {
+		return nil, false, err
+	}
+
+	// the progress is read from the apiserver, as the Snapshot in the informer may not have it yet
+	cur, err := c.ExtClient.KubedbV1alpha1().Snapshots(snapshot.Namespace).Get(snapshot.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, false, err
+	}
+	if cur.Status.Verification == nil {
+		return nil, false, fmt.Errorf("verification of Snapshot %v/%v is not started", snapshot.Namespace, snapshot.Name)
+	}
+	table := nextUncheckedTable(rows, cur.Status.Verification.Tables)
+	if table == nil {
+		return cur, false, nil
+	}
+	if err := verifyTable(en, table, snapshot.Spec.Verification.Method); err != nil {
+		table.Failure = err.Error()
+	}
+	snapshot, err = util.UpdateSnapshotStatus(c.ExtClient.KubedbV1alpha1(), cur, func(in *api.SnapshotStatus) *api.SnapshotStatus {
+		if in.Verification != nil && !hasVerifiedTable(in.Verification.Tables, *table) {
+			in.Verification.Tables = append(in.Verification.Tables, *table)
+		}
+		return in
+	})
+	return snapshot, true, err
+}
+
+// nextUncheckedTable returns the first of the tables in rows, as listed from information_schema, that
+// is not in checked, or nil if all are checked.
+func nextUncheckedTable(rows []map[string]string, checked []api.VerifiedTable) *api.VerifiedTable {
+	done := make(map[string]bool, len(checked))
+	for _, t := range checked {
+		done[t.Database+"."+t.Table] = true
+	}
+	for _, row := range rows {
+		if !done[row["db"]+"."+row["tbl"]] {
+			return &api.VerifiedTable{
+				Database: row["db"],
+				Table:    row["tbl"],
+			}
+		}
+	}
+	return nil
+}
+
+func hasVerifiedTable(tables []api.VerifiedTable, table api.VerifiedTable) bool {
+	for _, t := range tables {
+		if t.Database == table.Database && t.Table == table.Table {
+			return true
+		}
+	}
+	return false
+}
+
+// verificationFailures returns the reasons of the tables that could not be checked.
+func verificationFailures(tables []api.VerifiedTable) []string {
+	var failures []string
+	for _, t := range tables {
+		if t.Failure != "" {
+			failures = append(failures, fmt.Sprintf("%v.%v: %v", t.Database, t.Table, t.Failure))
+		}
+	}
+	return failures
+}
+
+// verifyTable reads the whole table, and sets its row count or checksum, by method.
+func verifyTable(en *xorm.Engine, table *api.VerifiedTable, method api.BackupVerificationMethod) error {
+	name := quoteIdentifier(table.Database) + "." + quoteIdentifier(table.Table)
+	if method == api.BackupVerificationMethodChecksum {
+		rows, err := en.QueryString("CHECKSUM TABLE " + name + " EXTENDED")
+		if err != nil {
+			return err
+		}
+		// the checksum is NULL if the table can't be read
+		if len(rows) == 0 || rows[0]["Checksum"] == "" {
+			return fmt.Errorf("no checksum")
+		}
+		checksum, err := strconv.ParseInt(rows[0]["Checksum"], 10, 64)
+		if err != nil {
+			return err
+		}
+		table.Checksum = &checksum
+		return nil
+	}
+
+	rows, err := en.QueryString("SELECT COUNT(*) AS count FROM " + name)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no row count")
+	}
+	count, err := strconv.ParseInt(rows[0]["count"], 10, 64)
+	if err != nil {
+		return err
+	}
+	table.Rows = &count
+	return nil
+}
+
+func truncateFailures(failures []string) []string {
+	if len(failures) <= maxVerificationFailures {
+		return failures
+	}
+	return append(failures[:maxVerificationFailures:maxVerificationFailures], fmt.Sprintf("and %d more", len(failures)-maxVerificationFailures))
+}
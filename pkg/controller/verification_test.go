@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/appscode/go/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
+)
+
+func TestNewVerificationInstance(t *testing.T) {
+	mysql := &api.MySQL{
+		Spec: api.MySQLSpec{
+			Version:     "8.0.14",
+			Replicas:    types.Int32P(3),
+			StorageType: api.StorageTypeDurable,
+			Config:      map[string]string{"max_connections": "200"},
+		},
+	}
+	snapshot := &api.Snapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: "snap", Namespace: "demo", UID: "uid"},
+	}
+
+	instance := newVerificationInstance(mysql, snapshot)
+	if instance.Name != "snap-verify" || instance.Namespace != "demo" {
+		t.Errorf("unexpected name %s/%s", instance.Namespace, instance.Name)
+	}
+	if *instance.Spec.Replicas != 1 || instance.Spec.StorageType != api.StorageTypeEphemeral || instance.Spec.Version != mysql.Spec.Version {
+		t.Errorf("unexpected spec %+v", instance.Spec)
+	}
+	if !reflect.DeepEqual(instance.Spec.Config, mysql.Spec.Config) {
+		t.Errorf("expected config %v, got %v", mysql.Spec.Config, instance.Spec.Config)
+	}
+	if src := instance.Spec.Init.SnapshotSource; src.Name != "snap" || src.Namespace != "demo" {
+		t.Errorf("unexpected snapshot source %+v", src)
+	}
+	if !isVerificationInstance(instance, snapshot) {
+		t.Error("expected instance to be owned by the snapshot")
+	}
+	if isVerificationInstance(&api.MySQL{ObjectMeta: metav1.ObjectMeta{Name: "snap-verify"}}, snapshot) {
+		t.Error("expected a MySQL without owner not to be the verification instance")
+	}
+}
+
+func TestVerificationTimedOut(t *testing.T) {
+	now := time.Now()
+	snapshot := &api.Snapshot{
+		Spec: api.SnapshotSpec{
+			Verification: &api.BackupVerificationSpec{Method: api.BackupVerificationMethodRowCount},
+		},
+	}
+	if verificationTimedOut(snapshot, now) {
+		t.Error("expected a verification that has not started not to time out")
+	}
+
+	snapshot.Status.Verification = &api.SnapshotVerificationStatus{
+		StartTime: &metav1.Time{Time: now.Add(-30 * time.Minute)},
+	}
+	if verificationTimedOut(snapshot, now) {
+		t.Error("expected the default timeout not to have passed")
+	}
+	snapshot.Spec.Verification.Timeout = &metav1.Duration{Duration: 10 * time.Minute}
+	if !verificationTimedOut(snapshot, now) {
+		t.Error("expected the timeout to have passed")
+	}
+}
+
+func TestTruncateFailures(t *testing.T) {
+	failures := []string{"a", "b", "c", "d", "e", "f", "g"}
+	truncated := truncateFailures(failures)
+	if len(truncated) != maxVerificationFailures+1 || truncated[maxVerificationFailures] != "and 2 more" {
+		t.Errorf("unexpected failures %v", truncated)
+	}
+	if len(failures) != 7 || failures[5] != "f" {
+		t.Errorf("expected failures not to be modified, got %v", failures)
+	}
+}
+
+func TestNextUncheckedTable(t *testing.T) {
+	rows := []map[string]string{
+		{"db": "app", "tbl": "a"},
+		{"db": "app", "tbl": "b"},
+		{"db": "other", "tbl": "a"},
+	}
+	checked := []api.VerifiedTable{
+		{Database: "app", Table: "a", Rows: types.Int64P(3)},
+		{Database: "app", Table: "b", Failure: "no row count"},
+	}
+	if next := nextUncheckedTable(rows, checked[:1]); next == nil || next.Database != "app" || next.Table != "b" {
+		t.Errorf("expected app.b to be checked next, got %+v", next)
+	}
+	if next := nextUncheckedTable(rows, checked); next == nil || next.Database != "other" || next.Table != "a" {
+		t.Errorf("expected other.a to be checked next, got %+v", next)
+	}
+	checked = append(checked, api.VerifiedTable{Database: "other", Table: "a", Rows: types.Int64P(0)})
+	if next := nextUncheckedTable(rows, checked); next != nil {
+		t.Errorf("expected all tables to be checked, got %+v", next)
+	}
+	if expected := []string{"app.b: no row count"}; !reflect.DeepEqual(verificationFailures(checked), expected) {
+		t.Errorf("expected failures %v, got %v", expected, verificationFailures(checked))
+	}
+}
@@ -1,18 +1,175 @@
 package controller
 
 import (
+	"reflect"
+	"time"
+
 	"github.com/appscode/go/log"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apps_informers "k8s.io/client-go/informers/apps/v1"
+	core_informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	apps_listers "k8s.io/client-go/listers/apps/v1"
+	core_listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	core_util "kmodules.xyz/client-go/core/v1"
 	"kmodules.xyz/client-go/tools/queue"
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha1"
 	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha1/util"
 )
 
-func (c *Controller) initWatcher() {
+// index of the MySQLs by the key of the ConfigMap in spec.configSource
+const configSourceIndex = "configSource"
+
+func (c *Controller) initWatcher() error {
 	c.myInformer = c.KubedbInformerFactory.Kubedb().V1alpha1().MySQLs().Informer()
+	if err := c.myInformer.AddIndexers(cache.Indexers{configSourceIndex: configSourceIndexFunc}); err != nil {
+		return err
+	}
 	c.myQueue = queue.New("MySQL", c.MaxNumRequeues, c.NumThreads, c.runMySQL)
 	c.myLister = c.KubedbInformerFactory.Kubedb().V1alpha1().MySQLs().Lister()
 	c.myInformer.AddEventHandler(queue.NewObservableUpdateHandler(c.myQueue.GetQueue(), true))
+
+	c.initStatefulSetWatcher()
+	c.initPodWatcher()
+	c.initConfigMapWatcher()
+	c.initOffshootWatchers()
+	c.initMySQLDatabaseWatcher()
+	c.initMySQLUserWatcher()
+	return nil
+}
+
+func (c *Controller) tweakListOptions(options *metav1.ListOptions) {
+	options.LabelSelector = c.selector.String()
+}
+
+// initStatefulSetWatcher re-enqueues the owning MySQL when the status of its StatefulSet changes.
+func (c *Controller) initStatefulSetWatcher() {
+	c.stsInformer = c.KubeInformerFactory.InformerFor(&apps.StatefulSet{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return apps_informers.NewFilteredStatefulSetInformer(
+			client,
+			c.WatchNamespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			c.tweakListOptions,
+		)
+	})
+	c.stsLister = apps_listers.NewStatefulSetLister(c.stsInformer.GetIndexer())
+	c.stsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueueOwnerMySQL,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSts, ok1 := oldObj.(*apps.StatefulSet)
+			newSts, ok2 := newObj.(*apps.StatefulSet)
+			if ok1 && ok2 && oldSts.ResourceVersion == newSts.ResourceVersion {
+				return
+			}
+			c.enqueueOwnerMySQL(newObj)
+		},
+		DeleteFunc: c.enqueueOwnerMySQL,
+	})
+}
+
+// initPodWatcher re-enqueues the owning MySQL when one of its pods becomes ready or unready.
+func (c *Controller) initPodWatcher() {
+	c.podInformer = c.KubeInformerFactory.InformerFor(&core.Pod{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return core_informers.NewFilteredPodInformer(
+			client,
+			c.WatchNamespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			c.tweakListOptions,
+		)
+	})
+	c.podLister = core_listers.NewPodLister(c.podInformer.GetIndexer())
+	c.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueueOwnerMySQL,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok1 := oldObj.(*core.Pod)
+			newPod, ok2 := newObj.(*core.Pod)
+			if ok1 && ok2 && oldPod.Status.Phase == newPod.Status.Phase && isPodReady(oldPod) == isPodReady(newPod) {
+				return
+			}
+			c.enqueueOwnerMySQL(newObj)
+		},
+		DeleteFunc: c.enqueueOwnerMySQL,
+	})
+}
+
+// initConfigMapWatcher re-enqueues the MySQLs that use a ConfigMap as spec.configSource when its data
+// changes. User ConfigMaps don't carry the labels of the operator, so they are not filtered by c.selector.
+// Changes of a Secret used as spec.configSource are observed when the MySQL is resynced.
+func (c *Controller) initConfigMapWatcher() {
+	c.cmInformer = c.KubeInformerFactory.InformerFor(&core.ConfigMap{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return core_informers.NewConfigMapInformer(
+			client,
+			c.WatchNamespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+	})
+	c.cmInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldCM, ok1 := oldObj.(*core.ConfigMap)
+			newCM, ok2 := newObj.(*core.ConfigMap)
+			if !ok1 || !ok2 || (reflect.DeepEqual(oldCM.Data, newCM.Data) && reflect.DeepEqual(oldCM.BinaryData, newCM.BinaryData)) {
+				return
+			}
+			c.enqueueConfigMapUsers(newCM)
+		},
+	})
+}
+
+// configSourceIndexFunc indexes a MySQL by the key of the ConfigMap in spec.configSource, if any.
+func configSourceIndexFunc(obj interface{}) ([]string, error) {
+	mysql, ok := obj.(*api.MySQL)
+	if !ok {
+		return nil, nil
+	}
+	if source := mysql.Spec.ConfigSource; source != nil && source.ConfigMap != nil {
+		return []string{mysql.Namespace + "/" + source.ConfigMap.Name}, nil
+	}
+	return nil, nil
+}
+
+// enqueueConfigMapUsers adds the keys of the MySQLs that use the ConfigMap as spec.configSource into the MySQL queue.
+func (c *Controller) enqueueConfigMapUsers(cm *core.ConfigMap) {
+	mysqls, err := c.myInformer.GetIndexer().ByIndex(configSourceIndex, cm.Namespace+"/"+cm.Name)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	for _, obj := range mysqls {
+		queue.Enqueue(c.myQueue.GetQueue(), obj)
+	}
+}
+
+// enqueueOwnerMySQL adds the key of the MySQL object an offshoot belongs to into the MySQL queue.
+// The owner is identified by the database name and kind labels set by OffshootSelectors.
+func (c *Controller) enqueueOwnerMySQL(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	o, ok := obj.(metav1.Object)
+	if !ok {
+		log.Errorf("couldn't get object from %+v", obj)
+		return
+	}
+	labels := o.GetLabels()
+	if labels[api.LabelDatabaseKind] != api.ResourceKindMySQL || labels[api.LabelDatabaseName] == "" {
+		return
+	}
+	c.myQueue.GetQueue().Add(o.GetNamespace() + "/" + labels[api.LabelDatabaseName])
+}
+
+func isPodReady(pod *core.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == core.PodReady {
+			return cond.Status == core.ConditionTrue
+		}
+	}
+	return false
 }
 
 func (c *Controller) runMySQL(key string) error {
@@ -49,7 +206,9 @@ func (c *Controller) runMySQL(key string) error {
 			if err != nil {
 				return err
 			}
-			if err := c.create(mysql); err != nil {
+			err := c.create(mysql)
+			c.reportOffshootRepairs(mysql, err)
+			if err != nil {
 				log.Errorln(err)
 				c.pushFailureEvent(mysql, err.Error())
 				return err